@@ -0,0 +1,57 @@
+package pathutil
+
+import "testing"
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"src/**", "src", true},
+		{"src/**", "src/a/b.txt", true},
+		{"src/**", "srcx/a", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a**", "abc/def", true},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "/.txt", false},
+		{"file[0-9].log", "file3.log", true},
+		{"file[0-9].log", "filex.log", false},
+		{"file[!0-9].log", "filex.log", true},
+		{`\*.md`, "*.md", true},
+		{`\*.md`, "a.md", false},
+		{"a+b(c).txt", "a+b(c).txt", true},
+	}
+	for _, tt := range tests {
+		re, err := CompileGlob(tt.pattern)
+		if err != nil {
+			t.Errorf("CompileGlob(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("CompileGlob(%q) match %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := CompileGlob("file[0-9"); err == nil {
+		t.Error("CompileGlob with unterminated class: want error")
+	}
+}
+
+func TestQuoteGlob(t *testing.T) {
+	for _, s := range []string{"/home/u/proj[1]", "/a*b/c?d", `C:\x`, "plain/path"} {
+		re, err := CompileGlob(QuoteGlob(s) + "/**")
+		if err != nil {
+			t.Errorf("CompileGlob(QuoteGlob(%q)): %v", s, err)
+			continue
+		}
+		if !re.MatchString(s+"/f") || re.MatchString(s+"x/f") {
+			t.Errorf("QuoteGlob(%q) = %q does not match literally", s, QuoteGlob(s))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package pathutil 路径的解析和比较，供受限模式、策略和文件工具共用
+package pathutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// caseInsensitive 文件系统默认不区分大小写的平台
+var caseInsensitive = runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+
+// Resolve 返回解析符号链接后的绝对路径；路径不存在时（如将要创建的文件）解析最近的已存在上级目录，再接上其余部分
+// 指向不存在目标的符号链接无法确定实际访问的位置，返回错误
+func Resolve(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if _, lerr := os.Lstat(path); lerr == nil {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// Fold 返回用于比较的路径：在默认不区分大小写的平台（macOS、Windows）上转换为小写
+func Fold(path string) string {
+	if caseInsensitive {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// Within 判断路径是否位于目录之内（包括目录本身），按字面路径比较
+func Within(dir, target string) bool {
+	rel, err := filepath.Rel(dir, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
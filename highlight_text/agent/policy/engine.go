@@ -0,0 +1,173 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"highlight_text/agent/pathutil"
+)
+
+// Source 一个规则文件
+type Source struct {
+	Path string
+	// Untrusted 规则文件可能由Agent或仓库内容控制（如工作空间中的规则文件），
+	// 其中的规则只能比内置规则更严格，不能放宽内置规则要求的 confirm 或 deny
+	Untrusted bool
+}
+
+// Engine 依次使用规则文件和内置规则评估工具调用，规则文件修改后自动重新加载
+type Engine struct {
+	builtin   *Policy
+	sources   func() []Source // 规则文件，靠前的优先；不存在的文件被忽略
+	protected func() []string // 不允许工具访问的路径（规则文件及其所在目录），目录包括其下的所有路径
+
+	mu    sync.Mutex
+	cache map[string]*cachedPolicy
+}
+
+type cachedPolicy struct {
+	modTime time.Time
+	size    int64
+	policy  *Policy
+	err     error
+}
+
+// loadedPolicy 已加载的规则文件
+type loadedPolicy struct {
+	*Policy
+	untrusted bool
+}
+
+// NewEngine 创建策略引擎，builtin 需已调用 Compile
+// sources 和 protected 在每次评估时调用，以便跟随工作空间切换
+func NewEngine(builtin *Policy, sources func() []Source, protected func() []string) *Engine {
+	return &Engine{builtin: builtin, sources: sources, protected: protected, cache: make(map[string]*cachedPolicy)}
+}
+
+// Evaluate 评估一次工具调用
+// 规则文件无效时拒绝所有调用，避免其中的 deny 规则被静默忽略；规则文件及其所在目录不允许被工具调用访问
+// 涉及多个路径的调用按每个路径分别评估，返回最严格的结果
+func (e *Engine) Evaluate(call Call) Result {
+	if len(call.Paths) > 0 {
+		var result Result
+		for i, p := range call.Paths {
+			c := call
+			c.Path, c.Paths = p, nil
+			if r := e.Evaluate(c); i == 0 || severity(r.Decision) > severity(result.Decision) {
+				result = r
+			}
+		}
+		return result
+	}
+
+	if call.Path != "" {
+		if e.Protected(call.Path) {
+			return Result{Decision: Deny, Rule: "protected", Reason: "策略文件不能由Agent访问"}
+		}
+		// 按实际访问的位置匹配规则：指向 deny 目录的符号链接同样被拒绝，也不会因链接所在的位置而被允许
+		call.Path = resolvePath(call.Path)
+	}
+	if call.InitialDir != "" {
+		call.InitialDir = resolvePath(call.InitialDir)
+	}
+
+	policies, err := e.load(e.sources())
+	if err != nil {
+		return Result{Decision: Deny, Rule: "invalid_policy", Reason: fmt.Sprintf("策略文件无效，已拒绝所有工具调用: %v", err)}
+	}
+	builtin := e.builtin.match(call)
+	for _, p := range policies {
+		r := p.match(call)
+		if r == nil {
+			continue
+		}
+		if p.untrusted && builtin != nil && severity(builtin.Decision) > severity(r.Decision) {
+			// 不可信的规则文件不能放宽内置规则
+			r = builtin
+		}
+		return Result{Decision: r.Decision, Rule: r.id, Reason: r.Reason}
+	}
+	if builtin != nil {
+		return Result{Decision: builtin.Decision, Rule: builtin.id, Reason: builtin.Reason}
+	}
+	for _, p := range policies {
+		if p.Default != "" {
+			return Result{Decision: p.Default}
+		}
+	}
+	if e.builtin.Default != "" {
+		return Result{Decision: e.builtin.Default}
+	}
+	return Result{Decision: Allow}
+}
+
+// Protected 判断路径是否为受保护的路径或位于受保护的目录之下
+// 按解析符号链接后的真实路径比较，在不区分大小写的平台上忽略大小写；路径无法解析时视为受保护
+func (e *Engine) Protected(path string) bool {
+	resolved, err := pathutil.Resolve(path)
+	if err != nil {
+		return true
+	}
+	resolved = pathutil.Fold(resolved)
+	for _, p := range e.protected() {
+		if protected, err := pathutil.Resolve(p); err == nil && pathutil.Within(pathutil.Fold(protected), resolved) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sources 返回存在的规则文件及其加载错误（nil 表示有效）
+func (e *Engine) Sources() map[string]error {
+	result := make(map[string]error)
+	for _, source := range e.sources() {
+		if _, err := os.Stat(source.Path); err != nil {
+			continue
+		}
+		_, result[source.Path] = e.loadFile(source.Path)
+	}
+	return result
+}
+
+// load 加载所有存在的规则文件
+func (e *Engine) load(sources []Source) ([]loadedPolicy, error) {
+	var policies []loadedPolicy
+	for _, source := range sources {
+		p, err := e.loadFile(source.Path)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			policies = append(policies, loadedPolicy{Policy: p, untrusted: source.Untrusted})
+		}
+	}
+	return policies, nil
+}
+
+// loadFile 加载规则文件，文件未修改时使用缓存；文件不存在时返回 nil
+func (e *Engine) loadFile(source string) (*Policy, error) {
+	info, err := os.Stat(source)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.cache[source]; ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.policy, c.err
+	}
+	c := &cachedPolicy{modTime: info.ModTime(), size: info.Size()}
+	data, err := os.ReadFile(source)
+	if err != nil {
+		c.err = err
+	} else {
+		c.policy, c.err = Parse(data, source)
+	}
+	e.cache[source] = c
+	return c.policy, c.err
+}
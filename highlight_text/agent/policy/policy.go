@@ -0,0 +1,179 @@
+// Package policy 根据规则决定Agent的工具调用是直接执行、需要用户确认还是拒绝
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"highlight_text/agent/pathutil"
+)
+
+// Decision 对一次工具调用的决定
+type Decision string
+
+const (
+	Allow   Decision = "allow"   // 直接执行
+	Confirm Decision = "confirm" // 需要用户确认
+	Deny    Decision = "deny"    // 拒绝执行
+)
+
+// Rule 一条规则：所有非空条件都满足时匹配
+type Rule struct {
+	Tool              string   `json:"tool,omitempty"`                // 工具名，支持 * 通配，为空匹配所有工具
+	Agent             string   `json:"agent,omitempty"`               // terminal 或 knowledge，为空匹配两者
+	Path              string   `json:"path,omitempty"`                // 路径 glob，** 匹配多级目录，相对路径相对于初始目录
+	OutsideInitialDir bool     `json:"outside_initial_dir,omitempty"` // 路径位于初始目录之外
+	Command           string   `json:"command,omitempty"`             // 终端命令的正则表达式
+	Decision          Decision `json:"decision"`
+	Reason            string   `json:"reason,omitempty"` // 需要确认或拒绝时向用户展示的说明
+
+	id      string
+	command *regexp.Regexp
+}
+
+// Policy 一组按顺序匹配的规则，第一条匹配的规则决定结果
+type Policy struct {
+	Rules   []Rule   `json:"rules"`
+	Default Decision `json:"default,omitempty"` // 没有规则匹配时的决定，默认 allow
+}
+
+// Call 待评估的工具调用
+type Call struct {
+	Agent      string
+	Tool       string
+	Path       string   // 调用涉及的路径（绝对路径），没有路径参数时为空；Evaluate 按解析符号链接后的路径匹配规则
+	Paths      []string // 调用涉及多个路径时（如 apply_changeset）的全部路径，按每个路径分别评估
+	Command    string   // 将在终端中执行的命令，非命令类工具为空
+	InitialDir string   // 会话的初始目录
+}
+
+// Result 评估结果
+type Result struct {
+	Decision Decision `json:"decision"`
+	Rule     string   `json:"rule,omitempty"` // 匹配的规则，格式为 <来源>#<序号>；没有规则匹配时为空
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// Parse 解析并校验规则文件，source 用于标识规则的来源
+func Parse(data []byte, source string) (*Policy, error) {
+	var p Policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%s: %v", source, err)
+	}
+	if err := p.Compile(source); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Compile 校验规则并编译正则表达式，直接构造的 Policy 在使用前需调用
+func (p *Policy) Compile(source string) error {
+	if !validDecision(p.Default) && p.Default != "" {
+		return fmt.Errorf("%s: default 无效: %q（可选 allow、confirm、deny）", source, p.Default)
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		r.id = fmt.Sprintf("%s#%d", source, i+1)
+		if !validDecision(r.Decision) {
+			return fmt.Errorf("%s: 第 %d 条规则的 decision 无效: %q（可选 allow、confirm、deny）", source, i+1, r.Decision)
+		}
+		if _, err := path.Match(r.Tool, ""); err != nil {
+			return fmt.Errorf("%s: 第 %d 条规则的 tool 无效: %v", source, i+1, err)
+		}
+		if _, err := pathutil.CompileGlob(filepath.ToSlash(r.Path)); err != nil {
+			return fmt.Errorf("%s: 第 %d 条规则的 path 无效: %v", source, i+1, err)
+		}
+		if r.Command != "" {
+			re, err := regexp.Compile(r.Command)
+			if err != nil {
+				return fmt.Errorf("%s: 第 %d 条规则的 command 无效: %v", source, i+1, err)
+			}
+			r.command = re
+		}
+	}
+	return nil
+}
+
+// severity 决定的严格程度，用于合并多个路径的评估结果
+func severity(d Decision) int {
+	switch d {
+	case Deny:
+		return 2
+	case Confirm:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func validDecision(d Decision) bool {
+	return d == Allow || d == Confirm || d == Deny
+}
+
+// match 返回第一条匹配的规则
+func (p *Policy) match(call Call) *Rule {
+	for i := range p.Rules {
+		if p.Rules[i].matches(call) {
+			return &p.Rules[i]
+		}
+	}
+	return nil
+}
+
+func (r *Rule) matches(call Call) bool {
+	if r.Agent != "" && r.Agent != call.Agent {
+		return false
+	}
+	if r.Tool != "" {
+		if ok, _ := path.Match(r.Tool, call.Tool); !ok {
+			return false
+		}
+	}
+	if r.Path != "" || r.OutsideInitialDir {
+		if call.Path == "" {
+			return false
+		}
+		if r.OutsideInitialDir && pathutil.Within(call.InitialDir, call.Path) {
+			return false
+		}
+		if r.Path != "" && !matchGlob(r.Path, call.InitialDir, call.Path) {
+			return false
+		}
+	}
+	if r.command != nil && (call.Command == "" || !r.command.MatchString(call.Command)) {
+		return false
+	}
+	return true
+}
+
+// matchGlob 判断路径是否匹配 glob，相对的 pattern 以 base 为起点（base 中的字符按字面匹配）
+// 语法与文件类工具相同，见 pathutil.CompileGlob；pattern 开头不含通配符的部分解析符号链接后再匹配，target 应为 resolvePath 的结果
+func matchGlob(pattern, base, target string) bool {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	n := 0
+	for n < len(segments) && !strings.ContainsAny(segments[n], `*?[\`) {
+		n++
+	}
+	literal := filepath.FromSlash(strings.Join(segments[:n], "/"))
+	if !filepath.IsAbs(literal) {
+		literal = filepath.Join(base, literal)
+	}
+	pattern = path.Join(pathutil.QuoteGlob(filepath.ToSlash(resolvePath(literal))), pathutil.Fold(strings.Join(segments[n:], "/")))
+	re, err := pathutil.CompileGlob(pattern)
+	return err == nil && re.MatchString(filepath.ToSlash(target))
+}
+
+// resolvePath 返回用于规则匹配的路径：解析符号链接并在不区分大小写的平台上转换为小写，无法解析时使用字面路径
+func resolvePath(p string) string {
+	if resolved, err := pathutil.Resolve(p); err == nil {
+		p = resolved
+	}
+	return pathutil.Fold(filepath.Clean(p))
+}
@@ -0,0 +1,269 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRuleMatches(t *testing.T) {
+	base := filepath.FromSlash("/work/project")
+	tests := []struct {
+		name string
+		rule Rule
+		call Call
+		want bool
+	}{
+		{"empty rule", Rule{}, Call{Tool: "read_file"}, true},
+		{"tool", Rule{Tool: "write_file"}, Call{Tool: "read_file"}, false},
+		{"tool wildcard", Rule{Tool: "job_*"}, Call{Tool: "job_kill"}, true},
+		{"agent", Rule{Agent: "knowledge"}, Call{Agent: "terminal", Tool: "grep"}, false},
+		{"relative glob", Rule{Path: "./tmp/**"}, Call{Path: filepath.Join(base, "tmp", "a", "b.txt"), InitialDir: base}, true},
+		{"glob matches dir itself", Rule{Path: "tmp/**"}, Call{Path: filepath.Join(base, "tmp"), InitialDir: base}, true},
+		{"glob star stays in dir", Rule{Path: "*.go"}, Call{Path: filepath.Join(base, "sub", "a.go"), InitialDir: base}, false},
+		{"double star any depth", Rule{Path: "**/*.go"}, Call{Path: filepath.Join(base, "sub", "a.go"), InitialDir: base}, true},
+		{"path rule needs path", Rule{Path: "**"}, Call{Tool: "run_background", InitialDir: base}, false},
+		{"outside initial dir", Rule{OutsideInitialDir: true}, Call{Path: filepath.FromSlash("/etc"), InitialDir: base}, true},
+		{"inside initial dir", Rule{OutsideInitialDir: true}, Call{Path: filepath.Join(base, "src"), InitialDir: base}, false},
+		{"sibling prefix is outside", Rule{OutsideInitialDir: true}, Call{Path: base + "2", InitialDir: base}, true},
+		{"command", Rule{Command: `rm\s+-rf`}, Call{Command: "rm  -rf /"}, true},
+		{"command needs command", Rule{Command: `.*`}, Call{Tool: "read_file"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Policy{Rules: []Rule{tt.rule}}
+			p.Rules[0].Decision = Allow
+			if err := p.Compile("test"); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Rules[0].matches(tt.call); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"valid", `{"rules": [{"tool": "grep", "decision": "deny"}], "default": "confirm"}`, false},
+		{"unknown field", `{"rules": [{"tool": "grep", "decison": "deny"}]}`, true},
+		{"invalid decision", `{"rules": [{"decision": "maybe"}]}`, true},
+		{"invalid default", `{"rules": [], "default": "yes"}`, true},
+		{"invalid command", `{"rules": [{"command": "(", "decision": "deny"}]}`, true},
+		{"invalid tool", `{"rules": [{"tool": "[", "decision": "deny"}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data), "test"); (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testEngine 创建使用临时目录的引擎：trusted 为数据目录中的规则文件，workspace 中的规则文件不可信
+func testEngine(t *testing.T, trusted, untrusted string) (*Engine, string) {
+	t.Helper()
+	dir := t.TempDir()
+	workspace := filepath.Join(dir, "workspace")
+	policyDir := filepath.Join(workspace, ".aihelper")
+	if err := os.MkdirAll(policyDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, data string) {
+		if data == "" {
+			return
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dir, "policy.json"), trusted)
+	write(filepath.Join(policyDir, "policy.json"), untrusted)
+
+	builtin := &Policy{Rules: []Rule{
+		{Tool: "write_file", Decision: Confirm},
+		{Tool: "run_background", Decision: Confirm},
+		{Tool: "secret", Decision: Deny},
+	}}
+	if err := builtin.Compile("builtin"); err != nil {
+		t.Fatal(err)
+	}
+	sources := func() []Source {
+		return []Source{{Path: filepath.Join(dir, "policy.json")}, {Path: filepath.Join(policyDir, "policy.json"), Untrusted: true}}
+	}
+	protected := func() []string {
+		return []string{filepath.Join(dir, "policy.json"), policyDir}
+	}
+	return NewEngine(builtin, sources, protected), workspace
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		trusted   string
+		untrusted string
+		call      Call
+		want      Decision
+		rule      string
+	}{
+		{"no rules", "", "", Call{Tool: "read_file"}, Allow, ""},
+		{"builtin", "", "", Call{Tool: "write_file"}, Confirm, "builtin#1"},
+		{
+			name:    "first match wins",
+			trusted: `{"rules": [{"tool": "read_file", "decision": "deny"}, {"tool": "read_file", "decision": "allow"}]}`,
+			call:    Call{Tool: "read_file"},
+			want:    Deny,
+			rule:    "policy.json#1",
+		},
+		{
+			name:      "trusted file takes precedence",
+			trusted:   `{"rules": [{"tool": "grep", "decision": "allow"}]}`,
+			untrusted: `{"rules": [{"tool": "grep", "decision": "deny"}]}`,
+			call:      Call{Tool: "grep"},
+			want:      Allow,
+			rule:      "policy.json#1",
+		},
+		{
+			name:    "trusted file can relax builtin",
+			trusted: `{"rules": [{"tool": "write_file", "decision": "allow"}]}`,
+			call:    Call{Tool: "write_file"},
+			want:    Allow,
+			rule:    "policy.json#1",
+		},
+		{
+			name:      "untrusted file cannot relax builtin confirm",
+			untrusted: `{"rules": [{"tool": "run_background", "decision": "allow"}]}`,
+			call:      Call{Tool: "run_background", Command: "echo hi"},
+			want:      Confirm,
+			rule:      "builtin#2",
+		},
+		{
+			name:      "untrusted file cannot relax builtin deny",
+			untrusted: `{"rules": [{"tool": "secret", "decision": "confirm"}]}`,
+			call:      Call{Tool: "secret"},
+			want:      Deny,
+			rule:      "builtin#3",
+		},
+		{
+			name:      "untrusted file can tighten",
+			untrusted: `{"rules": [{"tool": "write_file", "decision": "deny"}]}`,
+			call:      Call{Tool: "write_file"},
+			want:      Deny,
+			rule:      "policy.json#1",
+		},
+		{
+			name:      "untrusted default does not override builtin",
+			untrusted: `{"rules": [], "default": "allow"}`,
+			call:      Call{Tool: "write_file"},
+			want:      Confirm,
+			rule:      "builtin#1",
+		},
+		{"default", `{"rules": [], "default": "confirm"}`, "", Call{Tool: "read_file"}, Confirm, ""},
+		{"invalid policy denies all", `{"rules": [`, "", Call{Tool: "read_file"}, Deny, "invalid_policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := testEngine(t, tt.trusted, tt.untrusted)
+			got := e.Evaluate(tt.call)
+			// 规则文件的规则以文件路径标识来源，只比较文件名
+			rule := got.Rule
+			if rule != "" {
+				rule = filepath.Base(rule)
+			}
+			if got.Decision != tt.want || rule != tt.rule {
+				t.Errorf("Evaluate() = %s (%s), want %s (%s)", got.Decision, got.Rule, tt.want, tt.rule)
+			}
+		})
+	}
+}
+
+func TestEvaluateMultiplePaths(t *testing.T) {
+	e, workspace := testEngine(t, `{"rules": [{"path": "locked/**", "decision": "deny"}]}`, "")
+	call := Call{Tool: "apply_changeset", InitialDir: workspace, Paths: []string{filepath.Join(workspace, "a.txt"), filepath.Join(workspace, "locked", "b.txt")}}
+	if got := e.Evaluate(call); got.Decision != Deny {
+		t.Errorf("Evaluate() = %s, want deny", got.Decision)
+	}
+}
+
+func TestProtected(t *testing.T) {
+	e, workspace := testEngine(t, "", `{"rules": []}`)
+	policyDir := filepath.Join(workspace, ".aihelper")
+	if err := os.Symlink(policyDir, filepath.Join(workspace, "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(policyDir, "policy.json"), true},
+		{policyDir, true},
+		{filepath.Join(policyDir, "other.json"), true},
+		{filepath.Join(workspace, "sub", "..", ".aihelper", "policy.json"), true},
+		{filepath.Join(workspace, "link", "policy.json"), true},
+		{filepath.Join(workspace, "link"), true},
+		{filepath.Join(filepath.Dir(workspace), "policy.json"), true},
+		{workspace, false},
+		{filepath.Join(workspace, ".aihelper2"), false},
+		{filepath.Join(workspace, "src", "main.go"), false},
+	}
+	for _, tt := range tests {
+		if got := e.Protected(tt.path); got != tt.want {
+			t.Errorf("Protected(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+		if tt.want {
+			if got := e.Evaluate(Call{Tool: "read_file", Path: tt.path}); got.Decision != Deny || got.Rule != "protected" {
+				t.Errorf("Evaluate(read_file %q) = %s (%s), want deny (protected)", tt.path, got.Decision, got.Rule)
+			}
+		}
+	}
+}
+
+func TestEvaluateSymlinks(t *testing.T) {
+	e, workspace := testEngine(t, `{"rules": [
+		{"path": "secrets/**", "decision": "deny"},
+		{"path": "public/**", "decision": "allow"}
+	], "default": "confirm"}`, "")
+	outside := t.TempDir()
+	for _, dir := range []string{"secrets", "public"} {
+		if err := os.Mkdir(filepath.Join(workspace, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(workspace, "secrets", "key.txt"), []byte("key"), 0644)
+	os.WriteFile(filepath.Join(outside, "a.txt"), []byte("a"), 0644)
+	if err := os.Symlink(filepath.Join(workspace, "secrets"), filepath.Join(workspace, "public", "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	os.Symlink(outside, filepath.Join(workspace, "public", "out"))
+	os.Symlink(filepath.Join(workspace, "secrets", "key.txt"), filepath.Join(workspace, "public", "key.txt"))
+	os.Symlink(workspace, filepath.Join(outside, "ws"))
+
+	tests := []struct {
+		name       string
+		path       string
+		initialDir string
+		want       Decision
+	}{
+		{"denied directory", filepath.Join(workspace, "secrets", "key.txt"), workspace, Deny},
+		{"allowed directory", filepath.Join(workspace, "public", "a.txt"), workspace, Allow},
+		{"link to denied directory", filepath.Join(workspace, "public", "link", "key.txt"), workspace, Deny},
+		{"new file through link to denied directory", filepath.Join(workspace, "public", "link", "new.txt"), workspace, Deny},
+		{"link to denied file", filepath.Join(workspace, "public", "key.txt"), workspace, Deny},
+		{"link out of allowed directory", filepath.Join(workspace, "public", "out", "a.txt"), workspace, Confirm},
+		{"initial directory through link", filepath.Join(outside, "ws", "secrets", "key.txt"), filepath.Join(outside, "ws"), Deny},
+		{"relative rule with linked initial directory", filepath.Join(workspace, "public", "a.txt"), filepath.Join(outside, "ws"), Allow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := e.Evaluate(Call{Tool: "read_file", Path: tt.path, InitialDir: tt.initialDir})
+			if got.Decision != tt.want {
+				t.Errorf("Evaluate(%s) = %s (%s), want %s", tt.path, got.Decision, got.Rule, tt.want)
+			}
+		})
+	}
+}
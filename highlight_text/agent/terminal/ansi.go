@@ -0,0 +1,24 @@
+package terminal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiPattern 匹配ANSI转义序列：CSI（颜色、光标移动、清屏等）、OSC（窗口标题等）以及其余双字节序列
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// StripANSI 去除文本中的ANSI转义序列
+func StripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// renderLine 把PTY输出的一行还原为终端上最终显示的文本：
+// 去除转义序列，回车符（进度条刷新）之前被覆盖的内容只保留最后一段
+func renderLine(line string) string {
+	line = StripANSI(line)
+	if i := strings.LastIndex(line, "\r"); i >= 0 {
+		line = line[i+1:]
+	}
+	return line
+}
@@ -0,0 +1,261 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobKillGracePeriod 终止后台任务时，发出终止信号后等待其退出的时间，超过则强制结束
+const jobKillGracePeriod = 3 * time.Second
+
+// Job 在后台运行的命令（如开发服务器、watch 构建）
+// 命令在独立的进程中运行，不占用会话的 shell；工作目录和环境变量取自启动时会话的状态，受限模式下同样设置资源上限
+type Job struct {
+	ID      string
+	Command string
+	Cwd     string
+	Started time.Time
+
+	cmd    *exec.Cmd
+	output *outputBuffer
+	done   chan struct{}
+
+	mu       sync.Mutex
+	exitCode int
+	ended    time.Time
+	killed   bool
+	err      error
+}
+
+// JobStatus 后台任务的状态
+type JobStatus struct {
+	ID          string     `json:"id"`
+	Command     string     `json:"command"`
+	Cwd         string     `json:"cwd"`
+	Pid         int        `json:"pid"`
+	Running     bool       `json:"running"`
+	ExitCode    *int       `json:"exit_code,omitempty"` // 运行结束后的退出状态码，被信号终止时为 -1
+	Killed      bool       `json:"killed,omitempty"`    // 是否由 Kill 终止
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at,omitempty"`
+	OutputBytes int64      `json:"output_bytes"` // 累计输出的字节数
+}
+
+// JobOutput 读取到的一段后台任务输出（stdout 和 stderr 按产生顺序合并）
+type JobOutput struct {
+	Data       string `json:"data"`
+	Offset     int64  `json:"offset"`            // data 在全部输出中的起始偏移
+	NextOffset int64  `json:"next_offset"`       // 下次读取新输出时传入的偏移
+	Dropped    int64  `json:"dropped,omitempty"` // 请求的偏移之后已被缓冲区丢弃、无法再读取的字节数
+	Running    bool   `json:"running"`
+}
+
+// StartJob 在会话当前的工作目录和环境变量下启动后台任务，输出保留最近 bufferBytes 字节
+// 需要等待正在执行的命令结束以读取一致的会话状态，等待期间可被 ctx 打断
+func (s *shell) StartJob(ctx context.Context, id, command string, bufferBytes int) (*Job, error) {
+	select {
+	case s.slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: waiting for the previous command", contextError(ctx.Err()))
+	}
+	defer func() { <-s.slot }()
+
+	if s.isClosed() {
+		return nil, ErrSessionClosed
+	}
+
+	script := command
+	if s.sandbox != nil {
+		if limits := s.sandbox.ulimitCommand(); limits != "" {
+			script = limits + " || exit 126\n" + command
+		}
+	}
+	cmd := jobCommand(script)
+	cmd.Dir = s.GetCwd()
+	cmd.Env = s.commandEnv()
+
+	job := &Job{
+		ID:       id,
+		Command:  command,
+		Cwd:      cmd.Dir,
+		cmd:      cmd,
+		output:   &outputBuffer{limit: bufferBytes},
+		done:     make(chan struct{}),
+		exitCode: -1,
+	}
+	// stdout 和 stderr 使用同一个 Writer，exec 保证不会并发写入
+	cmd.Stdout = job.output
+	cmd.Stderr = job.output
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start job: %v", err)
+	}
+	job.Started = time.Now()
+
+	go job.wait()
+	return job, nil
+}
+
+func (j *Job) wait() {
+	err := j.cmd.Wait()
+	j.mu.Lock()
+	j.ended = time.Now()
+	j.exitCode = j.cmd.ProcessState.ExitCode()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		j.err = err
+	}
+	j.mu.Unlock()
+	close(j.done)
+}
+
+// Done 返回任务结束时关闭的 channel
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Running 返回任务是否仍在运行
+func (j *Job) Running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Status 返回任务的当前状态
+func (j *Job) Status() JobStatus {
+	status := JobStatus{
+		ID:          j.ID,
+		Command:     j.Command,
+		Cwd:         j.Cwd,
+		Pid:         j.cmd.Process.Pid,
+		Running:     j.Running(),
+		StartedAt:   j.Started,
+		OutputBytes: j.output.size(),
+	}
+	if !status.Running {
+		j.mu.Lock()
+		exitCode, ended := j.exitCode, j.ended
+		status.ExitCode = &exitCode
+		status.EndedAt = &ended
+		status.Killed = j.killed
+		if j.err != nil {
+			status.Error = j.err.Error()
+		}
+		j.mu.Unlock()
+	}
+	return status
+}
+
+// Output 从 offset 开始读取最多 maxBytes 字节的输出；offset 为负数时读取最后 maxBytes 字节
+func (j *Job) Output(offset int64, maxBytes int) JobOutput {
+	running := j.Running()
+	out := j.output.read(offset, maxBytes)
+	out.Running = running
+	return out
+}
+
+// Kill 终止任务及其子进程：先发送终止信号，等待片刻后仍未退出则强制结束；返回调用时任务是否在运行
+func (j *Job) Kill() bool {
+	if !j.Running() {
+		return false
+	}
+	j.mu.Lock()
+	j.killed = true
+	j.mu.Unlock()
+
+	signalJob(j.cmd, false)
+	select {
+	case <-j.done:
+	case <-time.After(jobKillGracePeriod):
+		signalJob(j.cmd, true)
+		<-j.done
+	}
+	return true
+}
+
+// outputBuffer 只保留最近 limit 字节的输出，按全部输出中的偏移读取
+type outputBuffer struct {
+	mu    sync.Mutex
+	data  []byte
+	start int64 // data[0] 在全部输出中的偏移
+	limit int
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	// 超过两倍上限时才整理，避免每次写入都复制
+	if len(b.data) > 2*b.limit {
+		drop := len(b.data) - b.limit
+		b.data = append([]byte(nil), b.data[drop:]...)
+		b.start += int64(drop)
+	}
+	return len(p), nil
+}
+
+// size 返回累计写入的字节数
+func (b *outputBuffer) size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.start + int64(len(b.data))
+}
+
+func (b *outputBuffer) read(offset int64, maxBytes int) JobOutput {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	end := b.start + int64(len(b.data))
+	first := end - int64(b.limit) // 仍可读取的最早偏移
+	if first < b.start {
+		first = b.start
+	}
+
+	var out JobOutput
+	switch {
+	case offset < 0:
+		offset = end - int64(maxBytes)
+		if maxBytes <= 0 || offset < first {
+			offset = first
+		}
+	case offset > end:
+		offset = end
+	case offset < first:
+		out.Dropped = first - offset
+		offset = first
+	}
+	stop := end
+	if maxBytes > 0 && offset+int64(maxBytes) < stop {
+		stop = offset + int64(maxBytes)
+	}
+	out.Data = string(b.data[offset-b.start : stop-b.start])
+	out.Offset = offset
+	out.NextOffset = stop
+	return out
+}
+
+// commandEnv 返回在 shell 之外启动的进程使用的环境变量：会话最近一次导出的变量；
+// 尚未得到导出变量时，受限模式下使用清理后的变量，否则继承服务进程的变量
+// 调用方需持有执行令牌
+func (s *shell) commandEnv() []string {
+	if s.env != nil {
+		env := make([]string, 0, len(s.env))
+		for name, value := range s.env {
+			env = append(env, name+"="+value)
+		}
+		sort.Strings(env)
+		return env
+	}
+	if s.sandbox != nil {
+		return s.sandbox.env()
+	}
+	return nil
+}
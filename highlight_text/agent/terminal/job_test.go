@@ -0,0 +1,58 @@
+package terminal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	b := &outputBuffer{limit: 10}
+	for _, chunk := range []string{"0123456789", "abcdefghij", "ABCDE"} {
+		b.Write([]byte(chunk))
+	}
+	// 共写入 25 字节，只保留最后 10 字节：偏移 15 起的 "fghijABCDE"
+	if got := b.size(); got != 25 {
+		t.Fatalf("size() = %d, want 25", got)
+	}
+
+	tests := []struct {
+		name     string
+		offset   int64
+		maxBytes int
+		want     JobOutput
+	}{
+		{"tail", -1, 4, JobOutput{Data: "BCDE", Offset: 21, NextOffset: 25}},
+		{"tail larger than buffer", -1, 100, JobOutput{Data: "fghijABCDE", Offset: 15, NextOffset: 25}},
+		{"tail without limit", -1, 0, JobOutput{Data: "fghijABCDE", Offset: 15, NextOffset: 25}},
+		{"from offset", 18, 0, JobOutput{Data: "ijABCDE", Offset: 18, NextOffset: 25}},
+		{"from offset with limit", 18, 3, JobOutput{Data: "ijA", Offset: 18, NextOffset: 21}},
+		{"dropped", 5, 3, JobOutput{Data: "fgh", Offset: 15, NextOffset: 18, Dropped: 10}},
+		{"at end", 25, 10, JobOutput{Data: "", Offset: 25, NextOffset: 25}},
+		{"past end", 40, 10, JobOutput{Data: "", Offset: 25, NextOffset: 25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.read(tt.offset, tt.maxBytes); got != tt.want {
+				t.Errorf("read(%d, %d) = %+v, want %+v", tt.offset, tt.maxBytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputBufferCompaction(t *testing.T) {
+	b := &outputBuffer{limit: 4}
+	var all strings.Builder
+	for i := 0; i < 100; i++ {
+		chunk := string(rune('a' + i%26))
+		all.WriteString(chunk)
+		b.Write([]byte(chunk))
+		if len(b.data) > 2*b.limit {
+			t.Fatalf("after %d writes buffer holds %d bytes, limit %d", i+1, len(b.data), b.limit)
+		}
+	}
+	// 整理前缓冲区中可能多于 limit 字节，但只能读到最后 limit 字节
+	want := all.String()[all.Len()-4:]
+	if got := b.read(0, 0); got.Data != want || got.Dropped != 96 {
+		t.Errorf("read(0, 0) = %+v, want data %q and 96 dropped", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+package terminal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// commandMarker 命令结束分隔符的前缀，stdout 中为 "<marker> <命令序号> <退出状态码> <工作目录>"，stderr 中为 "<marker> <命令序号>"
+// 序号用于识别终止命令后补写的重复分隔符
+const commandMarker = "___COMMAND_END___"
+
+// envMarker 环境变量块起始行的前缀，该行为 "<marker> <命令序号>"，之后是 export -p 的输出，直到命令结束分隔符行
+// 仅在导出的环境变量发生变化时输出
+const envMarker = "___COMMAND_ENV___"
+
+// markers 一个 shell 会话使用的分隔符：前缀之后加上创建会话时生成的随机数，
+// 命令的输出不知道随机数，无法伪造分隔符提前结束命令或篡改退出状态码和工作目录
+// （从 stdin 读走之后写入的状态信息的命令除外，这类命令本身就会破坏分隔符的输出）
+type markers struct {
+	command string // 命令结束分隔符
+	env     string // 环境变量块的起始分隔符
+}
+
+// newMarkers 生成新会话的分隔符
+func newMarkers() markers {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	nonce := hex.EncodeToString(buf)
+	return markers{command: commandMarker + nonce, env: envMarker + nonce}
+}
+
+// splitMarker 将分隔符拆成两段，由 shell 拼接后输出，使写入 stdin 的文本本身不包含分隔符
+func splitMarker(marker string) (head, tail string) {
+	half := len(marker) / 2
+	return marker[:half], marker[half:]
+}
+
+// parseMarker 在一行中查找分隔符，返回分隔符之前的内容、命令序号和序号之后的剩余内容
+func parseMarker(line, marker string) (before string, id int, rest string, ok bool) {
+	idx := strings.Index(line, marker)
+	if idx < 0 {
+		return line, 0, "", false
+	}
+	after := strings.TrimLeft(line[idx+len(marker):], " ")
+	idText, rest, _ := strings.Cut(after, " ")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return line, 0, "", false
+	}
+	return line[:idx], id, rest, true
+}
+
+// readUntilMarker 读取 stdout 直到序号为 id 的分隔符行，返回之前的输出和命令结束后的状态
+// render 用于在保存前处理每一行（如去除ANSI序列），onLine 在每读到一行输出时调用，二者均可为nil
+func readUntilMarker(reader *bufio.Reader, m markers, id int, render func(string) string, onLine func(string)) (string, *trailer, error) {
+	var output strings.Builder
+	var env map[string]string
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+
+		// 环境变量块：被终止的命令残留的块同样需要读取，shell 只在变化时输出，丢弃会导致之后的比较出错
+		// 块之前的内容（命令输出末尾没有换行的部分）与块之后的分隔符行拼接，按分隔符与输出位于同一行处理
+		if before, _, _, found := parseMarker(line, m.env); found && err == nil {
+			var markerLine string
+			var envErr error
+			if env, markerLine, envErr = readExportList(reader, m.command); envErr != nil {
+				return strings.TrimSpace(output.String()), nil, readError(envErr)
+			}
+			line = before + markerLine
+		}
+
+		// 命令输出末尾没有换行时，分隔符会与最后一段输出位于同一行
+		before, markerID, rest, found := parseMarker(line, m.command)
+		if found && markerID != id {
+			// 上一条被终止的命令残留的重复分隔符，之前的内容也不属于当前命令
+			output.Reset()
+			if err != nil {
+				return "", nil, readError(err)
+			}
+			continue
+		}
+		if render != nil {
+			before = render(before)
+		}
+		if before != "" || (!found && err == nil) {
+			output.WriteString(before)
+			output.WriteString("\n")
+			if onLine != nil {
+				onLine(before + "\n")
+			}
+		}
+
+		if found {
+			t := parseTrailer(rest)
+			t.env = env
+			return strings.TrimSpace(output.String()), t, nil
+		}
+		if err != nil {
+			return strings.TrimSpace(output.String()), nil, readError(err)
+		}
+	}
+}
+
+// readError 统一 shell 退出后的读取错误（PTY从设备全部关闭后读取主设备返回 EIO）
+func readError(err error) error {
+	if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EIO) {
+		return io.EOF
+	}
+	return err
+}
+
+// stderrCollector 在后台持续读取 stderr，避免输出较多时管道写满导致 shell 阻塞
+// 每条命令的 stderr 以单独的分隔符行结束
+type stderrCollector struct {
+	marker string // 命令结束分隔符
+	mu     sync.Mutex
+	cond   *sync.Cond
+	lines  []string
+	err    error        // 读取结束的原因（shell 已退出）
+	onLine func(string) // 读到一行输出时调用（不含分隔符），可为nil
+}
+
+// newStderrCollector 创建收集器并开始读取，marker 为会话的命令结束分隔符
+func newStderrCollector(r io.Reader, marker string) *stderrCollector {
+	c := &stderrCollector{marker: marker}
+	c.cond = sync.NewCond(&c.mu)
+	go c.loop(bufio.NewReader(r))
+	return c
+}
+
+func (c *stderrCollector) loop(reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		trimmed := strings.TrimRight(line, "\r\n")
+
+		// 先回调再放入缓冲区，保证 collect 返回时分隔符之前的输出都已回调完毕
+		c.mu.Lock()
+		onLine := c.onLine
+		c.mu.Unlock()
+		if onLine != nil && line != "" {
+			if before, _, _, found := parseMarker(trimmed, c.marker); before != "" {
+				onLine(before + "\n")
+			} else if !found {
+				onLine("\n")
+			}
+		}
+
+		c.mu.Lock()
+		if line != "" {
+			c.lines = append(c.lines, trimmed)
+		}
+		if err != nil {
+			c.err = readError(err)
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// watch 设置逐行回调，传入nil取消
+func (c *stderrCollector) watch(onLine func(string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onLine = onLine
+}
+
+// collect 等待序号为 id 的分隔符行出现，返回其之前的内容并从缓冲区移除
+func (c *stderrCollector) collect(id int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		for i := 0; i < len(c.lines); i++ {
+			before, markerID, _, found := parseMarker(c.lines[i], c.marker)
+			if !found {
+				continue
+			}
+			if markerID != id {
+				// 残留的重复分隔符：丢弃它及之前的内容
+				c.lines = c.lines[i+1:]
+				i = -1
+				continue
+			}
+			collected := append(c.lines[:i:i], before)
+			c.lines = c.lines[i+1:]
+			return strings.TrimSpace(strings.Join(collected, "\n")), nil
+		}
+		if c.err != nil {
+			return strings.TrimSpace(strings.Join(c.lines, "\n")), c.err
+		}
+		c.cond.Wait()
+	}
+}
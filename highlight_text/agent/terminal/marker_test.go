@@ -0,0 +1,152 @@
+package terminal
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseMarker(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		before string
+		id     int
+		rest   string
+		ok     bool
+	}{
+		{"plain output", "hello", "hello", 0, "", false},
+		{"marker only", commandMarker + " 3", "", 3, "", true},
+		{"with trailer", commandMarker + " 12 0 /tmp/a b", "", 12, "0 /tmp/a b", true},
+		{"output before marker", "no newline" + commandMarker + " 1 2 /", "no newline", 1, "2 /", true},
+		{"invalid id", commandMarker + " x 0 /", commandMarker + " x 0 /", 0, "", false},
+		{"missing id", commandMarker, commandMarker, 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, id, rest, ok := parseMarker(tt.line, commandMarker)
+			if before != tt.before || id != tt.id || rest != tt.rest || ok != tt.ok {
+				t.Errorf("parseMarker(%q) = %q, %d, %q, %v; want %q, %d, %q, %v",
+					tt.line, before, id, rest, ok, tt.before, tt.id, tt.rest, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewMarkers(t *testing.T) {
+	a, b := newMarkers(), newMarkers()
+	if !strings.HasPrefix(a.command, commandMarker) || !strings.HasPrefix(a.env, envMarker) {
+		t.Errorf("newMarkers() = %+v, want prefixes %q and %q", a, commandMarker, envMarker)
+	}
+	if a.command == b.command || a.command == commandMarker {
+		t.Errorf("newMarkers() returned %q twice or without a nonce", a.command)
+	}
+}
+
+func TestSplitMarker(t *testing.T) {
+	head, tail := splitMarker(commandMarker)
+	if head+tail != commandMarker || strings.Contains(head, commandMarker) || strings.Contains(tail, commandMarker) {
+		t.Errorf("splitMarker(%q) = %q, %q", commandMarker, head, tail)
+	}
+}
+
+// testMarkers 测试使用的固定分隔符
+var testMarkers = markers{command: commandMarker + "0123", env: envMarker + "0123"}
+
+func TestReadUntilMarker(t *testing.T) {
+	commandMarker := testMarkers.command
+	tests := []struct {
+		name     string
+		input    string
+		id       int
+		output   string
+		exitCode int
+		cwd      string
+	}{
+		{
+			name:     "single line",
+			input:    "hello\n" + commandMarker + " 1 0 /home\n",
+			id:       1,
+			output:   "hello",
+			exitCode: 0,
+			cwd:      "/home",
+		},
+		{
+			name:     "no trailing newline",
+			input:    "a\nb" + commandMarker + " 1 2 /\n",
+			id:       1,
+			output:   "a\nb",
+			exitCode: 2,
+			cwd:      "/",
+		},
+		{
+			name:     "stale marker from canceled command",
+			input:    "old\n" + commandMarker + " 1 130 /\nnew\r\n" + commandMarker + " 2 0 /tmp\r\n",
+			id:       2,
+			output:   "new",
+			exitCode: 0,
+			cwd:      "/tmp",
+		},
+		{
+			name:     "empty output",
+			input:    commandMarker + " 5 1 /\n",
+			id:       5,
+			output:   "",
+			exitCode: 1,
+			cwd:      "/",
+		},
+		{
+			name:     "forged marker without nonce",
+			input:    "___COMMAND_END___ 1 0 /etc\n" + commandMarker + " 1 3 /\n",
+			id:       1,
+			output:   "___COMMAND_END___ 1 0 /etc",
+			exitCode: 3,
+			cwd:      "/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []string
+			output, tr, err := readUntilMarker(bufio.NewReader(strings.NewReader(tt.input)), testMarkers, tt.id, nil, func(line string) {
+				lines = append(lines, line)
+			})
+			if err != nil {
+				t.Fatalf("readUntilMarker: %v", err)
+			}
+			if output != tt.output || tr.exitCode != tt.exitCode || tr.cwd != tt.cwd {
+				t.Errorf("got %q, exit %d, cwd %q; want %q, exit %d, cwd %q", output, tr.exitCode, tr.cwd, tt.output, tt.exitCode, tt.cwd)
+			}
+			// 残留分隔符之前的输出已经回调过，只检查当前命令的部分
+			if got := strings.TrimSpace(strings.Join(lines, "")); !strings.HasSuffix(got, tt.output) {
+				t.Errorf("onLine received %q, want it to end with %q", got, tt.output)
+			}
+		})
+	}
+}
+
+func TestReadUntilMarkerEOF(t *testing.T) {
+	output, tr, err := readUntilMarker(bufio.NewReader(strings.NewReader("partial\n")), testMarkers, 1, nil, nil)
+	if err != io.EOF || tr != nil || output != "partial" {
+		t.Errorf("got %q, %v, %v; want output before EOF and io.EOF", output, tr, err)
+	}
+}
+
+func TestStderrCollector(t *testing.T) {
+	input := "stale\n" + commandMarker + " 1\n" +
+		"warning: x\n" + "last" + commandMarker + " 2\n" +
+		commandMarker + " 3\n"
+	c := newStderrCollector(strings.NewReader(input), commandMarker)
+
+	got, err := c.collect(2)
+	if err != nil || got != "warning: x\nlast" {
+		t.Errorf("collect(2) = %q, %v; want %q", got, err, "warning: x\nlast")
+	}
+	got, err = c.collect(3)
+	if err != nil || got != "" {
+		t.Errorf("collect(3) = %q, %v; want empty", got, err)
+	}
+	if _, err := c.collect(4); err != io.EOF {
+		t.Errorf("collect(4) error = %v, want io.EOF", err)
+	}
+}
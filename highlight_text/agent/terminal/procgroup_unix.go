@@ -0,0 +1,89 @@
+//go:build darwin || linux
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// bashInit shell 启动后执行的初始化命令
+// set -m 开启作业控制，使每条命令在独立的进程组中运行，终止命令时可以连同其子进程一起结束
+const bashInit = "set -m"
+
+// wrapBashCommand 命令单独成行，之后输出状态信息：导出的环境变量（仅在变化时）以及带退出状态码和工作目录的分隔符；
+// stderr 中也写入分隔符以划分每条命令的错误输出
+// 分隔符拆成两段由 printf 拼接，读取 stdin 的命令（如 cat）回显这段文本时不会被误认为分隔符
+func wrapBashCommand(command string, m markers, id int) string {
+	head, tail := splitMarker(m.command)
+	envHead, envTail := splitMarker(m.env)
+	return fmt.Sprintf("%s\n"+
+		"__aihelper_status=$?; __aihelper_env=$(export -p); "+
+		"if [ \"$__aihelper_env\" != \"${__aihelper_last_env-}\" ]; then "+
+		"__aihelper_last_env=$__aihelper_env; printf '%%s%%s %d\\n%%s\\n' %s %s \"$__aihelper_env\"; fi; "+
+		"printf '%%s%%s %d %%s %%s\\n' %s %s \"$__aihelper_status\" \"$PWD\"; printf '%%s%%s %d\\n' %s %s >&2\n",
+		command, id, envHead, envTail, id, head, tail, id, head, tail)
+}
+
+// killedByCPULimit 判断进程是否因超过CPU时间上限（SIGXCPU）而结束
+func killedByCPULimit(state *os.ProcessState) bool {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGXCPU
+}
+
+// killJobs 强制结束 shell 的所有子进程组，shell 本身保持运行
+func killJobs(shellPid int) error {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,pgid=").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list processes: %v", err)
+	}
+
+	killed := make(map[int]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		ppid, _ := strconv.Atoi(fields[1])
+		pgid, _ := strconv.Atoi(fields[2])
+		if ppid != shellPid || pid == 0 {
+			continue
+		}
+		if pgid == shellPid || pgid <= 1 {
+			// 与 shell 同组的子进程只能单独结束
+			syscall.Kill(pid, syscall.SIGKILL)
+			continue
+		}
+		if !killed[pgid] {
+			syscall.Kill(-pgid, syscall.SIGKILL)
+			killed[pgid] = true
+		}
+	}
+	return nil
+}
+
+// jobCommand 后台任务在独立的进程组中运行，终止时可以连同其子进程一起结束
+func jobCommand(script string) *exec.Cmd {
+	cmd := exec.Command("bash", "-c", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// ChdirCommand 返回将 shell 切换到 dir 的命令，路径经过引用，不会被 shell 展开
+func ChdirCommand(dir string) (string, error) {
+	return "cd -- " + shellQuote(dir), nil
+}
+
+// signalJob 向进程组发送 SIGTERM，force 时发送 SIGKILL
+func signalJob(cmd *exec.Cmd, force bool) {
+	sig := syscall.SIGTERM
+	if force {
+		sig = syscall.SIGKILL
+	}
+	syscall.Kill(-cmd.Process.Pid, sig)
+}
@@ -0,0 +1,274 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"highlight_text/agent/pathutil"
+)
+
+// Sandbox 受限模式的设置（目前仅 Linux 支持）
+// 资源上限通过 bash 的 ulimit 设置，作用于 shell 及其启动的每个进程；
+// shell 命令的工作目录只能在命令结束后检查，离开根目录时切换回去，命令执行期间仍可访问根目录之外的路径
+type Sandbox struct {
+	Root         string   // 工作目录必须位于该目录之下，shell 也在此目录启动；为空时使用服务进程的工作目录
+	CPUSeconds   int      // 每个进程的CPU时间上限（RLIMIT_CPU），0 表示不限制
+	MemoryBytes  int64    // 每个进程的虚拟内存上限（RLIMIT_AS），0 表示不限制
+	OutputBytes  int64    // 单条命令 stdout 与 stderr 的总字节数上限，同时限制写入的单个文件大小（RLIMIT_FSIZE）
+	MaxProcesses int      // 进程数上限（RLIMIT_NPROC，按用户统计），0 表示不限制
+	EnvAllow     []string // 从服务进程继承的环境变量名，其余全部清除
+}
+
+// 违反限制的类型
+const (
+	ViolationCPU       = "cpu"
+	ViolationMemory    = "memory"
+	ViolationOutput    = "output"
+	ViolationFileSize  = "file_size"
+	ViolationProcesses = "processes"
+	ViolationCwd       = "cwd"
+)
+
+// ErrSandboxViolation 命令违反了受限模式的限制，具体原因见 SandboxError
+var ErrSandboxViolation = errors.New("sandbox violation")
+
+// Violation 一项违反的限制
+type Violation struct {
+	Kind     string `json:"kind"`
+	Limit    string `json:"limit,omitempty"`
+	Message  string `json:"message"`
+	Inferred bool   `json:"inferred,omitempty"` // 根据错误输出推断，命令可以伪造这些输出，不作为错误返回
+}
+
+// SandboxError 命令违反受限模式限制时返回的错误，errors.Is(err, ErrSandboxViolation) 成立
+type SandboxError struct {
+	Violations []Violation
+}
+
+func (e *SandboxError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return fmt.Sprintf("%v: %s", ErrSandboxViolation, strings.Join(messages, "; "))
+}
+
+func (e *SandboxError) Is(target error) bool {
+	return target == ErrSandboxViolation
+}
+
+// 受限模式下默认保留的环境变量
+var defaultSandboxEnv = []string{"PATH", "LANG", "LC_ALL", "LC_CTYPE", "TZ", "USER", "LOGNAME"}
+
+// 被信号终止时的退出状态码（128+信号值）
+const (
+	exitSIGXCPU = 128 + 24
+	exitSIGXFSZ = 128 + 25
+)
+
+// sandboxState 会话的受限模式状态
+type sandboxState struct {
+	Sandbox
+	resolvedRoot string // 解析符号链接后的根目录
+}
+
+// newSandboxState 校验根目录并补全默认值
+func newSandboxState(sb *Sandbox) (*sandboxState, error) {
+	state := &sandboxState{Sandbox: *sb}
+	if state.Root == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		state.Root = wd
+	}
+	root, err := filepath.Abs(state.Root)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("sandbox root is not a directory: %s", root)
+	}
+	state.Root = root
+	if state.resolvedRoot, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// env 返回 shell 使用的环境变量：仅保留允许的变量，HOME 指向根目录
+func (sb *sandboxState) env() []string {
+	allow := sb.EnvAllow
+	if len(allow) == 0 {
+		allow = defaultSandboxEnv
+	}
+	env := []string{"HOME=" + sb.Root}
+	for _, name := range allow {
+		if value, ok := os.LookupEnv(name); ok && name != "HOME" {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// ulimitCommand 返回设置资源上限的 shell 命令，没有需要设置的上限时返回空字符串
+func (sb *sandboxState) ulimitCommand() string {
+	var cmds []string
+	if sb.CPUSeconds > 0 {
+		// 软上限触发 SIGXCPU 便于识别，硬上限多留一秒作为兜底
+		cmds = append(cmds, fmt.Sprintf("ulimit -t %d && ulimit -St %d", sb.CPUSeconds+1, sb.CPUSeconds))
+	}
+	if sb.MemoryBytes > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -v %d", (sb.MemoryBytes+1023)/1024))
+	}
+	if sb.OutputBytes > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -f %d", (sb.OutputBytes+1023)/1024))
+	}
+	if sb.MaxProcesses > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -u %d", sb.MaxProcesses))
+	}
+	return strings.Join(cmds, " && ")
+}
+
+// sandboxInit 在 shell 的初始化命令之后追加设置资源上限的命令
+func sandboxInit(init string, sb *sandboxState) string {
+	if sb == nil {
+		return init
+	}
+	if limits := sb.ulimitCommand(); limits != "" {
+		return init + " && " + limits
+	}
+	return init
+}
+
+// outputCounter 返回统计输出字节数的函数，超过上限时调用 exceeded（仅一次）
+func (sb *sandboxState) outputCounter(exceeded func(error)) func(string) {
+	if sb.OutputBytes <= 0 {
+		return nil
+	}
+	var total atomic.Int64
+	var once atomic.Bool
+	return func(data string) {
+		if total.Add(int64(len(data))) > sb.OutputBytes && once.CompareAndSwap(false, true) {
+			exceeded(&SandboxError{Violations: []Violation{{
+				Kind:    ViolationOutput,
+				Limit:   fmt.Sprint(sb.OutputBytes),
+				Message: fmt.Sprintf("output exceeded %d bytes, command terminated", sb.OutputBytes),
+			}}})
+		}
+	}
+}
+
+// inspect 根据退出状态码和错误输出判断命令是否因资源上限失败，返回确定的违规项和推断的违规项
+// 内存和进程数上限不会产生特定的信号，只能从常见的错误信息推断；这些信息可以由命令自行输出，因此只作为提示
+func (sb *sandboxState) inspect(result *Result) (violations, inferred []Violation) {
+	switch {
+	case result.ExitCode == exitSIGXCPU && sb.CPUSeconds > 0:
+		violations = append(violations, sb.cpuViolation())
+	case result.ExitCode == exitSIGXFSZ && sb.OutputBytes > 0:
+		violations = append(violations, Violation{
+			Kind:    ViolationFileSize,
+			Limit:   fmt.Sprint(sb.OutputBytes),
+			Message: fmt.Sprintf("file size limit of %d bytes exceeded", sb.OutputBytes),
+		})
+	}
+
+	stderr := strings.ToLower(result.Stderr)
+	if sb.MemoryBytes > 0 && result.ExitCode != 0 && (strings.Contains(stderr, "cannot allocate memory") ||
+		strings.Contains(stderr, "out of memory") || strings.Contains(stderr, "memoryerror")) {
+		inferred = append(inferred, Violation{
+			Kind:     ViolationMemory,
+			Limit:    fmt.Sprint(sb.MemoryBytes),
+			Message:  fmt.Sprintf("memory limit of %d bytes likely exceeded", sb.MemoryBytes),
+			Inferred: true,
+		})
+	}
+	if sb.MaxProcesses > 0 && strings.Contains(stderr, "fork") && strings.Contains(stderr, "resource temporarily unavailable") {
+		inferred = append(inferred, Violation{
+			Kind:     ViolationProcesses,
+			Limit:    fmt.Sprint(sb.MaxProcesses),
+			Message:  fmt.Sprintf("process limit of %d likely reached", sb.MaxProcesses),
+			Inferred: true,
+		})
+	}
+	return violations, inferred
+}
+
+func (sb *sandboxState) cpuViolation() Violation {
+	return Violation{
+		Kind:    ViolationCPU,
+		Limit:   fmt.Sprintf("%ds", sb.CPUSeconds),
+		Message: fmt.Sprintf("CPU time limit of %d seconds exceeded", sb.CPUSeconds),
+	}
+}
+
+// contains 判断路径是否位于根目录之下（按解析符号链接后的真实路径比较）
+func (sb *sandboxState) contains(path string) bool {
+	resolved, err := pathutil.Resolve(path)
+	return err == nil && pathutil.Within(sb.resolvedRoot, resolved)
+}
+
+// Allows 判断受限模式下工具能否访问该路径（位于根目录之下），未启用受限模式时总是返回 true
+func (s *shell) Allows(path string) bool {
+	return s.sandbox == nil || s.sandbox.contains(path)
+}
+
+// enforceSandbox 检查命令结果是否违反限制；工作目录离开根目录时切换回命令执行前的目录
+// 调用方需持有执行令牌
+func (s *shell) enforceSandbox(result *Result, err error, prevCwd string) error {
+	if errors.Is(err, ErrSessionClosed) {
+		// 内建命令（如 while 循环）在 shell 进程中执行，超过CPU上限时 shell 本身会被终止
+		if s.sandbox.CPUSeconds > 0 && s.cmd.ProcessState != nil && killedByCPULimit(s.cmd.ProcessState) {
+			return fmt.Errorf("%w: %w", err, &SandboxError{Violations: []Violation{s.sandbox.cpuViolation()}})
+		}
+		return err
+	}
+	if result == nil {
+		return err
+	}
+
+	violations, inferred := s.sandbox.inspect(result)
+	result.Violations = inferred
+	if cwd := s.GetCwd(); cwd != "" && !s.sandbox.contains(cwd) {
+		if prevCwd == "" || !s.sandbox.contains(prevCwd) {
+			prevCwd = s.sandbox.Root
+		}
+		// 原命令的 ctx 可能已经结束，切换目录使用单独的超时
+		ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+		defer cancel()
+		if _, cdErr := s.run(ctx, "cd -- "+shellQuote(prevCwd), nil); cdErr != nil {
+			s.Close()
+			return fmt.Errorf("failed to restore working directory: %v: %w", cdErr, ErrSessionClosed)
+		}
+		result.Cwd = s.GetCwd()
+		violations = append(violations, Violation{
+			Kind:    ViolationCwd,
+			Limit:   s.sandbox.Root,
+			Message: fmt.Sprintf("working directory %s is outside %s, restored to %s", cwd, s.sandbox.Root, result.Cwd),
+		})
+	}
+
+	if len(violations) == 0 {
+		return err
+	}
+	var sbErr *SandboxError
+	if errors.As(err, &sbErr) {
+		sbErr.Violations = append(sbErr.Violations, violations...)
+		return err
+	}
+	if err != nil {
+		// 超时等错误与违反限制同时出现时，以超时等错误为准，违反的限制附在后面
+		return fmt.Errorf("%w: %w", err, &SandboxError{Violations: violations})
+	}
+	return &SandboxError{Violations: violations}
+}
+
+// shellQuote 用单引号引用字符串，供 bash 使用
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
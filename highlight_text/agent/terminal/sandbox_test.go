@@ -0,0 +1,47 @@
+//go:build darwin || linux
+
+package terminal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSandboxContains(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(os.MkdirAll(filepath.Join(root, "sub"), 0755))
+	must(os.WriteFile(filepath.Join(root, "sub", "a.txt"), nil, 0644))
+	must(os.Symlink(outside, filepath.Join(root, "out")))
+	must(os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "in")))
+	must(os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling")))
+
+	sb, err := newSandboxState(&Sandbox{Root: root})
+	must(err)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{root, true},
+		{filepath.Join(root, "sub", "a.txt"), true},
+		{filepath.Join(root, "sub", "new", "b.txt"), true},
+		{filepath.Join(root, "in", "a.txt"), true},
+		{filepath.Join(root, "out"), false},
+		{filepath.Join(root, "out", "new.txt"), false},
+		{filepath.Join(root, "dangling"), false},
+		{filepath.Join(root, "..", filepath.Base(outside)), false},
+		{outside, false},
+	}
+	for _, tt := range tests {
+		if got := sb.contains(tt.path); got != tt.want {
+			t.Errorf("contains(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// cancelGracePeriod 终止命令后等待 shell 输出分隔符的时间，超过则认为 shell 无法恢复并关闭会话
+const cancelGracePeriod = 3 * time.Second
+
+// shell 通过标准输入驱动一个常驻的 shell 进程，逐条执行命令并按分隔符切分输出
+// 管道模式、PTY模式和 Windows 终端共用这部分逻辑，差异由创建时提供的函数决定
+type shell struct {
+	cmd     *exec.Cmd
+	stdin   io.Writer
+	stdout  *bufio.Reader // 跨命令复用，避免丢失已读入缓冲区的输出
+	stderr  *stderrCollector
+	closers []io.Closer // 关闭时需要释放的文件（stdin、PTY主设备等）
+
+	markers   markers                                        // 分隔符，与 stderr 收集器使用的一致
+	render    func(string) string                            // 逐行处理 stdout，可为nil
+	wrap      func(command string, m markers, id int) string // 生成写入 stdin 的完整文本（命令及输出状态信息的结尾部分）
+	interrupt func(pid int) error                            // 终止 shell 正在运行的命令（不结束 shell 本身），为nil时只能关闭整个会话
+	sandbox   *sandboxState                                  // 受限模式，为nil时不限制
+
+	slot chan struct{}     // 执行令牌：同一时间只执行一条命令，等待时可被 ctx 打断
+	seq  int               // 命令序号，仅在持有令牌时访问
+	env  map[string]string // 最近一次输出的导出环境变量，仅在持有令牌时访问
+
+	mu     sync.Mutex // 保护以下字段，命令执行期间不会长时间持有
+	cwd    string
+	cancel context.CancelCauseFunc // 正在执行的命令的取消函数
+	closed bool
+}
+
+// start 初始化 shell：执行 init 命令（可为空），由其结尾的状态信息得到初始工作目录和环境变量
+func (s *shell) start(init string) error {
+	s.slot = make(chan struct{}, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	result, err := s.Execute(ctx, init)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to initialize shell: %s", result.Stderr)
+	}
+	return nil
+}
+
+// Execute 执行命令并返回结构化结果
+func (s *shell) Execute(ctx context.Context, command string) (*Result, error) {
+	return s.Stream(ctx, command, nil)
+}
+
+// Stream 执行命令，输出产生时逐行回调 sink，结束后返回完整结果
+func (s *shell) Stream(ctx context.Context, command string, sink func(Chunk)) (*Result, error) {
+	// 等待上一条命令结束
+	select {
+	case s.slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: waiting for the previous command", contextError(ctx.Err()))
+	}
+	defer func() { <-s.slot }()
+
+	if s.isClosed() {
+		return nil, ErrSessionClosed
+	}
+
+	if s.sandbox == nil {
+		return s.run(ctx, command, sink)
+	}
+	prevCwd := s.GetCwd()
+	result, err := s.run(ctx, command, sink)
+	return result, s.enforceSandbox(result, err, prevCwd)
+}
+
+// run 写入命令并读取 stdout、stderr 直到分隔符，调用方需持有执行令牌
+func (s *shell) run(ctx context.Context, command string, sink func(Chunk)) (*Result, error) {
+	s.seq++
+	id := s.seq
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+	}()
+
+	// 受限模式下统计输出字节数，超过上限时按取消处理
+	var count func(string)
+	if s.sandbox != nil {
+		count = s.sandbox.outputCounter(cancel)
+	}
+
+	var onStdout func(string)
+	if sink != nil || count != nil {
+		// stdout 和 stderr 在不同的协程中读取，串行化回调
+		var sinkMu sync.Mutex
+		emit := func(stream, data string) {
+			sinkMu.Lock()
+			defer sinkMu.Unlock()
+			if count != nil {
+				count(data)
+			}
+			if sink != nil {
+				sink(Chunk{Stream: stream, Data: data})
+			}
+		}
+		onStdout = func(line string) { emit(StreamStdout, line) }
+		s.stderr.watch(func(line string) {
+			if s.render != nil {
+				line = StripANSI(line)
+			}
+			emit(StreamStderr, line)
+		})
+		defer s.stderr.watch(nil)
+	}
+
+	start := time.Now()
+	if _, err := io.WriteString(s.stdin, s.wrap(command, s.markers, id)); err != nil {
+		return nil, fmt.Errorf("failed to write command: %v", err)
+	}
+
+	done := make(chan *Result, 1)
+	var readErr error
+	go func() {
+		result := &Result{ExitCode: -1}
+		var t *trailer
+		result.Stdout, t, readErr = readUntilMarker(s.stdout, s.markers, id, s.render, onStdout)
+		if readErr != nil {
+			readErr = fmt.Errorf("failed to read output: %v", readErr)
+		} else if result.Stderr, readErr = s.stderr.collect(id); readErr != nil {
+			readErr = fmt.Errorf("failed to read stderr: %v", readErr)
+		}
+		if s.render != nil {
+			result.Stderr = StripANSI(result.Stderr)
+		}
+		if t != nil {
+			s.applyTrailer(result, t)
+		}
+		result.Cwd = s.GetCwd()
+		result.Duration = time.Since(start)
+		done <- result
+	}()
+
+	select {
+	case result := <-done:
+		if readErr != nil {
+			// shell 已退出（如执行了 exit 或被信号终止）
+			s.Close()
+			return result, fmt.Errorf("%v: %w", readErr, ErrSessionClosed)
+		}
+		return result, nil
+	case <-runCtx.Done():
+	}
+
+	// 超时或被取消：终止命令及其子进程，等待 shell 输出分隔符后继续使用
+	cause := contextError(context.Cause(runCtx))
+	if s.interrupt != nil && s.interrupt(s.cmd.Process.Pid) == nil {
+		// 被终止的命令可能已经读走了 stdin 中的分隔符命令，补写一次；重复的分隔符会在之后被忽略
+		io.WriteString(s.stdin, s.wrap("", s.markers, id))
+		select {
+		case result := <-done:
+			if readErr == nil {
+				return result, cause
+			}
+			s.Close()
+			return result, fmt.Errorf("%w: %w", cause, ErrSessionClosed)
+		case <-time.After(cancelGracePeriod):
+		}
+	}
+
+	// shell 本身无法恢复（如内建命令阻塞），只能关闭整个会话
+	s.Close()
+	result := <-done
+	return result, fmt.Errorf("%w: %w", cause, ErrSessionClosed)
+}
+
+// applyTrailer 根据命令结尾的状态信息更新退出状态码、工作目录和环境变量
+func (s *shell) applyTrailer(result *Result, t *trailer) {
+	result.ExitCode = t.exitCode
+	if t.cwd != "" {
+		s.setCwd(t.cwd)
+	}
+	if t.env != nil {
+		// 第一次输出的环境变量作为基准，不视为变化
+		if s.env != nil {
+			result.EnvChanges = diffEnv(s.env, t.env)
+		}
+		s.env = t.env
+	}
+}
+
+// Cancel 终止正在执行的命令
+func (s *shell) Cancel() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		return false
+	}
+	s.cancel(ErrCommandCanceled)
+	return true
+}
+
+// Close 关闭终端，同时结束正在运行的命令及其子进程
+// 不等待执行令牌：正在执行的命令可能一直不结束，直接结束进程可以让其返回
+func (s *shell) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	if s.interrupt != nil && s.cmd.Process != nil {
+		s.interrupt(s.cmd.Process.Pid)
+	}
+	for _, closer := range s.closers {
+		closer.Close()
+	}
+
+	if s.cmd != nil && s.cmd.Process != nil {
+		err := s.cmd.Process.Kill()
+		s.cmd.Wait() // 回收子进程，避免残留僵尸进程
+		if err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetCwd 获取当前工作目录
+func (s *shell) GetCwd() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cwd
+}
+
+func (s *shell) setCwd(cwd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cwd = cwd
+}
+
+func (s *shell) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// contextError 将 context 的结束原因转换为终端的错误类型
+func contextError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrCommandTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrCommandCanceled
+	default:
+		return err
+	}
+}
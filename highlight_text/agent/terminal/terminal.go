@@ -1,16 +1,125 @@
 package terminal
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
 // Terminal 定义了终端操作的接口
 type Terminal interface {
-	// Execute 执行命令并返回输出
-	Execute(command string) (string, error)
+	// Execute 执行命令并返回结构化结果；命令以非零状态退出不视为错误
+	// ctx 结束（超时或取消）时终止命令及其子进程，返回已读取的部分结果
+	Execute(ctx context.Context, command string) (*Result, error)
+	// Stream 与 Execute 相同，同时在输出产生时逐行调用 sink（可为nil），调用按顺序进行、不会并发
+	Stream(ctx context.Context, command string, sink func(Chunk)) (*Result, error)
+	// StartJob 以会话当前的工作目录和环境变量启动后台任务，立即返回；任务的输出只保留最近 bufferBytes 字节
+	StartJob(ctx context.Context, id, command string, bufferBytes int) (*Job, error)
+	// Cancel 终止正在执行的命令，返回当时是否有命令在执行
+	Cancel() bool
 	// Close 关闭终端
 	Close() error
 	// GetCwd 获取当前工作目录
 	GetCwd() string
+	// Allows 判断受限模式下工具能否访问该路径（位于根目录之下，按解析符号链接后的路径判断），未启用受限模式时总是返回 true
+	Allows(path string) bool
+}
+
+// 命令执行的错误类型，供上层通过 errors.Is 判断
+var (
+	// ErrCommandTimeout 命令超时，已被终止
+	ErrCommandTimeout = errors.New("command timed out")
+	// ErrCommandCanceled 命令被取消，已被终止
+	ErrCommandCanceled = errors.New("command canceled")
+	// ErrSessionClosed 终端已关闭（包括终止命令后 shell 无法恢复而被关闭），需要新建会话
+	ErrSessionClosed = errors.New("terminal session closed")
+)
+
+// Result 一条命令的执行结果
+type Result struct {
+	Stdout   string        // 标准输出（已去除首尾空白）
+	Stderr   string        // 标准错误（已去除首尾空白）
+	ExitCode int           // 退出状态码，被信号终止时为 128+信号值
+	Duration time.Duration // 从写入命令到读完输出的耗时
+	Cwd      string        // 命令结束后的工作目录（cd、pushd 及脚本中的切换均会体现）
+
+	// EnvChanges 命令导致的导出环境变量变化：新增或修改的变量为新值，被删除的变量为nil
+	// 仅 bash 终端支持，没有变化时为nil
+	EnvChanges map[string]*string
+
+	// Violations 受限模式下根据错误输出推断可能违反的限制（Inferred 为 true），不作为错误返回
+	Violations []Violation
+}
+
+// 输出流名称
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Chunk 命令执行过程中产生的一段输出
+type Chunk struct {
+	Stream string // StreamStdout 或 StreamStderr
+	Data   string // 一行输出（含换行符），PTY模式下与 Result 一样已去除ANSI序列
+}
+
+// Resizer 支持调整窗口大小的终端（PTY模式）实现此接口
+type Resizer interface {
+	// Resize 设置终端窗口的列数和行数，子进程会收到 SIGWINCH
+	Resize(cols, rows int) error
+}
+
+// Mode 终端的底层实现方式
+type Mode string
+
+const (
+	ModeAuto Mode = "auto" // 平台支持时使用PTY，否则（或分配PTY失败时）使用管道
+	ModePTY  Mode = "pty"  // 强制使用PTY（目前仅Linux支持）
+	ModePipe Mode = "pipe" // 通过管道连接 shell 的标准输入输出
+)
+
+// PTY的默认窗口大小
+const (
+	defaultCols = 120
+	defaultRows = 40
+)
+
+// 启动 shell 并完成初始化的最长等待时间
+const startTimeout = 10 * time.Second
+
+// Options 创建终端的选项
+type Options struct {
+	Mode     Mode // 为空时等同于 ModeAuto
+	Cols     int  // 初始列数（仅PTY），0 使用默认值
+	Rows     int  // 初始行数（仅PTY），0 使用默认值
+	KeepANSI bool // 保留输出中的ANSI转义序列（仅PTY），默认去除颜色、光标控制等序列
+
+	Sandbox *Sandbox // 受限模式（仅 Linux），为nil时以服务进程的权限和环境运行
+}
+
+// ParseMode 解析配置中的终端模式，空字符串视为 auto
+func ParseMode(value string) (Mode, bool) {
+	switch Mode(value) {
+	case "", ModeAuto:
+		return ModeAuto, true
+	case ModePTY, ModePipe:
+		return Mode(value), true
+	}
+	return "", false
 }
 
 // New 创建一个新的终端实例
 func New() (Terminal, error) {
-	return newTerminal()
-}
\ No newline at end of file
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions 按指定选项创建终端实例
+func NewWithOptions(opts Options) (Terminal, error) {
+	if opts.Cols <= 0 {
+		opts.Cols = defaultCols
+	}
+	if opts.Rows <= 0 {
+		opts.Rows = defaultRows
+	}
+	return newTerminal(opts)
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package terminal
+
+import "fmt"
+
+// newTerminal 创建新的 Linux 终端实例：默认使用PTY，无法分配PTY时回退到管道模式
+func newTerminal(opts Options) (Terminal, error) {
+	var sb *sandboxState
+	if opts.Sandbox != nil {
+		var err error
+		if sb, err = newSandboxState(opts.Sandbox); err != nil {
+			return nil, fmt.Errorf("invalid sandbox: %v", err)
+		}
+	}
+
+	switch opts.Mode {
+	case ModePipe:
+		return newMacTerminal(sb)
+	case ModePTY:
+		return newPtyTerminal(opts, sb)
+	default:
+		if pt, err := newPtyTerminal(opts, sb); err == nil {
+			return pt, nil
+		}
+		return newMacTerminal(sb)
+	}
+}
@@ -0,0 +1,190 @@
+//go:build linux
+
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// termios 中的 ECHO 标志（syscall 包未导出）
+const termiosEcho = 0x8
+
+// PtyTerminal 基于伪终端（PTY）的 Linux 终端实现
+// bash 的标准输入输出连接到PTY从设备，检测TTY的程序（git、python、进度条等）与在真实终端中的行为一致；
+// 标准错误单独通过管道读取，以便与 stdout 区分
+type PtyTerminal struct {
+	*shell
+	pty *os.File // PTY主设备
+}
+
+// newPtyTerminal 分配PTY并在其中启动 bash，sb 不为nil时以受限模式运行
+func newPtyTerminal(opts Options, sb *sandboxState) (*PtyTerminal, error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pty: %v", err)
+	}
+	defer slave.Close() // 子进程已持有从设备，父进程无需保留
+
+	// 关闭回显，否则写入的命令会混入输出
+	if err := disableEcho(slave); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to configure pty: %v", err)
+	}
+	if err := setWinsize(master, opts.Cols, opts.Rows); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to set pty size: %v", err)
+	}
+
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to create stderr pipe: %v", err)
+	}
+	defer stderrWriter.Close()
+
+	// stderr 不是终端，需要 -i 显式开启交互模式，前台命令才会获得终端（否则读取终端时会被 SIGTTIN 暂停）；
+	// --noediting 关闭 readline，避免其重新打开回显或输出括号粘贴等控制序列
+	cmd := exec.Command("/bin/bash", "--noprofile", "--norc", "--noediting", "-i")
+	env := os.Environ()
+	if sb != nil {
+		env = sb.env()
+		cmd.Dir = sb.Root
+	}
+	cmd.Env = append(env,
+		"TERM=xterm-256color",
+		"PS1=", "PS2=", "PROMPT_COMMAND=",
+		// 分页器会等待按键，Agent 无法交互
+		"PAGER=cat", "GIT_PAGER=cat",
+	)
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = stderrWriter
+	// 新建会话并把PTY设为控制终端，使窗口大小变化、Ctrl+C 等信号能送达前台进程
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		stderrReader.Close()
+		return nil, fmt.Errorf("failed to start bash: %v", err)
+	}
+
+	render := renderLine
+	if opts.KeepANSI {
+		render = nil
+	}
+	m := newMarkers()
+	pt := &PtyTerminal{
+		shell: &shell{
+			cmd:       cmd,
+			stdin:     master,
+			stdout:    bufio.NewReader(master),
+			stderr:    newStderrCollector(stderrReader, m.command),
+			closers:   []io.Closer{master, stderrReader},
+			markers:   m,
+			render:    render,
+			wrap:      wrapBashCommand,
+			interrupt: killJobs,
+			sandbox:   sb,
+		},
+		pty: master,
+	}
+
+	// 交互模式默认开启作业控制；关闭历史扩展，否则命令中的 ! 会被替换；
+	// 关闭历史记录，避免命令通过 history 读到写入 stdin 的分隔符
+	if err := pt.start(sandboxInit("set +H +o history", sb)); err != nil {
+		pt.Close()
+		return nil, err
+	}
+
+	return pt, nil
+}
+
+// Resize 调整PTY窗口大小
+func (pt *PtyTerminal) Resize(cols, rows int) error {
+	if cols <= 0 || rows <= 0 || cols > 0xffff || rows > 0xffff {
+		return fmt.Errorf("invalid terminal size: %dx%d", cols, rows)
+	}
+	return setWinsize(pt.pty, cols, rows)
+}
+
+// openPty 打开 /dev/ptmx 并返回主设备和对应的从设备
+func openPty() (master, slave *os.File, err error) {
+	// 以非阻塞方式打开，os.NewFile 会将其注册到运行时的轮询器，Close 时可以唤醒阻塞中的读取
+	fd, err := syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlock int32
+	if err := ioctl(fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+	var index uint32
+	if err := ioctl(fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&index))); err != nil {
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+
+	master = os.NewFile(uintptr(fd), "/dev/ptmx")
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", index), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// disableEcho 关闭终端回显
+func disableEcho(f *os.File) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		var termios syscall.Termios
+		if ioctlErr = ioctl(int(fd), syscall.TCGETS, uintptr(unsafe.Pointer(&termios))); ioctlErr != nil {
+			return
+		}
+		termios.Lflag &^= termiosEcho
+		ioctlErr = ioctl(int(fd), syscall.TCSETS, uintptr(unsafe.Pointer(&termios)))
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+// setWinsize 设置终端窗口大小
+func setWinsize(f *os.File, cols, rows int) error {
+	ws := struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}{Row: uint16(rows), Col: uint16(cols)}
+
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		ioctlErr = ioctl(int(fd), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+func ioctl(fd int, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
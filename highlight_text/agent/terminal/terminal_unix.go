@@ -0,0 +1,66 @@
+//go:build darwin || linux
+
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// MacTerminal macOS/Linux 终端的管道模式实现（Linux 上作为PTY不可用时的回退）
+type MacTerminal struct {
+	*shell
+}
+
+// newMacTerminal 创建新的 macOS/Linux 终端实例，sb 不为nil时以受限模式运行
+func newMacTerminal(sb *sandboxState) (*MacTerminal, error) {
+	cmd := exec.Command("/bin/bash")
+	// bash 独占一个进程组，关闭时连同未开启作业控制前启动的子进程一起结束
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if sb != nil {
+		cmd.Env = sb.env()
+		cmd.Dir = sb.Root
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %v", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %v", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start bash: %v", err)
+	}
+
+	m := newMarkers()
+	mt := &MacTerminal{shell: &shell{
+		cmd:       cmd,
+		stdin:     stdin,
+		stdout:    bufio.NewReader(stdout),
+		stderr:    newStderrCollector(stderr, m.command),
+		closers:   []io.Closer{stdin},
+		markers:   m,
+		wrap:      wrapBashCommand,
+		interrupt: killJobs,
+		sandbox:   sb,
+	}}
+
+	if err := mt.start(sandboxInit(bashInit, sb)); err != nil {
+		mt.Close()
+		return nil, err
+	}
+
+	return mt, nil
+}
@@ -6,29 +6,32 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
-	"sync"
 )
 
 // WindowsTerminal Windows 终端实现
+// 无法单独终止正在运行的命令，超时或取消时会关闭整个会话
 type WindowsTerminal struct {
-	cmd    *exec.Cmd
-	stdin  io.WriteCloser
-	stdout io.ReadCloser
-	stderr io.ReadCloser
-	cwd    string
-	mu     sync.Mutex
+	*shell
 }
 
-// newTerminal 创建新的 Windows 终端实例
-func newTerminal() (Terminal, error) {
+// newTerminal 创建新的 Windows 终端实例（仅支持管道模式）
+func newTerminal(opts Options) (Terminal, error) {
+	if opts.Mode == ModePTY {
+		return nil, fmt.Errorf("pty mode is not supported on windows")
+	}
+	if opts.Sandbox != nil {
+		return nil, fmt.Errorf("sandbox mode is not supported on windows")
+	}
 	return newWindowsTerminal()
 }
 
 // newWindowsTerminal 创建新的 Windows 终端实例
 func newWindowsTerminal() (*WindowsTerminal, error) {
-	cmd := exec.Command("cmd.exe")
+	// /Q 关闭命令回显，否则回显的命令行会混入输出
+	cmd := exec.Command("cmd.exe", "/Q")
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -49,82 +52,52 @@ func newWindowsTerminal() (*WindowsTerminal, error) {
 		return nil, fmt.Errorf("failed to start cmd.exe: %v", err)
 	}
 
-	wt := &WindowsTerminal{
-		cmd:    cmd,
-		stdin:  stdin,
-		stdout: stdout,
-		stderr: stderr,
-		cwd:    "",
+	m := newMarkers()
+	wt := &WindowsTerminal{shell: &shell{
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  bufio.NewReader(stdout),
+		stderr:  newStderrCollector(stderr, m.command),
+		closers: []io.Closer{stdin},
+		markers: m,
+		wrap:    wrapCmdCommand,
+	}}
+
+	if err := wt.start(""); err != nil {
+		wt.Close()
+		return nil, err
 	}
 
-	// 获取初始工作目录
-	cwd, _ := wt.Execute("cd")
-	wt.cwd = strings.TrimSpace(cwd)
-
 	return wt, nil
 }
 
-// Execute 执行命令并返回输出
-func (wt *WindowsTerminal) Execute(command string) (string, error) {
-	wt.mu.Lock()
-	defer wt.mu.Unlock()
-
-	// 添加分隔符以便识别命令输出的结束
-	marker := "___COMMAND_END___"
-	fullCommand := fmt.Sprintf("%s && echo %s\r\n", command, marker)
-
-	// 写入命令
-	if _, err := wt.stdin.Write([]byte(fullCommand)); err != nil {
-		return "", fmt.Errorf("failed to write command: %v", err)
-	}
-
-	// 读取输出直到遇到分隔符
-	var output strings.Builder
-	scanner := bufio.NewScanner(wt.stdout)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, marker) {
-			break
-		}
-		output.WriteString(line)
-		output.WriteString("\n")
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("failed to read output: %v", err)
-	}
-
-	// 更新当前工作目录（如果执行的是 cd 命令）
-	if strings.HasPrefix(strings.TrimSpace(command), "cd ") {
-		cwd, _ := wt.Execute("cd")
-		wt.cwd = strings.TrimSpace(cwd)
-	}
-
-	result := strings.TrimSpace(output.String())
-	return result, nil
+// killedByCPULimit Windows 不支持受限模式
+func killedByCPULimit(state *os.ProcessState) bool {
+	return false
 }
 
-// Close 关闭终端
-func (wt *WindowsTerminal) Close() error {
-	wt.mu.Lock()
-	defer wt.mu.Unlock()
-
-	if wt.stdin != nil {
-		wt.stdin.Write([]byte("exit\r\n"))
-		wt.stdin.Close()
-	}
+// jobCommand 后台任务由 cmd.exe 执行
+func jobCommand(script string) *exec.Cmd {
+	return exec.Command("cmd.exe", "/C", script)
+}
 
-	if wt.cmd != nil && wt.cmd.Process != nil {
-		return wt.cmd.Process.Kill()
+// ChdirCommand 返回将 cmd.exe 切换到 dir 的命令
+// cmd.exe 在引号内仍会展开 %变量%，包含 % 或引号的路径无法安全引用，返回错误
+func ChdirCommand(dir string) (string, error) {
+	if strings.ContainsAny(dir, "%\"\r\n") {
+		return "", fmt.Errorf("unsupported character in path: %s", dir)
 	}
+	return fmt.Sprintf("cd /d \"%s\"", dir), nil
+}
 
-	return nil
+// signalJob Windows 没有终止信号，直接结束进程（其子进程不会被结束）
+func signalJob(cmd *exec.Cmd, force bool) {
+	cmd.Process.Kill()
 }
 
-// GetCwd 获取当前工作目录
-func (wt *WindowsTerminal) GetCwd() string {
-	wt.mu.Lock()
-	defer wt.mu.Unlock()
-	return wt.cwd
-}
\ No newline at end of file
+// wrapCmdCommand 分隔符放在单独的行：同一行中的 %errorlevel% 会在命令执行前展开；分隔符之后依次是退出状态码和工作目录
+// 分隔符中间插入转义符 ^，读取 stdin 的命令回显这段文本时不会被误认为分隔符
+func wrapCmdCommand(command string, m markers, id int) string {
+	head, tail := splitMarker(m.command)
+	return fmt.Sprintf("%s\r\necho %s^%s %d %%errorlevel%% %%cd%%\r\necho %s^%s %d 1>&2\r\n", command, head, tail, id, head, tail, id)
+}
@@ -0,0 +1,206 @@
+package terminal
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// trailer 每条命令结束后 shell 输出的状态信息
+type trailer struct {
+	exitCode int               // 退出状态码，无法解析时为 -1
+	cwd      string            // 命令结束后的工作目录，为空表示未知
+	env      map[string]string // 导出的环境变量，仅在发生变化时非nil
+}
+
+// parseTrailer 解析分隔符行中命令序号之后的内容："<退出状态码> <工作目录>"
+func parseTrailer(rest string) *trailer {
+	t := &trailer{exitCode: -1}
+	code, cwd, _ := strings.Cut(rest, " ")
+	if n, err := strconv.Atoi(code); err == nil {
+		t.exitCode = n
+	}
+	t.cwd = cwd
+	return t
+}
+
+// 由工作目录体现的变量，不作为环境变量变化上报
+var ignoredEnv = map[string]bool{"PWD": true, "OLDPWD": true}
+
+// diffEnv 比较两次导出的环境变量，返回新增或修改的变量（值为新值）和被删除的变量（值为nil）
+func diffEnv(before, after map[string]string) map[string]*string {
+	changes := make(map[string]*string)
+	for name, value := range after {
+		if ignoredEnv[name] {
+			continue
+		}
+		if old, ok := before[name]; !ok || old != value {
+			value := value
+			changes[name] = &value
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok && !ignoredEnv[name] {
+			changes[name] = nil
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// readExportList 读取环境变量块直到命令结束分隔符 marker，返回解析后的变量和分隔符所在行
+func readExportList(reader *bufio.Reader, marker string) (map[string]string, string, error) {
+	var text strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if _, _, _, found := parseMarker(line, marker); found {
+			return parseExportList(text.String()), strings.TrimRight(line, "\r\n"), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		// PTY会将换行转换为 \r\n
+		text.WriteString(strings.TrimRight(line, "\r\n"))
+		text.WriteString("\n")
+	}
+}
+
+// parseExportList 解析 bash 的 export -p 输出
+// 值使用双引号（可能跨行）或 $'...'（bash 4.4 起用于含控制字符的值）引用，只导出未赋值的变量会被跳过
+func parseExportList(text string) map[string]string {
+	env := make(map[string]string)
+	for text != "" {
+		var ok bool
+		if text, ok = cutDeclare(text); !ok {
+			// 无法识别的行，跳到下一行
+			_, text, _ = strings.Cut(text, "\n")
+			continue
+		}
+
+		end := strings.IndexAny(text, "=\n")
+		if end < 0 {
+			break
+		}
+		name := text[:end]
+		if text[end] == '\n' {
+			text = text[end+1:]
+			continue
+		}
+		text = text[end+1:]
+
+		var value string
+		switch {
+		case strings.HasPrefix(text, `"`):
+			value, text, ok = unquoteDouble(text[1:])
+		case strings.HasPrefix(text, "$'"):
+			value, text, ok = unquoteANSIC(text[2:])
+		default:
+			value, text, _ = strings.Cut(text, "\n")
+			ok = true
+		}
+		if !ok {
+			break
+		}
+		env[name] = value
+		text = strings.TrimPrefix(text, "\n")
+	}
+	return env
+}
+
+// cutDeclare 去除行首的 "declare -x "（POSIX 模式下为 "export "）
+func cutDeclare(text string) (string, bool) {
+	for _, prefix := range []string{"declare -x ", "export "} {
+		if strings.HasPrefix(text, prefix) {
+			return text[len(prefix):], true
+		}
+	}
+	return text, false
+}
+
+// unquoteDouble 解析双引号字符串（起始引号之后的部分），返回值和结束引号之后的剩余文本
+func unquoteDouble(text string) (string, string, bool) {
+	var value strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\\':
+			if i+1 < len(text) {
+				i++
+				if next := text[i]; next != '"' && next != '\\' && next != '$' && next != '`' && next != '\n' {
+					value.WriteByte('\\')
+				}
+				value.WriteByte(text[i])
+			}
+		case '"':
+			return value.String(), text[i+1:], true
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", "", false
+}
+
+// unquoteANSIC 解析 $'...' 字符串（起始引号之后的部分），返回值和结束引号之后的剩余文本
+func unquoteANSIC(text string) (string, string, bool) {
+	var value strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '\'' {
+			return value.String(), text[i+1:], true
+		}
+		if c != '\\' || i+1 >= len(text) {
+			value.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch e := text[i]; e {
+		case 'a':
+			value.WriteByte('\a')
+		case 'b':
+			value.WriteByte('\b')
+		case 'e', 'E':
+			value.WriteByte(0x1b)
+		case 'f':
+			value.WriteByte('\f')
+		case 'n':
+			value.WriteByte('\n')
+		case 'r':
+			value.WriteByte('\r')
+		case 't':
+			value.WriteByte('\t')
+		case 'v':
+			value.WriteByte('\v')
+		case 'x':
+			// \xHH：一到两位十六进制数
+			j := i + 1
+			for j < len(text) && j < i+3 && isHex(text[j]) {
+				j++
+			}
+			if n, err := strconv.ParseUint(text[i+1:j], 16, 8); err == nil {
+				value.WriteByte(byte(n))
+				i = j - 1
+			} else {
+				value.WriteString(`\x`)
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// \NNN：一到三位八进制数
+			j := i
+			for j < len(text) && j < i+3 && text[j] >= '0' && text[j] <= '7' {
+				j++
+			}
+			n, _ := strconv.ParseUint(text[i:j], 8, 16)
+			value.WriteByte(byte(n))
+			i = j - 1
+		default:
+			// \\、\'、\" 等
+			value.WriteByte(e)
+		}
+	}
+	return "", "", false
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
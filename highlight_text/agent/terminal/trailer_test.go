@@ -0,0 +1,113 @@
+package terminal
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTrailer(t *testing.T) {
+	tests := []struct {
+		rest     string
+		exitCode int
+		cwd      string
+	}{
+		{"0 /home/user", 0, "/home/user"},
+		{"127 /path with spaces", 127, "/path with spaces"},
+		{"1", 1, ""},
+		{"", -1, ""},
+		{"x /tmp", -1, "/tmp"},
+	}
+	for _, tt := range tests {
+		got := parseTrailer(tt.rest)
+		if got.exitCode != tt.exitCode || got.cwd != tt.cwd {
+			t.Errorf("parseTrailer(%q) = %d, %q; want %d, %q", tt.rest, got.exitCode, got.cwd, tt.exitCode, tt.cwd)
+		}
+	}
+}
+
+func TestParseExportList(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]string
+	}{
+		{
+			name: "double quoted",
+			text: "declare -x HOME=\"/root\"\ndeclare -x PATH=\"/usr/bin:/bin\"\n",
+			want: map[string]string{"HOME": "/root", "PATH": "/usr/bin:/bin"},
+		},
+		{
+			name: "escapes",
+			text: `declare -x A="say \"hi\" \$x \\ \n"` + "\n",
+			want: map[string]string{"A": `say "hi" $x \ \n`},
+		},
+		{
+			name: "multi-line value",
+			text: "declare -x A=\"line1\nline2\"\ndeclare -x B=\"b\"\n",
+			want: map[string]string{"A": "line1\nline2", "B": "b"},
+		},
+		{
+			name: "ansi-c quoted",
+			text: `declare -x A=$'tab\there\nnew\x41\101\'q'` + "\n",
+			want: map[string]string{"A": "tab\there\nnewAA'q"},
+		},
+		{
+			name: "posix mode and unset",
+			text: "export A=\"1\"\ndeclare -x UNSET\ngarbage line\ndeclare -x B=\"2\"\n",
+			want: map[string]string{"A": "1", "B": "2"},
+		},
+		{
+			name: "unterminated quote",
+			text: "declare -x A=\"1\"\ndeclare -x B=\"open\n",
+			want: map[string]string{"A": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseExportList(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseExportList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffEnv(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+	before := map[string]string{"A": "1", "B": "2", "PWD": "/a", "GONE": "x"}
+	after := map[string]string{"A": "1", "B": "3", "PWD": "/b", "NEW": ""}
+	want := map[string]*string{"B": strPtr("3"), "NEW": strPtr(""), "GONE": nil}
+	if got := diffEnv(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffEnv() = %v, want %v", got, want)
+	}
+	if got := diffEnv(before, before); got != nil {
+		t.Errorf("diffEnv() of identical maps = %v, want nil", got)
+	}
+}
+
+func TestReadUntilMarkerEnvBlock(t *testing.T) {
+	m := testMarkers
+	input := "out\n" +
+		"tail" + m.env + " 4\r\n" +
+		"declare -x A=\"1\"\r\n" +
+		"declare -x B=\"x\ny\"\r\n" +
+		m.command + " 4 0 /work\r\n"
+	output, tr, err := readUntilMarker(bufio.NewReader(strings.NewReader(input)), m, 4, nil, nil)
+	if err != nil {
+		t.Fatalf("readUntilMarker: %v", err)
+	}
+	if output != "out\ntail" || tr.exitCode != 0 || tr.cwd != "/work" {
+		t.Errorf("got %q, exit %d, cwd %q", output, tr.exitCode, tr.cwd)
+	}
+	if want := map[string]string{"A": "1", "B": "x\ny"}; !reflect.DeepEqual(tr.env, want) {
+		t.Errorf("env = %q, want %q", tr.env, want)
+	}
+
+	// 不带随机数的环境变量块起始行按普通输出处理
+	input = envMarker + " 1\n" + m.command + " 1 0 /\n"
+	output, tr, err = readUntilMarker(bufio.NewReader(strings.NewReader(input)), m, 1, nil, nil)
+	if err != nil || output != envMarker+" 1" || tr.env != nil {
+		t.Errorf("forged env block: got %q, env %v, err %v", output, tr.env, err)
+	}
+}
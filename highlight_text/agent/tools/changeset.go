@@ -0,0 +1,346 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"highlight_text/agent/pathutil"
+)
+
+// 一个变更集最多包含的修改项数
+const maxChangesetChanges = 100
+
+// 变更集中文件的变化
+const (
+	ActionCreated  = "created"
+	ActionModified = "modified"
+	ActionDeleted  = "deleted"
+)
+
+// FileState 文件的内容和权限，nil 表示文件不存在
+type FileState struct {
+	Content []byte
+	Mode    fs.FileMode
+}
+
+// ReadFileState 读取文件的当前状态，文件不存在时返回 nil；路径存在但不是普通文件时返回错误
+func ReadFileState(path string) (*FileState, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileState{Content: data, Mode: info.Mode().Perm()}, nil
+}
+
+// sameState 判断两个状态的内容是否相同（不比较权限）
+func sameState(a, b *FileState) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return bytes.Equal(a.Content, b.Content)
+}
+
+// FileChange 变更集中的一个文件：修改前和修改后的状态
+type FileChange struct {
+	Path   string
+	Before *FileState
+	After  *FileState
+}
+
+// Action 返回文件的变化：created、modified 或 deleted
+func (c *FileChange) Action() string {
+	switch {
+	case c.Before == nil:
+		return ActionCreated
+	case c.After == nil:
+		return ActionDeleted
+	default:
+		return ActionModified
+	}
+}
+
+// Changeset 一组文件修改，Apply 时全部生效或全部恢复
+type Changeset struct {
+	Files       []*FileChange
+	CreatedDirs []string // Apply 时新建的目录，由浅到深
+}
+
+// ChangesetResult apply_changeset 工具的输出
+type ChangesetResult struct {
+	ID    string                `json:"id"` // 撤销时使用的变更集ID
+	Files []ChangesetFileResult `json:"files"`
+	Diff  string                `json:"diff"`
+}
+
+// ChangesetFileResult 变更集中一个文件的修改
+type ChangesetFileResult struct {
+	Path    string     `json:"path"`
+	Action  string     `json:"action"`
+	Changes []DiffHunk `json:"changes,omitempty"`
+}
+
+// ChangesetEntries 返回 apply_changeset 参数中的各项修改，参数格式不正确时返回 nil
+// 调用方可以直接修改其中的路径（如将相对路径解析为绝对路径）
+func ChangesetEntries(args map[string]interface{}) []map[string]interface{} {
+	list, ok := args["changes"].([]interface{})
+	if !ok {
+		return nil
+	}
+	entries := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// PlanChangeset 校验所有修改并计算每个文件修改后的内容，不写入文件
+// 同一文件的多项修改按顺序生效；最终内容不变的文件被忽略
+func PlanChangeset(args map[string]interface{}) (*Changeset, error) {
+	entries := ChangesetEntries(args)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("missing or invalid 'changes' parameter (expected a non-empty array of objects)")
+	}
+	if len(entries) > maxChangesetChanges {
+		return nil, fmt.Errorf("too many changes: %d (limit %d)", len(entries), maxChangesetChanges)
+	}
+
+	cs := &Changeset{}
+	files := make(map[string]*FileChange)
+	for i, entry := range entries {
+		op, _ := entry["op"].(string)
+		path := extractPath(entry)
+		if path == "" {
+			return nil, fmt.Errorf("changes[%d]: missing or invalid 'path' parameter", i)
+		}
+		path = filepath.Clean(path)
+		fc, ok := files[path]
+		if !ok {
+			before, err := ReadFileState(path)
+			if err != nil {
+				return nil, fmt.Errorf("changes[%d]: %w", i, err)
+			}
+			fc = &FileChange{Path: path, Before: before, After: before}
+			files[path] = fc
+			cs.Files = append(cs.Files, fc)
+		}
+		if err := planChange(fc, op, entry); err != nil {
+			return nil, fmt.Errorf("changes[%d] (%s %s): %w", i, op, path, err)
+		}
+	}
+
+	changed := cs.Files[:0]
+	for _, fc := range cs.Files {
+		if !sameState(fc.Before, fc.After) {
+			changed = append(changed, fc)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, fmt.Errorf("changeset leaves all files unchanged")
+	}
+	cs.Files = changed
+	return cs, nil
+}
+
+// planChange 将一项修改应用到文件的计划状态
+func planChange(fc *FileChange, op string, entry map[string]interface{}) error {
+	cur := fc.After
+	switch op {
+	case "create", "write":
+		content, ok := entry["content"].(string)
+		if !ok {
+			return fmt.Errorf("missing or invalid 'content' parameter")
+		}
+		if op == "create" && cur != nil {
+			return fmt.Errorf("file %w", fs.ErrExist)
+		}
+		mode := fs.FileMode(0644)
+		if cur != nil {
+			mode = cur.Mode
+		}
+		fc.After = &FileState{Content: []byte(content), Mode: mode}
+	case "edit":
+		if cur == nil {
+			return fmt.Errorf("file %w", fs.ErrNotExist)
+		}
+		updated, _, err := editContent(string(cur.Content), entry)
+		if err != nil {
+			return err
+		}
+		fc.After = &FileState{Content: []byte(updated), Mode: cur.Mode}
+	case "delete":
+		if cur == nil {
+			return fmt.Errorf("file %w", fs.ErrNotExist)
+		}
+		fc.After = nil
+	default:
+		return fmt.Errorf("invalid op %q (expected write, create, edit or delete)", op)
+	}
+	return nil
+}
+
+// Apply 应用所有修改：先把新内容写入各文件所在目录的临时文件，全部成功后再依次重命名覆盖或删除
+// 文件在 PlanChangeset 之后被修改时返回 ErrFileChanged；任何一步失败时恢复已修改的文件，删除临时文件和新建的目录
+// 内容不变的文件被跳过（权限也不修改）
+func (cs *Changeset) Apply() error {
+	for _, fc := range cs.Files {
+		cur, err := ReadFileState(fc.Path)
+		if err != nil {
+			return err
+		}
+		if !sameState(cur, fc.Before) {
+			return fmt.Errorf("%s: %w", fc.Path, ErrFileChanged)
+		}
+	}
+
+	temps := make([]string, len(cs.Files))
+	cleanup := func() {
+		for _, tmp := range temps {
+			if tmp != "" {
+				os.Remove(tmp)
+			}
+		}
+		cs.removeCreatedDirs()
+	}
+	for i, fc := range cs.Files {
+		if fc.After == nil || sameState(fc.Before, fc.After) {
+			continue
+		}
+		if err := cs.mkdirAll(filepath.Dir(fc.Path)); err != nil {
+			cleanup()
+			return err
+		}
+		tmp, err := writeTemp(fc.Path, fc.After.Content, fc.After.Mode)
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to write %s: %v", fc.Path, err)
+		}
+		temps[i] = tmp
+	}
+
+	for i, fc := range cs.Files {
+		var err error
+		if sameState(fc.Before, fc.After) {
+			continue
+		} else if fc.After == nil {
+			err = os.Remove(fc.Path)
+		} else if err = os.Rename(temps[i], fc.Path); err == nil {
+			temps[i] = ""
+		}
+		if err != nil {
+			restoreErr := restoreFiles(cs.Files[:i])
+			cleanup()
+			if restoreErr != nil {
+				return fmt.Errorf("failed to apply change to %s: %v (restoring earlier changes also failed: %v)", fc.Path, err, restoreErr)
+			}
+			return fmt.Errorf("failed to apply change to %s: %v", fc.Path, err)
+		}
+	}
+	return nil
+}
+
+// restoreFiles 将文件恢复为修改前的状态
+func restoreFiles(files []*FileChange) error {
+	var errs []error
+	for _, fc := range files {
+		var err error
+		if fc.Before == nil {
+			err = os.Remove(fc.Path)
+		} else {
+			err = writeFileAtomic(fc.Path, fc.Before.Content, fc.Before.Mode)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mkdirAll 创建不存在的上级目录并记录到 CreatedDirs
+func (cs *Changeset) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0755); err != nil {
+			return err
+		}
+		cs.CreatedDirs = append(cs.CreatedDirs, missing[i])
+	}
+	return nil
+}
+
+// removeCreatedDirs 由深到浅删除新建的目录（只删除空目录）
+func (cs *Changeset) removeCreatedDirs() {
+	for i := len(cs.CreatedDirs) - 1; i >= 0; i-- {
+		os.Remove(cs.CreatedDirs[i])
+	}
+	cs.CreatedDirs = nil
+}
+
+// Result 生成 apply_changeset 工具的输出，diff 中的文件名相对于所有文件的共同上级目录
+func (cs *Changeset) Result(id string) string {
+	var paths []string
+	for _, fc := range cs.Files {
+		paths = append(paths, fc.Path)
+	}
+	base := commonDir(paths)
+
+	result := ChangesetResult{ID: id, Files: []ChangesetFileResult{}}
+	var diff string
+	for _, fc := range cs.Files {
+		var before, after string
+		if fc.Before != nil {
+			before = string(fc.Before.Content)
+		}
+		if fc.After != nil {
+			after = string(fc.After.Content)
+		}
+		d, changes := unifiedDiff(relSlash(base, fc.Path), before, after)
+		result.Files = append(result.Files, ChangesetFileResult{Path: fc.Path, Action: fc.Action(), Changes: changes})
+		diff += d
+	}
+	result.Diff = clipDiff(diff, maxDiffBytes)
+	data, _ := json.Marshal(result)
+	return truncateByTokens(string(data), maxOutputTokens)
+}
+
+// commonDir 返回所有路径的共同上级目录
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	dir := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for !pathutil.Within(dir, p) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
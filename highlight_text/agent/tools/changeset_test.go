@@ -0,0 +1,248 @@
+package tools
+
+import (
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// changesetArgs 构造 apply_changeset 的参数
+func changesetArgs(changes ...map[string]interface{}) map[string]interface{} {
+	list := make([]interface{}, len(changes))
+	for i, c := range changes {
+		list[i] = c
+	}
+	return map[string]interface{}{"changes": list}
+}
+
+// readTree 返回目录下所有文件的相对路径和内容，目录以 / 结尾、内容为空
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+		if d.IsDir() {
+			tree[rel+"/"] = ""
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		tree[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestPlanChangeset(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(existing, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+
+	tests := []struct {
+		name    string
+		changes []map[string]interface{}
+		wantErr string
+		actions []string
+	}{
+		{
+			name: "edits apply in order",
+			changes: []map[string]interface{}{
+				{"op": "edit", "path": existing, "old_string": "one", "new_string": "1"},
+				{"op": "edit", "path": existing, "old_string": "1\ntwo", "new_string": "1\n2"},
+			},
+			actions: []string{ActionModified},
+		},
+		{
+			name: "create then edit",
+			changes: []map[string]interface{}{
+				{"op": "create", "path": missing, "content": "x\n"},
+				{"op": "edit", "path": missing, "old_string": "x", "new_string": "y"},
+			},
+			actions: []string{ActionCreated},
+		},
+		{
+			name: "delete",
+			changes: []map[string]interface{}{
+				{"op": "delete", "path": existing},
+			},
+			actions: []string{ActionDeleted},
+		},
+		{
+			name: "unchanged files are dropped",
+			changes: []map[string]interface{}{
+				{"op": "write", "path": existing, "content": "one\ntwo\n"},
+				{"op": "create", "path": missing, "content": ""},
+			},
+			actions: []string{ActionCreated},
+		},
+		{
+			name: "all unchanged",
+			changes: []map[string]interface{}{
+				{"op": "create", "path": missing, "content": "x"},
+				{"op": "delete", "path": missing},
+			},
+			wantErr: "unchanged",
+		},
+		{
+			name:    "create existing",
+			changes: []map[string]interface{}{{"op": "create", "path": existing, "content": "x"}},
+			wantErr: "changes[0] (create",
+		},
+		{
+			name:    "edit missing",
+			changes: []map[string]interface{}{{"op": "edit", "path": missing, "old_string": "a", "new_string": "b"}},
+			wantErr: "does not exist",
+		},
+		{
+			name: "failed edit",
+			changes: []map[string]interface{}{
+				{"op": "write", "path": missing, "content": "x"},
+				{"op": "edit", "path": existing, "old_string": "three", "new_string": "3"},
+			},
+			wantErr: "changes[1]",
+		},
+		{
+			name:    "directory",
+			changes: []map[string]interface{}{{"op": "write", "path": dir, "content": "x"}},
+			wantErr: "not a regular file",
+		},
+		{
+			name:    "invalid op",
+			changes: []map[string]interface{}{{"op": "move", "path": existing}},
+			wantErr: "invalid op",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs, err := PlanChangeset(changesetArgs(tt.changes...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("PlanChangeset() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actions []string
+			for _, fc := range cs.Files {
+				actions = append(actions, fc.Action())
+			}
+			if strings.Join(actions, ",") != strings.Join(tt.actions, ",") {
+				t.Errorf("actions = %v, want %v", actions, tt.actions)
+			}
+		})
+	}
+
+	// 只计划，不写入文件
+	if _, err := os.Stat(missing); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("PlanChangeset created %s", missing)
+	}
+}
+
+func TestChangesetApply(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("a\nb\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "old.txt"), []byte("old\n"), 0644)
+
+	cs, err := PlanChangeset(changesetArgs(
+		map[string]interface{}{"op": "edit", "path": filepath.Join(dir, "keep.txt"), "old_string": "b", "new_string": "B"},
+		map[string]interface{}{"op": "delete", "path": filepath.Join(dir, "old.txt")},
+		map[string]interface{}{"op": "create", "path": filepath.Join(dir, "new", "sub", "c.txt"), "content": "c\n"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"keep.txt": "a\nB\n", "new/": "", "new/sub/": "", "new/sub/c.txt": "c\n"}
+	if got := readTree(t, dir); !maps.Equal(got, want) {
+		t.Errorf("files after Apply = %q, want %q", got, want)
+	}
+	wantDirs := []string{filepath.Join(dir, "new"), filepath.Join(dir, "new", "sub")}
+	if strings.Join(cs.CreatedDirs, ",") != strings.Join(wantDirs, ",") {
+		t.Errorf("CreatedDirs = %v, want %v", cs.CreatedDirs, wantDirs)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dir, "keep.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("keep.txt mode = %v, want 0600", info.Mode().Perm())
+		}
+	}
+}
+
+func TestChangesetApplyFileChanged(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	os.WriteFile(a, []byte("a\n"), 0644)
+	os.WriteFile(b, []byte("b\n"), 0644)
+
+	cs, err := PlanChangeset(changesetArgs(
+		map[string]interface{}{"op": "write", "path": a, "content": "A\n"},
+		map[string]interface{}{"op": "write", "path": b, "content": "B\n"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(b, []byte("changed\n"), 0644)
+
+	if err := cs.Apply(); !errors.Is(err, ErrFileChanged) {
+		t.Fatalf("Apply() error = %v, want ErrFileChanged", err)
+	}
+	want := map[string]string{"a.txt": "a\n", "b.txt": "changed\n"}
+	if got := readTree(t, dir); !maps.Equal(got, want) {
+		t.Errorf("files after failed Apply = %q, want %q", got, want)
+	}
+}
+
+func TestChangesetApplyRollback(t *testing.T) {
+	dir := t.TempDir()
+	a, gone := filepath.Join(dir, "a.txt"), filepath.Join(dir, "gone.txt")
+	os.WriteFile(a, []byte("a\n"), 0644)
+	os.WriteFile(gone, []byte("gone\n"), 0644)
+
+	// 先创建 x/y.txt 使 x 成为目录，之后把文件重命名为 x 时失败，此前的修改都应恢复
+	cs, err := PlanChangeset(changesetArgs(
+		map[string]interface{}{"op": "write", "path": a, "content": "A\n"},
+		map[string]interface{}{"op": "delete", "path": gone},
+		map[string]interface{}{"op": "create", "path": filepath.Join(dir, "x", "y.txt"), "content": "y\n"},
+		map[string]interface{}{"op": "create", "path": filepath.Join(dir, "x"), "content": "x\n"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cs.Apply()
+	if err == nil || !strings.Contains(err.Error(), "failed to apply change to "+filepath.Join(dir, "x")+":") {
+		t.Fatalf("Apply() error = %v, want failure on x", err)
+	}
+	if strings.Contains(err.Error(), "restoring") {
+		t.Errorf("Apply() error = %v, want successful restore", err)
+	}
+
+	// 文件恢复原状，新建的目录和临时文件都被删除
+	want := map[string]string{"a.txt": "a\n", "gone.txt": "gone\n"}
+	if got := readTree(t, dir); !maps.Equal(got, want) {
+		t.Errorf("files after rollback = %q, want %q", got, want)
+	}
+	if len(cs.CreatedDirs) != 0 {
+		t.Errorf("CreatedDirs = %v, want none", cs.CreatedDirs)
+	}
+}
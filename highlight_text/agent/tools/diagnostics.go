@@ -0,0 +1,7 @@
+package tools
+
+// FileIssue 自检时发现的问题文件
+type FileIssue struct {
+	Path   string `json:"path"`   // 相对于所检查目录的路径
+	Reason string `json:"reason"` // 无法解析的原因
+}
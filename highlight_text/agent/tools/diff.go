@@ -0,0 +1,282 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	diffContextLines = 3                           // 生成的 unified diff 中每处修改前后保留的上下文行数
+	maxDiffBytes     = maxOutputTokens * 4 * 3 / 4 // 返回的 diff 的长度上限，为JSON中的其他字段留出空间
+)
+
+// DiffHunk 一处修改的行范围（与 unified diff 的 @@ 行一致）
+// start 从 1 开始；lines 为 0 时 start 为该位置之前的一行
+type DiffHunk struct {
+	OldStart int `json:"old_start"`
+	OldLines int `json:"old_lines"`
+	NewStart int `json:"new_start"`
+	NewLines int `json:"new_lines"`
+}
+
+// diffLine unified diff 中的一行：kind 为 ' '（不变）、'-'（删除）或 '+'（新增），text 含行尾换行符
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// splitLines 按行拆分，每行保留行尾换行符（最后一行可能没有）
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines 按行比较两段文本
+func diffLines(a, b string) []diffLine {
+	dmp := diffmatchpatch.New()
+	ra, rb, lineArray := dmp.DiffLinesToRunes(a, b)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(ra, rb, false), lineArray)
+
+	var out []diffLine
+	for _, d := range diffs {
+		kind := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			kind = '-'
+		case diffmatchpatch.DiffInsert:
+			kind = '+'
+		}
+		for _, line := range splitLines(d.Text) {
+			out = append(out, diffLine{kind, line})
+		}
+	}
+	return out
+}
+
+// unifiedDiff 生成 a 到 b 的 unified diff，同时返回每处修改（不含上下文）的行范围
+func unifiedDiff(name, a, b string) (string, []DiffHunk) {
+	lines := diffLines(a, b)
+	// oldPos[i]、newPos[i] 为第 i 行之前两侧各有多少行
+	oldPos := make([]int, len(lines)+1)
+	newPos := make([]int, len(lines)+1)
+	for i, l := range lines {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if l.kind != '+' {
+			oldPos[i+1]++
+		}
+		if l.kind != '-' {
+			newPos[i+1]++
+		}
+	}
+	hunkAt := func(from, to int) DiffHunk {
+		h := DiffHunk{OldStart: oldPos[from], OldLines: oldPos[to] - oldPos[from], NewStart: newPos[from], NewLines: newPos[to] - newPos[from]}
+		if h.OldLines > 0 {
+			h.OldStart++
+		}
+		if h.NewLines > 0 {
+			h.NewStart++
+		}
+		return h
+	}
+
+	// 连续的修改行为一处修改
+	type block struct{ from, to int }
+	var blocks []block
+	var changes []DiffHunk
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(lines) && lines[j].kind != ' ' {
+			j++
+		}
+		blocks = append(blocks, block{i, j})
+		changes = append(changes, hunkAt(i, j))
+		i = j
+	}
+	if len(blocks) == 0 {
+		return "", changes
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", name, name)
+	for i := 0; i < len(blocks); {
+		// 间隔不超过两倍上下文的修改合并为一个 hunk
+		j := i
+		for j+1 < len(blocks) && blocks[j+1].from-blocks[j].to <= 2*diffContextLines {
+			j++
+		}
+		from := max(blocks[i].from-diffContextLines, 0)
+		to := min(blocks[j].to+diffContextLines, len(lines))
+		h := hunkAt(from, to)
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		for _, l := range lines[from:to] {
+			sb.WriteByte(l.kind)
+			sb.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = j + 1
+	}
+	return sb.String(), changes
+}
+
+// clipDiff 在行边界截断过长的 diff，并注明省略的行数
+func clipDiff(diff string, limit int) string {
+	if len(diff) <= limit {
+		return diff
+	}
+	cut := strings.LastIndexByte(diff[:limit], '\n') + 1
+	return diff[:cut] + fmt.Sprintf("[... %d more lines of diff omitted]\n", strings.Count(diff[cut:], "\n"))
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// patchHunk 补丁中的一个 hunk，lines 中的 text 不含行尾换行符
+type patchHunk struct {
+	oldStart int
+	lines    []diffLine
+	noEOL    int // 标记了 "\ No newline at end of file" 的行下标，没有时为 -1
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parsePatch 解析单个文件的 unified diff，忽略 ---/+++ 等文件头
+func parsePatch(patch string) ([]patchHunk, error) {
+	var hunks []patchHunk
+	var cur *patchHunk
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			hunks = append(hunks, patchHunk{oldStart: start, noEOL: -1})
+			cur = &hunks[len(hunks)-1]
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		// 下一个文件的文件头
+		if strings.HasPrefix(line, "diff ") || (strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")) {
+			return nil, fmt.Errorf("patch modifies more than one file")
+		}
+		switch {
+		case line == "":
+			// 末尾的空行，或被去掉了前导空格的空上下文行
+			if i < len(lines)-1 {
+				cur.lines = append(cur.lines, diffLine{' ', ""})
+			}
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			cur.lines = append(cur.lines, diffLine{line[0], line[1:]})
+		case line[0] == '\\':
+			cur.noEOL = len(cur.lines) - 1
+		default:
+			return nil, fmt.Errorf("invalid patch line %d: %q", i+1, line)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no hunks (expected lines starting with @@)")
+	}
+	for i := range hunks {
+		// 去掉 hunk 末尾多余的空上下文行（通常来自补丁末尾的空行）
+		h := &hunks[i]
+		for len(h.lines) > 0 && h.noEOL < len(h.lines)-1 && h.lines[len(h.lines)-1] == (diffLine{' ', ""}) {
+			h.lines = h.lines[:len(h.lines)-1]
+		}
+	}
+	return hunks, nil
+}
+
+// applyPatch 将补丁应用到 content。每个 hunk 的删除行和上下文行必须与文件内容一致（忽略行尾的 \r），
+// 优先在 @@ 行给出的位置匹配，位置不符时使用距离最近的匹配
+func applyPatch(content string, hunks []patchHunk) (string, error) {
+	lines := splitLines(content)
+	eol := "\n"
+	if strings.Contains(content, "\r\n") {
+		eol = "\r\n"
+	}
+	trim := func(s string) string { return strings.TrimRight(s, "\r\n") }
+
+	var out []string
+	pos, delta := 0, 0 // pos 为已处理到的原文件行，delta 为上一个 hunk 的实际位置与 @@ 行所给位置之差（均按原文件计）
+	for n, h := range hunks {
+		var old []string
+		for _, l := range h.lines {
+			if l.kind != '+' {
+				old = append(old, l.text)
+			}
+		}
+		stated := max(h.oldStart-1, 0)
+		if len(old) == 0 {
+			// 纯新增的 hunk：@@ 行给出的是插入位置之前的一行
+			stated = h.oldStart
+		}
+		expected := stated + delta
+
+		matchAt := func(at int) bool {
+			if at < pos || at+len(old) > len(lines) {
+				return false
+			}
+			for k, text := range old {
+				if trim(lines[at+k]) != strings.TrimRight(text, "\r") {
+					return false
+				}
+			}
+			return true
+		}
+		at := -1
+		for d := 0; at < 0 && (expected-d >= pos || expected+d <= len(lines)); d++ {
+			if matchAt(expected - d) {
+				at = expected - d
+			} else if matchAt(expected + d) {
+				at = expected + d
+			}
+		}
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d (@@ -%d) does not match the file content", n+1, h.oldStart)
+		}
+
+		out = append(out, lines[pos:at]...)
+		k := at
+		for i, l := range h.lines {
+			switch l.kind {
+			case ' ':
+				out = append(out, lines[k])
+				k++
+			case '-':
+				k++
+			case '+':
+				text := l.text
+				if i != h.noEOL {
+					text += eol
+				}
+				out = append(out, text)
+			}
+		}
+		delta = at - stated
+		pos = k
+	}
+	out = append(out, lines[pos:]...)
+	// 在没有结尾换行符的最后一行之后追加了内容时补上换行符
+	for i := 0; i+1 < len(out); i++ {
+		if !strings.HasSuffix(out[i], "\n") {
+			out[i] += eol
+		}
+	}
+	return strings.Join(out, ""), nil
+}
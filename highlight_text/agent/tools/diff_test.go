@@ -0,0 +1,245 @@
+package tools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		diff    string
+		changes []DiffHunk
+	}{
+		{name: "unchanged", a: "a\nb\n", b: "a\nb\n"},
+		{
+			name: "replace",
+			a:    "a\nb\nc\n",
+			b:    "a\nB\nc\n",
+			diff: "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			changes: []DiffHunk{
+				{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 1},
+			},
+		},
+		{
+			name: "insert",
+			a:    "a\nc\n",
+			b:    "a\nb\nc\n",
+			diff: "--- a/f\n+++ b/f\n@@ -1,2 +1,3 @@\n a\n+b\n c\n",
+			changes: []DiffHunk{
+				{OldStart: 1, OldLines: 0, NewStart: 2, NewLines: 1},
+			},
+		},
+		{
+			name: "two hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			b:    "x\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			diff: "--- a/f\n+++ b/f\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -7,4 +7,3 @@\n 7\n 8\n 9\n-10\n",
+			changes: []DiffHunk{
+				{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1},
+				{OldStart: 10, OldLines: 1, NewStart: 9, NewLines: 0},
+			},
+		},
+		{
+			name: "no newline at end",
+			a:    "a\nb",
+			b:    "a\nc",
+			diff: "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+			changes: []DiffHunk{
+				{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, changes := unifiedDiff("f", tt.a, tt.b)
+			if diff != tt.diff {
+				t.Errorf("diff =\n%s\nwant\n%s", diff, tt.diff)
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("changes = %+v, want %+v", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    []patchHunk
+		wantErr string
+	}{
+		{
+			name:  "multiple hunks",
+			patch: "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -10 +10,2 @@\n x\n+y\n",
+			want: []patchHunk{
+				{oldStart: 1, lines: []diffLine{{'-', "a"}, {'+', "A"}, {' ', "b"}}, noEOL: -1},
+				{oldStart: 10, lines: []diffLine{{' ', "x"}, {'+', "y"}}, noEOL: -1},
+			},
+		},
+		{
+			name:  "no newline marker",
+			patch: "@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n",
+			want: []patchHunk{
+				{oldStart: 1, lines: []diffLine{{'-', "a"}, {'+', "b"}}, noEOL: 1},
+			},
+		},
+		{
+			name:  "crlf patch",
+			patch: "@@ -1,2 +1,2 @@\r\n a\r\n-b\r\n+c\r\n",
+			want: []patchHunk{
+				{oldStart: 1, lines: []diffLine{{' ', "a"}, {'-', "b"}, {'+', "c"}}, noEOL: -1},
+			},
+		},
+		{
+			name:  "empty context line without leading space",
+			patch: "@@ -1,3 +1,3 @@\n a\n\n-b\n+c\n\n",
+			want: []patchHunk{
+				{oldStart: 1, lines: []diffLine{{' ', "a"}, {' ', ""}, {'-', "b"}, {'+', "c"}}, noEOL: -1},
+			},
+		},
+		{name: "no hunks", patch: "--- a/f\n+++ b/f\n", wantErr: "no hunks"},
+		{name: "invalid line", patch: "@@ -1 +1 @@\n-a\n?b\n", wantErr: "invalid patch line 3"},
+		{
+			name:    "more than one file",
+			patch:   "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-a\n+b\n--- a/g\n+++ b/g\n@@ -1 +1 @@\n-c\n+d\n",
+			wantErr: "more than one file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePatch(tt.patch)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parsePatch() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		patch   string
+		want    string
+		wantErr string
+	}{
+		{
+			// 第二个 hunk 的 @@ 行按原文件给出位置，不受第一个 hunk 增加的行数影响
+			name:    "hunks changing line count",
+			content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			patch:   "@@ -1,2 +1,4 @@\n 1\n+1a\n+1b\n 2\n@@ -8,2 +10,2 @@\n 8\n-9\n+nine\n",
+			want:    "1\n1a\n1b\n2\n3\n4\n5\n6\n7\n8\nnine\n10\n",
+		},
+		{
+			// 相同的行出现多次时，按行数变化推算位置会匹配到错误的一处
+			name:    "hunks changing line count with repeated lines",
+			content: "1\n2\n3\n4\n5\n6\n7\n8\n9\nx\n11\n12\nx\n14\n",
+			patch:   "@@ -1 +1,4 @@\n 1\n+a\n+b\n+c\n@@ -10 +13 @@\n-x\n+X\n",
+			want:    "1\na\nb\nc\n2\n3\n4\n5\n6\n7\n8\n9\nX\n11\n12\nx\n14\n",
+		},
+		{
+			name:    "hunks removing lines",
+			content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			patch:   "@@ -2,3 +2 @@\n-2\n-3\n 4\n@@ -9 +7 @@\n-9\n+nine\n",
+			want:    "1\n4\n5\n6\n7\n8\nnine\n10\n",
+		},
+		{
+			// @@ 行的位置整体偏移时，后续 hunk 沿用前一个 hunk 的偏移
+			name:    "offset drift",
+			content: "x\nx\n1\n2\n3\n4\n5\n6\n7\n8\n",
+			patch:   "@@ -1 +1 @@\n-1\n+one\n@@ -6 +6 @@\n-6\n+six\n",
+			want:    "x\nx\none\n2\n3\n4\n5\nsix\n7\n8\n",
+		},
+		{
+			name:    "pure insertion",
+			content: "a\nb\n",
+			patch:   "@@ -1,0 +2 @@\n+x\n",
+			want:    "a\nx\nb\n",
+		},
+		{
+			name:    "remove newline at end",
+			content: "a\nb\n",
+			patch:   "@@ -1,2 +1,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n",
+			want:    "a\nc",
+		},
+		{
+			name:    "append after last line without newline",
+			content: "a\nb",
+			patch:   "@@ -1,2 +1,3 @@\n a\n b\n\\ No newline at end of file\n+c\n",
+			want:    "a\nb\nc\n",
+		},
+		{
+			name:    "crlf content",
+			content: "a\r\nb\r\nc\r\n",
+			patch:   "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:    "a\r\nB\r\nc\r\n",
+		},
+		{
+			name:    "mismatch",
+			content: "a\nb\n",
+			patch:   "@@ -1 +1 @@\n-z\n+y\n",
+			wantErr: "hunk 1 (@@ -1) does not match",
+		},
+		{
+			name:    "hunks out of order",
+			content: "a\nb\nc\n",
+			patch:   "@@ -3 +3 @@\n-c\n+C\n@@ -1 +1 @@\n-a\n+A\n",
+			wantErr: "hunk 2 (@@ -1) does not match",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := parsePatch(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyPatch(tt.content, hunks)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("applyPatch() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("applyPatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 生成的 diff 应用到原文件后应得到修改后的内容
+func TestUnifiedDiffRoundTrip(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "1\nx\ny\n3\n4\n5\n6\n7\n8\n9\n11\n12\nz\n"},
+		{"a\nb", "a\nb\nc"},
+		{"", "a\n"},
+		{"a\n", ""},
+	}
+	for _, tt := range tests {
+		diff, _ := unifiedDiff("f", tt.a, tt.b)
+		hunks, err := parsePatch(diff)
+		if err != nil {
+			t.Errorf("parsePatch(unifiedDiff(%q, %q)): %v", tt.a, tt.b, err)
+			continue
+		}
+		if got, err := applyPatch(tt.a, hunks); err != nil || got != tt.b {
+			t.Errorf("applyPatch(%q) = %q, %v, want %q", tt.a, got, err, tt.b)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EditResult edit_file 工具的输出
+type EditResult struct {
+	Path         string     `json:"path"`
+	Replacements int        `json:"replacements,omitempty"` // old_string 被替换的次数
+	Changes      []DiffHunk `json:"changes"`                // 每处修改的行范围（不含上下文）
+	Diff         string     `json:"diff"`
+}
+
+func executeEditFile(args map[string]interface{}) (string, error) {
+	path := extractPath(args)
+	if path == "" {
+		return "", fmt.Errorf("missing or invalid path parameter")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	content := string(data)
+
+	result := EditResult{Path: path}
+	updated, replacements, err := editContent(content, args)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	result.Replacements = replacements
+	if updated == content {
+		return "", fmt.Errorf("edit leaves %s unchanged", path)
+	}
+
+	if err := writeFileAtomic(path, []byte(updated), info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	diff, changes := unifiedDiff(filepath.Base(path), content, updated)
+	result.Diff, result.Changes = clipDiff(diff, maxDiffBytes), changes
+	data, _ = json.Marshal(result)
+	return truncateByTokens(string(data), maxOutputTokens), nil
+}
+
+// editContent 按参数修改文本：old_string/new_string 精确替换或应用 patch，返回修改后的文本和替换次数
+func editContent(content string, args map[string]interface{}) (string, int, error) {
+	patch, _ := args["patch"].(string)
+	oldString, hasOld := args["old_string"].(string)
+	newString, hasNew := args["new_string"].(string)
+	if patch != "" {
+		if hasOld || hasNew {
+			return "", 0, fmt.Errorf("use either 'patch' or 'old_string'/'new_string', not both")
+		}
+		hunks, err := parsePatch(patch)
+		if err != nil {
+			return "", 0, err
+		}
+		updated, err := applyPatch(content, hunks)
+		return updated, 0, err
+	}
+	if !hasOld || oldString == "" {
+		return "", 0, fmt.Errorf("missing or invalid 'old_string' parameter (or provide 'patch')")
+	}
+	if !hasNew {
+		return "", 0, fmt.Errorf("missing or invalid 'new_string' parameter")
+	}
+	return replaceExact(content, oldString, newString, extractBool(args, "replace_all", false))
+}
+
+// replaceExact 将 content 中的 old 替换为 new。old 必须恰好出现一次，replaceAll 为 true 时替换所有出现
+// 文件使用 \r\n 换行而 old 中只有 \n 时，按 \r\n 匹配和替换
+func replaceExact(content, old, new string, replaceAll bool) (string, int, error) {
+	n := strings.Count(content, old)
+	if n == 0 && strings.Contains(content, "\r\n") && strings.Contains(old, "\n") && !strings.Contains(old, "\r") {
+		old = strings.ReplaceAll(old, "\n", "\r\n")
+		new = strings.ReplaceAll(strings.ReplaceAll(new, "\r\n", "\n"), "\n", "\r\n")
+		n = strings.Count(content, old)
+	}
+	switch {
+	case n == 0:
+		return "", 0, fmt.Errorf("old_string not found")
+	case n > 1 && !replaceAll:
+		return "", 0, fmt.Errorf("old_string matches %d times; include more surrounding lines to make it unique, or set replace_all", n)
+	}
+	return strings.ReplaceAll(content, old, new), n, nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，避免写入中途失败时留下不完整的文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := writeTemp(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeTemp 将内容写入 path 所在目录下的临时文件并设置权限，返回临时文件路径
+func writeTemp(path string, data []byte, perm os.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
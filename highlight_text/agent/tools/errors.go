@@ -0,0 +1,13 @@
+package tools
+
+import "errors"
+
+// 工具执行的通用错误类型，供上层通过 errors.Is 判断并映射为对应的API错误码
+var (
+	// ErrUnknownTool 工具名称不存在
+	ErrUnknownTool = errors.New("unknown tool")
+	// ErrPathDenied 路径超出允许访问的范围
+	ErrPathDenied = errors.New("path access denied")
+	// ErrFileChanged 文件在校验之后、写入之前被其他程序修改
+	ErrFileChanged = errors.New("file changed since it was read")
+)
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"runtime"
 	"strings"
 )
 
@@ -108,19 +107,128 @@ func GetAvailableTools() []ToolDefinition {
 				"required": []string{"path", "content"},
 			},
 		},
+		{
+			Name:        "edit_file",
+			Description: "修改文件的一部分：将 old_string 替换为 new_string（old_string 必须在文件中恰好出现一次），或应用 unified diff 格式的 patch。返回JSON：修改后的 diff 和每处修改的行号 changes",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "文件路径",
+					},
+					"old_string": map[string]interface{}{
+						"type":        "string",
+						"description": "要替换的原文，需与文件内容完全一致（包括缩进），并包含足够的上下文使其唯一",
+					},
+					"new_string": map[string]interface{}{
+						"type":        "string",
+						"description": "替换后的内容",
+					},
+					"replace_all": map[string]interface{}{
+						"type":        "boolean",
+						"description": "替换 old_string 的所有出现（可选，默认 false）",
+					},
+					"patch": map[string]interface{}{
+						"type":        "string",
+						"description": "unified diff（@@ -行号,行数 +行号,行数 @@ 开头的 hunk），上下文行和删除行必须与文件内容一致；与 old_string/new_string 二选一",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+		{
+			Name:        "apply_changeset",
+			Description: "一次修改多个文件：先校验所有修改，全部有效时才一起写入，任何一个文件写入失败时恢复全部文件。返回JSON：变更集ID（可由用户撤销）、每个文件的变化和 diff",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"changes": map[string]interface{}{
+						"type":        "array",
+						"description": fmt.Sprintf("按顺序执行的修改（最多 %d 项）", maxChangesetChanges),
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"op": map[string]interface{}{
+									"type":        "string",
+									"enum":        []string{"write", "create", "edit", "delete"},
+									"description": "write 写入（覆盖或新建），create 新建（文件已存在时失败），edit 修改（参数同 edit_file），delete 删除",
+								},
+								"path": map[string]interface{}{
+									"type":        "string",
+									"description": "文件路径",
+								},
+								"content": map[string]interface{}{
+									"type":        "string",
+									"description": "write 和 create 的文件内容",
+								},
+								"old_string": map[string]interface{}{
+									"type":        "string",
+									"description": "edit：要替换的原文，必须在文件中恰好出现一次",
+								},
+								"new_string": map[string]interface{}{
+									"type":        "string",
+									"description": "edit：替换后的内容",
+								},
+								"replace_all": map[string]interface{}{
+									"type":        "boolean",
+									"description": "edit：替换 old_string 的所有出现",
+								},
+								"patch": map[string]interface{}{
+									"type":        "string",
+									"description": "edit：unified diff，与 old_string/new_string 二选一",
+								},
+							},
+							"required": []string{"op", "path"},
+						},
+					},
+				},
+				"required": []string{"changes"},
+			},
+		},
 		{
 			Name:        "grep",
-			Description: "在文件中搜索匹配的文本",
+			Description: "在文件或目录（递归）中搜索匹配的文本，返回JSON：matches 中每项为 {file, line, column, text}。默认遵循 .gitignore，跳过二进制文件",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"pattern": map[string]interface{}{
 						"type":        "string",
-						"description": "要搜索的模式",
+						"description": "要搜索的正则表达式（Go RE2 语法），literal 为 true 时按普通文本匹配",
 					},
 					"path": map[string]interface{}{
 						"type":        "string",
-						"description": "文件或目录路径",
+						"description": "文件或目录路径（相对于当前工作目录）",
+					},
+					"literal": map[string]interface{}{
+						"type":        "boolean",
+						"description": "按普通文本而不是正则表达式匹配（可选，默认 false）",
+					},
+					"ignore_case": map[string]interface{}{
+						"type":        "boolean",
+						"description": "忽略大小写（可选，默认 false）",
+					},
+					"include": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "只搜索匹配这些 glob 的文件，如 [\"*.go\", \"src/**/*.ts\"]（可选）",
+					},
+					"exclude": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "跳过匹配这些 glob 的文件和目录，如 [\"vendor\", \"*_test.go\"]（可选）",
+					},
+					"context": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("同时返回匹配行前后的行数（可选，最多 %d）", maxGrepContext),
+					},
+					"max_matches": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("最多返回的匹配数（可选，默认 %d，最多 %d）", defaultGrepMatches, maxGrepMatches),
+					},
+					"gitignore": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否跳过 .gitignore 忽略的文件（可选，默认 true）",
 					},
 				},
 				"required": []string{"pattern", "path"},
@@ -128,7 +236,7 @@ func GetAvailableTools() []ToolDefinition {
 		},
 		{
 			Name:        "list_files",
-			Description: "列出目录中的文件和子目录",
+			Description: "列出目录中的文件和子目录，返回JSON：entries 中每项包含 name、type（file/dir/symlink）、size、mtime，目录还包含子项数 children 和展开的 entries。默认遵循 .gitignore；条目过多时每个目录只列出部分子项，其余计入 omitted",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -136,29 +244,152 @@ func GetAvailableTools() []ToolDefinition {
 						"type":        "string",
 						"description": "目录路径（可选，默认为当前目录）",
 					},
+					"depth": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("递归展开的层数（可选，默认 %d，最多 %d）", defaultListDepth, maxListDepth),
+					},
+					"include": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "只列出匹配这些 glob 的文件（目录始终列出），如 [\"*.go\"]（可选）",
+					},
+					"ignore": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "跳过匹配这些 glob 的文件和目录，如 [\"node_modules\", \"*.log\"]（可选）",
+					},
+					"sort": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"name", "size", "mtime"},
+						"description": "排序方式：name（默认，目录在前）、size（从大到小）、mtime（从新到旧）",
+					},
+					"gitignore": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否跳过 .gitignore 忽略的文件（可选，默认 true）",
+					},
+				},
+			},
+		},
+		{
+			Name:        "glob",
+			Description: "递归查找路径匹配 glob 的文件和目录（如 **/*.go、src/**/test_*.py），返回JSON：matches 中每项包含 path、type、size、mtime。默认遵循 .gitignore",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"pattern": map[string]interface{}{
+						"type":        "string",
+						"description": "相对于 path 的 glob：** 匹配任意多级目录，* 和 ? 不匹配 /",
+					},
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "搜索的目录（可选，默认为当前目录）",
+					},
+					"ignore": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "跳过匹配这些 glob 的文件和目录（可选）",
+					},
+					"sort": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"name", "size", "mtime"},
+						"description": "排序方式：name（默认，按路径）、size（从大到小）、mtime（从新到旧）",
+					},
+					"max_results": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("最多返回的匹配数（可选，默认 %d，最多 %d）", defaultGlobResults, maxGlobResults),
+					},
+					"gitignore": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否跳过 .gitignore 忽略的文件（可选，默认 true）",
+					},
+				},
+				"required": []string{"pattern"},
+			},
+		},
+		{
+			Name:        "run_background",
+			Description: "在后台启动长时间运行的命令（如开发服务器、watch 构建），立即返回任务ID，之后用 job_output 查看输出。任务在当前工作目录运行，会话关闭时被终止",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"command": map[string]interface{}{
+						"type":        "string",
+						"description": "要执行的命令",
+					},
+				},
+				"required": []string{"command"},
+			},
+		},
+		{
+			Name:        "job_output",
+			Description: "读取后台任务的输出（stdout 和 stderr 合并）。传入上次返回的 next_offset 只读取新的输出；不传 offset 时读取最近的输出",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"job_id": map[string]interface{}{
+						"type":        "string",
+						"description": "任务ID",
+					},
+					"offset": map[string]interface{}{
+						"type":        "integer",
+						"description": "读取的起始偏移（可选）",
+					},
+					"max_bytes": map[string]interface{}{
+						"type":        "integer",
+						"description": fmt.Sprintf("最多读取的字节数（可选，默认且最多 %d）", maxJobOutputBytes),
+					},
+				},
+				"required": []string{"job_id"},
+			},
+		},
+		{
+			Name:        "job_status",
+			Description: "查看后台任务是否仍在运行及其退出状态码；不传 job_id 时列出当前会话的所有任务",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"job_id": map[string]interface{}{
+						"type":        "string",
+						"description": "任务ID（可选）",
+					},
 				},
 			},
 		},
+		{
+			Name:        "job_kill",
+			Description: "终止后台任务及其子进程",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"job_id": map[string]interface{}{
+						"type":        "string",
+						"description": "任务ID",
+					},
+				},
+				"required": []string{"job_id"},
+			},
+		},
 	}
 }
 
 // ToolResult 工具执行结果
 type ToolResult struct {
-	Output      string // 输出内容
-	IsCommand   bool   // 是否是需要在终端执行的命令
-	Command     string // 如果IsCommand为true，这里是命令字符串
-	DirectResult bool  // 是否是直接结果（不需要终端）
+	Output       string      // 输出内容
+	Chdir        string      // path_switch 的目标目录（可以是相对路径），由终端会话切换
+	DirectResult bool        // 是否是直接结果（不需要终端）
+	Job          *JobRequest // 后台任务操作，由终端会话执行
+	Changeset    *Changeset  // 已校验的多文件修改，由调用方记录回滚信息后应用
 }
 
 // ExecuteTool 执行工具调用，返回工具结果
 func ExecuteTool(toolName string, args map[string]interface{}) (*ToolResult, error) {
 	switch toolName {
 	case "path_switch":
-		cmd, err := executePathSwitch(args)
+		dir, err := executePathSwitch(args)
 		if err != nil {
 			return nil, err
 		}
-		return &ToolResult{Command: cmd, IsCommand: true}, nil
+		return &ToolResult{Chdir: dir}, nil
 
 	case "read_file":
 		output, err := executeReadFile(args)
@@ -174,34 +405,96 @@ func ExecuteTool(toolName string, args map[string]interface{}) (*ToolResult, err
 		}
 		return &ToolResult{Output: output, DirectResult: true}, nil
 
+	case "edit_file":
+		output, err := executeEditFile(args)
+		if err != nil {
+			return nil, err
+		}
+		return &ToolResult{Output: output, DirectResult: true}, nil
+
 	case "grep":
-		cmd, err := executeGrep(args)
+		output, err := executeGrep(args)
 		if err != nil {
 			return nil, err
 		}
-		return &ToolResult{Command: cmd, IsCommand: true}, nil
+		return &ToolResult{Output: output, DirectResult: true}, nil
 
 	case "list_files":
-		cmd, err := executeListFiles(args)
+		output, err := executeListFiles(args)
 		if err != nil {
 			return nil, err
 		}
-		return &ToolResult{Command: cmd, IsCommand: true}, nil
+		return &ToolResult{Output: output, DirectResult: true}, nil
+
+	case "glob":
+		output, err := executeGlob(args)
+		if err != nil {
+			return nil, err
+		}
+		return &ToolResult{Output: output, DirectResult: true}, nil
+
+	case "apply_changeset":
+		cs, err := PlanChangeset(args)
+		if err != nil {
+			return nil, err
+		}
+		return &ToolResult{Changeset: cs}, nil
+
+	case "run_background", "job_output", "job_status", "job_kill":
+		job, err := parseJobRequest(toolName, args)
+		if err != nil {
+			return nil, err
+		}
+		return &ToolResult{Job: job}, nil
 
 	default:
-		return nil, fmt.Errorf("unknown tool: %s", toolName)
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTool, toolName)
 	}
 }
 
+// PreviewCommand 返回命令类工具将在终端中执行的命令（不执行），供策略规则匹配和向用户展示
+// path_switch 的目标路径经过引用；其他工具或参数无效时返回空字符串
+func PreviewCommand(toolName string, args map[string]interface{}) string {
+	switch toolName {
+	case "path_switch":
+		if dir, err := executePathSwitch(args); err == nil {
+			return formatArgv([]string{"cd", dir})
+		}
+	case "run_background":
+		cmd, _ := args["command"].(string)
+		return cmd
+	}
+	return ""
+}
+
+// RequiresShell 判断工具是否把参数作为 shell 文本执行，这类调用必须由策略规则明确允许或经用户确认
+func RequiresShell(toolName string) bool {
+	return toolName == "run_background"
+}
+
+// formatArgv 将参数列表格式化为便于阅读的命令行，包含空白或特殊字符的参数用单引号引用
+func formatArgv(argv []string) string {
+	parts := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+			return !(r == '-' || r == '_' || r == '.' || r == '/' || r == ':' || r == '=' || r == ',' || r == '+' || r == '@' ||
+				(r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'))
+		}) < 0 {
+			parts[i] = arg
+			continue
+		}
+		parts[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(parts, " ")
+}
+
+// executePathSwitch 返回目标目录，切换由终端会话完成
 func executePathSwitch(args map[string]interface{}) (string, error) {
 	path, ok := args["path"].(string)
-	if !ok {
+	if !ok || path == "" {
 		return "", fmt.Errorf("missing or invalid 'path' parameter")
 	}
-
-	// 转义特殊字符
-	path = strings.ReplaceAll(path, "\"", "\\\"")
-	return fmt.Sprintf("cd \"%s\"", path), nil
+	return path, nil
 }
 
 // executeReadFile 统一的文件读取函数，支持多种模式
@@ -250,7 +543,7 @@ func executeReadFile(args map[string]interface{}) (string, error) {
 	// 默认行为: 读取整个文件
 	content, err := os.ReadFile(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
 	return truncateByTokens(string(content), maxOutputTokens), nil
@@ -260,7 +553,7 @@ func executeReadFile(args map[string]interface{}) (string, error) {
 func readFileLines(path string, startLine, count int) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
+		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
@@ -283,7 +576,7 @@ func readFileLines(path string, startLine, count int) (string, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading file: %v", err)
+		return "", fmt.Errorf("error reading file: %w", err)
 	}
 
 	if linesRead == 0 {
@@ -307,7 +600,7 @@ func executeWriteFileDirect(args map[string]interface{}) (string, error) {
 
 	err := os.WriteFile(path, []byte(content), 0644)
 	if err != nil {
-		return "", fmt.Errorf("failed to write file: %v", err)
+		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
 	return fmt.Sprintf("Successfully wrote %d bytes to %s", len(content), path), nil
@@ -342,7 +635,7 @@ func extractInt(args map[string]interface{}, key string) (int, bool) {
 func readFileTail(path string, lines int) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
+		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
@@ -354,7 +647,7 @@ func readFileTail(path string, lines int) (string, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading file: %v", err)
+		return "", fmt.Errorf("error reading file: %w", err)
 	}
 
 	// 计算起始行
@@ -378,53 +671,10 @@ func readFileTail(path string, lines int) (string, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading file: %v", err)
+		return "", fmt.Errorf("error reading file: %w", err)
 	}
 
 	actualStart := startLine
 	actualEnd := totalLines
 	return fmt.Sprintf("[Lines %d-%d of %s (last %d lines)]\n%s", actualStart, actualEnd, path, lines, result.String()), nil
 }
-
-func executeGrep(args map[string]interface{}) (string, error) {
-	pattern, ok := args["pattern"].(string)
-	if !ok {
-		return "", fmt.Errorf("missing or invalid 'pattern' parameter")
-	}
-
-	// 兼容多种路径参数名：path, file_path, filename
-	path, ok := args["path"].(string)
-	if !ok {
-		path, ok = args["file_path"].(string)
-		if !ok {
-			path, ok = args["filename"].(string)
-			if !ok {
-				return "", fmt.Errorf("missing or invalid path parameter (tried: 'path', 'file_path', 'filename')")
-			}
-		}
-	}
-
-	// 转义特殊字符
-	pattern = strings.ReplaceAll(pattern, "\"", "\\\"")
-	path = strings.ReplaceAll(path, "\"", "\\\"")
-
-	if runtime.GOOS == "windows" {
-		return fmt.Sprintf("findstr /s /i \"%s\" \"%s\"", pattern, path), nil
-	}
-	return fmt.Sprintf("grep -r \"%s\" \"%s\"", pattern, path), nil
-}
-
-func executeListFiles(args map[string]interface{}) (string, error) {
-	path := "."
-	if p, ok := args["path"].(string); ok && p != "" {
-		path = p
-	}
-
-	// 转义特殊字符
-	path = strings.ReplaceAll(path, "\"", "\\\"")
-
-	if runtime.GOOS == "windows" {
-		return fmt.Sprintf("dir \"%s\"", path), nil
-	}
-	return fmt.Sprintf("ls -la \"%s\"", path), nil
-}
\ No newline at end of file
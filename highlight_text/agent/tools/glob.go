@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"highlight_text/agent/pathutil"
+)
+
+// pathFilter 一组 glob：不含 / 的 glob 匹配文件名，含 / 的匹配相对路径
+type pathFilter []*regexp.Regexp
+
+// newPathFilter 编译 glob 列表
+func newPathFilter(globs []string) (pathFilter, error) {
+	var filter pathFilter
+	for _, glob := range globs {
+		glob = strings.TrimPrefix(filepath.ToSlash(glob), "./")
+		if !strings.Contains(strings.TrimSuffix(glob, "/**"), "/") {
+			glob = "**/" + glob
+		}
+		re, err := pathutil.CompileGlob(glob)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, re)
+	}
+	return filter, nil
+}
+
+// match 判断相对路径（/ 分隔）是否匹配任意一个 glob
+func (f pathFilter) match(rel string) bool {
+	for _, re := range f {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hidden 判断路径是否对遍历目录的工具（grep、list_files、glob）隐藏，为nil时不隐藏
+// 由服务在启动时设置，用于跳过策略文件等不允许Agent访问的路径
+var Hidden func(path string) bool
+
+// skipped 遍历目录时跳过的项：.git 和 Hidden 的路径
+func skipped(path string, d fs.DirEntry) bool {
+	return d.Name() == ".git" || (Hidden != nil && Hidden(path))
+}
+
+// ignoreRule .gitignore 中的一条规则
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool // 以 ! 开头：重新包含之前被忽略的路径
+	dirOnly bool // 以 / 结尾：只匹配目录
+}
+
+// ignoreFile 一个 .gitignore 文件，规则相对于其所在目录
+type ignoreFile struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// gitignore 按 .gitignore 判断路径是否被忽略
+// 支持常用语法（注释、!、末尾 /、以 / 开头或中间含 / 的路径、**），后面的规则和更深目录中的规则优先
+type gitignore struct {
+	files []*ignoreFile
+}
+
+// newGitignore 加载从仓库根目录（向上查找 .git）到 root 路径上的 .gitignore，root 之下的在遍历时通过 enter 加载
+// root 不在 git 仓库中时只加载 root 自身的 .gitignore
+func newGitignore(root string) *gitignore {
+	g := &gitignore{}
+	var dirs []string
+	for dir := root; ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			dirs = dirs[:1]
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		g.enter(dirs[i])
+	}
+	return g
+}
+
+// enter 加载目录中的 .gitignore（如果存在）
+func (g *gitignore) enter(dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	file := &ignoreFile{dir: dir}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		re, err := pathutil.CompileGlob(line)
+		if err != nil {
+			continue
+		}
+		rule.re = re
+		file.rules = append(file.rules, rule)
+	}
+	g.files = append(g.files, file)
+}
+
+// ignored 判断绝对路径是否被忽略
+func (g *gitignore) ignored(abs string, isDir bool) bool {
+	if isDir && filepath.Base(abs) == ".git" {
+		return true
+	}
+	ignored := false
+	for _, file := range g.files {
+		rel, err := filepath.Rel(file.dir, abs)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range file.rules {
+			if (!rule.dirOnly || isDir) && rule.re.MatchString(rel) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// relSlash 返回 target 相对于 base 的 / 分隔路径
+func relSlash(base, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return filepath.ToSlash(target)
+	}
+	return path.Clean(filepath.ToSlash(rel))
+}
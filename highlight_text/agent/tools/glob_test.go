@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestPathFilter(t *testing.T) {
+	filter, err := newPathFilter([]string{"*.go", "./docs/**", "build/*.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"main.go", true},
+		{"cmd/server/main.go", true},
+		{"docs", true},
+		{"docs/a/b.md", true},
+		{"src/docs/a.md", true}, // docs/** 只有一级目录名，与不含 / 的 glob 一样匹配任意深度
+		{"build/out.txt", true},
+		{"build/sub/out.txt", false},
+		{"README.md", false},
+	}
+	for _, tt := range tests {
+		if got := filter.match(tt.rel); got != tt.want {
+			t.Errorf("match(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	repo := t.TempDir()
+	write := func(rel, data string) {
+		t.Helper()
+		path := filepath.Join(repo, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write(".gitignore", "# comment\n*.log\n!keep.log\nbuild/\n/root-only.txt\ndocs/*.tmp\r\n")
+	write("sub/.gitignore", "local.txt\n!*.log\n")
+
+	// 从子目录开始遍历时同样加载仓库根目录的 .gitignore
+	g := newGitignore(filepath.Join(repo, "sub"))
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"keep.log", false, false},
+		{"x/y/a.log", false, true},
+		{"build", true, true},
+		{"build", false, false},
+		{"x/build", true, true},
+		{"root-only.txt", false, true},
+		{"x/root-only.txt", false, false},
+		{"docs/a.tmp", false, true},
+		{"docs/x/a.tmp", false, false},
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+		{"sub/a.log", false, false},
+		{".git", true, true},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := g.ignored(filepath.Join(repo, filepath.FromSlash(tt.rel)), tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestGitignoreOutsideRepo(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "dir")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(parent, ".gitignore"), []byte("*.txt\n"), 0644)
+	os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.bin\n"), 0644)
+
+	// 不在 git 仓库中时只加载 root 自身的 .gitignore
+	g := newGitignore(root)
+	if !g.ignored(filepath.Join(root, "a.bin"), false) {
+		t.Error("a.bin should be ignored by root's .gitignore")
+	}
+	if g.ignored(filepath.Join(root, "a.txt"), false) {
+		t.Error("a.txt should not be ignored by the parent's .gitignore")
+	}
+}
+
+func TestSkippedHidden(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "secret"), 0755)
+	os.WriteFile(filepath.Join(dir, "secret", "a.txt"), []byte("needle\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("needle\n"), 0644)
+
+	Hidden = func(path string) bool { return filepath.Base(path) == "secret" }
+	defer func() { Hidden = nil }()
+
+	result, err := grepPath(dir, grepOptions{re: regexp.MustCompile("needle"), maxMatches: defaultGrepMatches})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].File != "b.txt" {
+		t.Errorf("grep matched %+v, want only b.txt", result.Matches)
+	}
+}
@@ -0,0 +1,255 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// grep 工具的限制
+const (
+	defaultGrepMatches = 100
+	maxGrepMatches     = 1000
+	maxGrepContext     = 10
+	grepMaxFileSize    = 10 << 20 // 超过该大小的文件不搜索
+	grepBinarySniff    = 8000     // 检查前若干字节是否含 NUL 以判断二进制文件
+	grepMaxLineLength  = 500      // 返回的每行最多保留的字节数
+)
+
+// GrepMatch 一处匹配，line 和 column 从 1 开始（column 按字符计）
+type GrepMatch struct {
+	File   string   `json:"file"` // 相对于搜索根目录的路径，搜索单个文件时为文件名
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"` // 匹配行之前的上下文
+	After  []string `json:"after,omitempty"`  // 匹配行之后的上下文
+}
+
+// GrepResult grep 工具的输出
+type GrepResult struct {
+	Root          string      `json:"root"`
+	Matches       []GrepMatch `json:"matches"`
+	FilesSearched int         `json:"files_searched"`
+	SkippedFiles  int         `json:"skipped_files,omitempty"` // 跳过的二进制文件和过大的文件
+	Truncated     bool        `json:"truncated,omitempty"`     // 达到 max_matches 或输出长度上限，还有未返回的匹配
+}
+
+type grepOptions struct {
+	re         *regexp.Regexp
+	include    pathFilter
+	exclude    pathFilter
+	context    int
+	maxMatches int
+	gitignore  bool
+}
+
+func executeGrep(args map[string]interface{}) (string, error) {
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return "", fmt.Errorf("missing or invalid 'pattern' parameter")
+	}
+	root := extractPath(args)
+	if root == "" {
+		return "", fmt.Errorf("missing or invalid path parameter (tried: 'path', 'file_path', 'filename')")
+	}
+
+	if extractBool(args, "literal", false) {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if extractBool(args, "ignore_case", false) {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %v", err)
+	}
+	opts := grepOptions{re: re, maxMatches: defaultGrepMatches, gitignore: extractBool(args, "gitignore", true)}
+	if opts.include, err = newPathFilter(extractStrings(args, "include")); err != nil {
+		return "", err
+	}
+	if opts.exclude, err = newPathFilter(extractStrings(args, "exclude")); err != nil {
+		return "", err
+	}
+	if n, ok := extractInt(args, "context"); ok && n > 0 {
+		opts.context = min(n, maxGrepContext)
+	}
+	if n, ok := extractInt(args, "max_matches"); ok && n > 0 {
+		opts.maxMatches = min(n, maxGrepMatches)
+	}
+
+	result, err := grepPath(root, opts)
+	if err != nil {
+		return "", err
+	}
+	return formatGrepResult(result), nil
+}
+
+// grepPath 搜索文件或目录（递归）
+func grepPath(root string, opts grepOptions) (*GrepResult, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	result := &GrepResult{Root: root, Matches: []GrepMatch{}}
+	if !info.IsDir() {
+		// 明确指定的文件不受 include/exclude 和 .gitignore 影响
+		grepFile(root, filepath.Base(root), info, opts, result)
+		return result, nil
+	}
+
+	var ignore *gitignore
+	if opts.gitignore {
+		ignore = newGitignore(root)
+	}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 无法读取的目录或文件跳过
+			return nil
+		}
+		if result.Truncated {
+			return filepath.SkipAll
+		}
+		if path == root {
+			return nil
+		}
+		rel := relSlash(root, path)
+		if d.IsDir() {
+			if skipped(path, d) || (ignore != nil && ignore.ignored(path, true)) || opts.exclude.match(rel) {
+				return filepath.SkipDir
+			}
+			if ignore != nil {
+				ignore.enter(path)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || skipped(path, d) || (ignore != nil && ignore.ignored(path, false)) || opts.exclude.match(rel) {
+			return nil
+		}
+		if len(opts.include) > 0 && !opts.include.match(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		grepFile(path, rel, info, opts, result)
+		return nil
+	})
+	return result, err
+}
+
+// grepFile 搜索单个文件，跳过二进制文件和过大的文件
+func grepFile(path, rel string, info fs.FileInfo, opts grepOptions, result *GrepResult) {
+	if info.Size() > grepMaxFileSize {
+		result.SkippedFiles++
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if bytes.IndexByte(data[:min(len(data), grepBinarySniff)], 0) >= 0 {
+		result.SkippedFiles++
+		return
+	}
+	result.FilesSearched++
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		loc := opts.re.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		if len(result.Matches) >= opts.maxMatches {
+			result.Truncated = true
+			return
+		}
+		match := GrepMatch{
+			File:   rel,
+			Line:   i + 1,
+			Column: utf8.RuneCountInString(line[:loc[0]]) + 1,
+			Text:   clipLine(line),
+		}
+		if opts.context > 0 {
+			match.Before = contextLines(lines, i-opts.context, i)
+			match.After = contextLines(lines, i+1, i+1+opts.context)
+		}
+		result.Matches = append(result.Matches, match)
+	}
+}
+
+// contextLines 返回 [from, to) 范围内的行（超出文件范围的部分忽略）
+func contextLines(lines []string, from, to int) []string {
+	from, to = max(from, 0), min(to, len(lines))
+	var out []string
+	for i := from; i < to; i++ {
+		out = append(out, clipLine(strings.TrimSuffix(lines[i], "\r")))
+	}
+	return out
+}
+
+// clipLine 截断过长的行（如压缩后的代码），避免单行占满输出
+func clipLine(line string) string {
+	if len(line) <= grepMaxLineLength {
+		return line
+	}
+	cut := grepMaxLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "…"
+}
+
+// formatGrepResult 将结果编码为JSON；超出输出长度上限时丢弃靠后的匹配，保证输出仍是完整的JSON
+func formatGrepResult(result *GrepResult) string {
+	limit := maxOutputTokens * 4
+	data, _ := json.Marshal(result)
+	for len(data) > limit && len(result.Matches) > 0 {
+		// 按超出的比例估算需要保留的匹配数，至少减少一个
+		keep := len(result.Matches) * limit / len(data)
+		if keep >= len(result.Matches) {
+			keep = len(result.Matches) - 1
+		}
+		result.Matches = result.Matches[:keep]
+		result.Truncated = true
+		data, _ = json.Marshal(result)
+	}
+	return truncateByTokens(string(data), maxOutputTokens)
+}
+
+// extractBool 从参数中提取布尔值，缺省时返回 def
+func extractBool(args map[string]interface{}, key string, def bool) bool {
+	if val, ok := args[key].(bool); ok {
+		return val
+	}
+	return def
+}
+
+// extractStrings 从参数中提取字符串列表，兼容单个字符串
+func extractStrings(args map[string]interface{}, key string) []string {
+	switch val := args[key].(type) {
+	case string:
+		if val != "" {
+			return []string{val}
+		}
+	case []interface{}:
+		var out []string
+		for _, item := range val {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	case []string:
+		return val
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package tools
+
+import "fmt"
+
+// 后台任务操作
+const (
+	JobRun    = "run"
+	JobOutput = "output"
+	JobStatus = "status"
+	JobKill   = "kill"
+)
+
+// maxJobOutputBytes job_output 一次最多读取的字节数，与其他工具的输出长度上限一致
+const maxJobOutputBytes = maxOutputTokens * 4
+
+// JobRequest 后台任务类工具（run_background、job_output、job_status、job_kill）解析后的参数
+type JobRequest struct {
+	Action   string
+	Command  string // run：要执行的命令
+	JobID    string // output、kill 必需；status 为空时列出所有任务
+	Offset   int64  // output：读取的起始偏移，负数表示读取最近的输出
+	MaxBytes int    // output：最多读取的字节数
+}
+
+func parseJobRequest(toolName string, args map[string]interface{}) (*JobRequest, error) {
+	jobID, _ := args["job_id"].(string)
+	switch toolName {
+	case "run_background":
+		command, ok := args["command"].(string)
+		if !ok || command == "" {
+			return nil, fmt.Errorf("missing or invalid 'command' parameter")
+		}
+		return &JobRequest{Action: JobRun, Command: command}, nil
+
+	case "job_status":
+		return &JobRequest{Action: JobStatus, JobID: jobID}, nil
+	}
+
+	if jobID == "" {
+		return nil, fmt.Errorf("missing or invalid 'job_id' parameter")
+	}
+	if toolName == "job_kill" {
+		return &JobRequest{Action: JobKill, JobID: jobID}, nil
+	}
+
+	req := &JobRequest{Action: JobOutput, JobID: jobID, Offset: -1, MaxBytes: maxJobOutputBytes}
+	if offset, ok := extractInt(args, "offset"); ok {
+		req.Offset = int64(offset)
+	}
+	if maxBytes, ok := extractInt(args, "max_bytes"); ok && maxBytes > 0 {
+		req.MaxBytes = min(maxBytes, maxJobOutputBytes)
+	}
+	return req, nil
+}
@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJobRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    string
+		args    map[string]interface{}
+		want    *JobRequest
+		wantErr string
+	}{
+		{"run", "run_background", map[string]interface{}{"command": "npm run dev"}, &JobRequest{Action: JobRun, Command: "npm run dev"}, ""},
+		{"run without command", "run_background", map[string]interface{}{}, nil, "'command'"},
+		{"status of all jobs", "job_status", map[string]interface{}{}, &JobRequest{Action: JobStatus}, ""},
+		{"status", "job_status", map[string]interface{}{"job_id": "job-1"}, &JobRequest{Action: JobStatus, JobID: "job-1"}, ""},
+		{"kill", "job_kill", map[string]interface{}{"job_id": "job-1"}, &JobRequest{Action: JobKill, JobID: "job-1"}, ""},
+		{"kill without job", "job_kill", map[string]interface{}{}, nil, "'job_id'"},
+		{
+			name: "output defaults",
+			tool: "job_output",
+			args: map[string]interface{}{"job_id": "job-1"},
+			want: &JobRequest{Action: JobOutput, JobID: "job-1", Offset: -1, MaxBytes: maxJobOutputBytes},
+		},
+		{
+			name: "output with offset",
+			tool: "job_output",
+			args: map[string]interface{}{"job_id": "job-1", "offset": float64(100), "max_bytes": float64(10)},
+			want: &JobRequest{Action: JobOutput, JobID: "job-1", Offset: 100, MaxBytes: 10},
+		},
+		{
+			name: "output max_bytes is clamped",
+			tool: "job_output",
+			args: map[string]interface{}{"job_id": "job-1", "max_bytes": float64(1 << 30)},
+			want: &JobRequest{Action: JobOutput, JobID: "job-1", Offset: -1, MaxBytes: maxJobOutputBytes},
+		},
+		{
+			name: "output ignores non-positive max_bytes",
+			tool: "job_output",
+			args: map[string]interface{}{"job_id": "job-1", "max_bytes": float64(0)},
+			want: &JobRequest{Action: JobOutput, JobID: "job-1", Offset: -1, MaxBytes: maxJobOutputBytes},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJobRequest(tt.tool, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseJobRequest() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJobRequest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"highlight_text/agent/pathutil"
+)
+
+// list_files 和 glob 工具的限制
+const (
+	defaultListDepth   = 1
+	maxListDepth       = 10
+	maxListEntries     = 20000 // 遍历的条目数上限，超过时停止遍历
+	defaultGlobResults = 200
+	maxGlobResults     = 1000
+)
+
+// 输出过长时依次尝试的每个目录列出的条目数
+var listDirLimits = []int{100, 50, 20, 10, 5, 3, 1}
+
+// FileEntry 目录中的一项，目录的 entries 为列出的子项（受深度和输出长度限制，可能不完整）
+type FileEntry struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"` // file、dir、symlink 或 other
+	Size     int64       `json:"size,omitempty"`
+	ModTime  time.Time   `json:"mtime"`
+	Target   string      `json:"target,omitempty"`   // 符号链接指向的路径
+	Children *int        `json:"children,omitempty"` // 目录中的子项数
+	Omitted  int         `json:"omitted,omitempty"`  // 因输出长度限制未列出的子项数
+	Entries  []FileEntry `json:"entries,omitempty"`
+}
+
+// ListResult list_files 工具的输出
+type ListResult struct {
+	Root      string      `json:"root"`
+	Depth     int         `json:"depth"` // 实际列出的深度，输出过长时可能小于请求的深度
+	Entries   []FileEntry `json:"entries"`
+	Omitted   int         `json:"omitted,omitempty"`   // 因输出长度限制未列出的顶层条目数
+	Total     int         `json:"total"`               // 请求的深度内的条目总数
+	Truncated bool        `json:"truncated,omitempty"` // 条目过多，遍历提前停止
+}
+
+// GlobMatch glob 工具匹配到的一项
+type GlobMatch struct {
+	Path    string    `json:"path"` // 相对于搜索根目录，/ 分隔
+	Type    string    `json:"type"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// GlobResult glob 工具的输出
+type GlobResult struct {
+	Root      string      `json:"root"`
+	Pattern   string      `json:"pattern"`
+	Matches   []GlobMatch `json:"matches"`
+	Total     int         `json:"total"`
+	Truncated bool        `json:"truncated,omitempty"` // 匹配数超过 max_results 或输出长度上限
+}
+
+// walkOptions 遍历目录时的过滤设置
+type walkOptions struct {
+	ignore    pathFilter
+	gitignore bool
+	sortBy    string // name、size 或 mtime
+}
+
+func parseWalkOptions(args map[string]interface{}) (walkOptions, error) {
+	opts := walkOptions{gitignore: extractBool(args, "gitignore", true), sortBy: "name"}
+	var err error
+	if opts.ignore, err = newPathFilter(extractStrings(args, "ignore")); err != nil {
+		return opts, err
+	}
+	if s, ok := args["sort"].(string); ok && s != "" {
+		if s != "name" && s != "size" && s != "mtime" {
+			return opts, fmt.Errorf("invalid sort: %s (expected name, size or mtime)", s)
+		}
+		opts.sortBy = s
+	}
+	return opts, nil
+}
+
+// listNode 遍历得到的目录树节点
+type listNode struct {
+	entry    FileEntry
+	children []*listNode
+	scanned  bool // 是否已读取子项（未超过深度）
+}
+
+func executeListFiles(args map[string]interface{}) (string, error) {
+	root := extractPath(args)
+	if root == "" {
+		return "", fmt.Errorf("missing or invalid 'path' parameter")
+	}
+	opts, err := parseWalkOptions(args)
+	if err != nil {
+		return "", err
+	}
+	include, err := newPathFilter(extractStrings(args, "include"))
+	if err != nil {
+		return "", err
+	}
+	depth := defaultListDepth
+	if n, ok := extractInt(args, "depth"); ok && n > 0 {
+		depth = min(n, maxListDepth)
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		data, _ := json.Marshal(ListResult{Root: root, Entries: []FileEntry{newFileEntry(filepath.Base(root), info, root)}, Total: 1})
+		return string(data), nil
+	}
+
+	var ignore *gitignore
+	if opts.gitignore {
+		ignore = newGitignore(root)
+	}
+	result := &ListResult{Root: root}
+	top := &listNode{}
+	scanDir(top, root, root, 1, depth, include, ignore, opts, result)
+	return formatListResult(result, top, depth), nil
+}
+
+// scanDir 读取目录的子项并递归到 maxDepth 层，子项按 opts.sortBy 排序
+func scanDir(node *listNode, root, dir string, depth, maxDepth int, include pathFilter, ignore *gitignore, opts walkOptions, result *ListResult) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	if ignore != nil && dir != root {
+		ignore.enter(dir)
+	}
+	node.scanned = true
+	for _, d := range entries {
+		path := filepath.Join(dir, d.Name())
+		rel := relSlash(root, path)
+		isDir := d.IsDir()
+		if (ignore != nil && ignore.ignored(path, isDir)) || skipped(path, d) || opts.ignore.match(rel) {
+			continue
+		}
+		if !isDir && len(include) > 0 && !include.match(rel) {
+			continue
+		}
+		if result.Total >= maxListEntries {
+			result.Truncated = true
+			break
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		result.Total++
+		child := &listNode{entry: newFileEntry(d.Name(), info, path)}
+		node.children = append(node.children, child)
+		if isDir && depth < maxDepth {
+			scanDir(child, root, path, depth+1, maxDepth, include, ignore, opts, result)
+		} else if isDir {
+			// 超过深度的目录只统计子项数
+			if sub, err := os.ReadDir(path); err == nil {
+				n := len(sub)
+				child.entry.Children = &n
+			}
+		}
+	}
+	n := len(node.children)
+	node.entry.Children = &n
+	sortNodes(node.children, opts.sortBy)
+}
+
+// newFileEntry 根据文件信息构造条目
+func newFileEntry(name string, info fs.FileInfo, path string) FileEntry {
+	entry := FileEntry{Name: name, ModTime: info.ModTime().Truncate(time.Second)}
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		entry.Type = "dir"
+	case mode.IsRegular():
+		entry.Type = "file"
+		entry.Size = info.Size()
+	case mode&fs.ModeSymlink != 0:
+		entry.Type = "symlink"
+		entry.Target, _ = os.Readlink(path)
+	default:
+		entry.Type = "other"
+	}
+	return entry
+}
+
+// sortNodes 排序：name 按名称（目录在前），path 按名称，size 和 mtime 按从大到小、从新到旧
+func sortNodes(nodes []*listNode, sortBy string) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i].entry, nodes[j].entry
+		switch sortBy {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		case "mtime":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.After(b.ModTime)
+			}
+		case "name":
+			if (a.Type == "dir") != (b.Type == "dir") {
+				return a.Type == "dir"
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// render 生成最多 depth 层、每个目录最多 limit 项的条目，未列出的子项计入 omitted
+func (n *listNode) render(depth, limit int) []FileEntry {
+	var out []FileEntry
+	for i, child := range n.children {
+		if limit > 0 && i >= limit {
+			break
+		}
+		entry := child.entry
+		if child.scanned && depth > 1 {
+			entry.Entries = child.render(depth-1, limit)
+			entry.Omitted = len(child.children) - len(entry.Entries)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// formatListResult 将结果编码为JSON；超出输出长度上限时先减少每个目录列出的条目数，再减少深度
+func formatListResult(result *ListResult, top *listNode, depth int) string {
+	limit := maxOutputTokens * 4
+	encode := func(d, perDir int) []byte {
+		result.Depth = d
+		result.Entries = top.render(d, perDir)
+		if result.Entries == nil {
+			result.Entries = []FileEntry{}
+		}
+		result.Omitted = len(top.children) - len(result.Entries)
+		data, _ := json.Marshal(result)
+		return data
+	}
+
+	data := encode(depth, 0)
+	for d := depth; len(data) > limit && d >= 1; d-- {
+		for _, perDir := range listDirLimits {
+			if data = encode(d, perDir); len(data) <= limit {
+				break
+			}
+		}
+	}
+	return truncateByTokens(string(data), maxOutputTokens)
+}
+
+func executeGlob(args map[string]interface{}) (string, error) {
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return "", fmt.Errorf("missing or invalid 'pattern' parameter")
+	}
+	root := extractPath(args)
+	if root == "" {
+		return "", fmt.Errorf("missing or invalid 'path' parameter")
+	}
+	opts, err := parseWalkOptions(args)
+	if err != nil {
+		return "", err
+	}
+	re, err := pathutil.CompileGlob(strings.TrimPrefix(filepath.ToSlash(pattern), "./"))
+	if err != nil {
+		return "", err
+	}
+	maxResults := defaultGlobResults
+	if n, ok := extractInt(args, "max_results"); ok && n > 0 {
+		maxResults = min(n, maxGlobResults)
+	}
+
+	var ignore *gitignore
+	if opts.gitignore {
+		ignore = newGitignore(root)
+	}
+	result := &GlobResult{Root: root, Pattern: pattern, Matches: []GlobMatch{}}
+	var nodes []*listNode
+	visited := 0
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if visited++; visited > maxListEntries {
+			result.Truncated = true
+			return filepath.SkipAll
+		}
+		rel := relSlash(root, path)
+		if skipped(path, d) || (ignore != nil && ignore.ignored(path, d.IsDir())) || opts.ignore.match(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && ignore != nil {
+			ignore.enter(path)
+		}
+		if !re.MatchString(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		nodes = append(nodes, &listNode{entry: newFileEntry(rel, info, path)})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	result.Total = len(nodes)
+	sortBy := opts.sortBy
+	if sortBy == "name" {
+		sortBy = "path" // 按路径排序，目录不提前
+	}
+	sortNodes(nodes, sortBy)
+	if len(nodes) > maxResults {
+		nodes = nodes[:maxResults]
+		result.Truncated = true
+	}
+	for _, n := range nodes {
+		result.Matches = append(result.Matches, GlobMatch{Path: n.entry.Name, Type: n.entry.Type, Size: n.entry.Size, ModTime: n.entry.ModTime})
+	}
+
+	// 超出输出长度上限时丢弃靠后的匹配，保证输出仍是完整的JSON
+	limit := maxOutputTokens * 4
+	data, _ := json.Marshal(result)
+	for len(data) > limit && len(result.Matches) > 0 {
+		keep := min(len(result.Matches)*limit/len(data), len(result.Matches)-1)
+		result.Matches = result.Matches[:keep]
+		result.Truncated = true
+		data, _ = json.Marshal(result)
+	}
+	return truncateByTokens(string(data), maxOutputTokens), nil
+}
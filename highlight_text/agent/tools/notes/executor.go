@@ -3,11 +3,14 @@ package notes
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
+
+	"highlight_text/agent/tools"
 )
 
 // Note 表示一篇笔记
@@ -290,7 +293,7 @@ func ExecuteKnowledgeTool(toolName string, args map[string]interface{}, knowledg
 	case "update_todo_list":
 		return updateTodoList(args)
 	default:
-		return "", fmt.Errorf("未知的知识库工具: %s", toolName)
+		return "", fmt.Errorf("未知的知识库工具: %s: %w", toolName, tools.ErrUnknownTool)
 	}
 }
 
@@ -406,7 +409,7 @@ func searchNotes(args map[string]interface{}, basePath string) (string, error) {
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("搜索失败: %v", err)
+		return "", fmt.Errorf("搜索失败: %w", err)
 	}
 
 	if len(results) == 0 {
@@ -441,7 +444,7 @@ func readNote(args map[string]interface{}, basePath string) (string, error) {
 
 	content, err := os.ReadFile(notePath)
 	if err != nil {
-		return "", fmt.Errorf("读取笔记失败: %v", err)
+		return "", fmt.Errorf("读取笔记失败: %w", err)
 	}
 
 	contentStr := string(content)
@@ -563,12 +566,12 @@ func updateNote(args map[string]interface{}, basePath string) (string, error) {
 	// 确保目录存在
 	noteDir := filepath.Dir(notePath)
 	if err := os.MkdirAll(noteDir, 0755); err != nil {
-		return "", fmt.Errorf("创建目录失败: %v", err)
+		return "", fmt.Errorf("创建目录失败: %w", err)
 	}
 
 	err = os.WriteFile(notePath, []byte(finalContent), 0644)
 	if err != nil {
-		return "", fmt.Errorf("更新笔记失败: %v", err)
+		return "", fmt.Errorf("更新笔记失败: %w", err)
 	}
 
 	// 计算diff（基于纯文本内容，不包含Front Matter）
@@ -586,7 +589,7 @@ func updateNote(args map[string]interface{}, basePath string) (string, error) {
 
 	resultJSON, err := json.Marshal(result)
 	if err != nil {
-		return "", fmt.Errorf("序列化结果失败: %v", err)
+		return "", fmt.Errorf("序列化结果失败: %w", err)
 	}
 
 	return string(resultJSON), nil
@@ -621,20 +624,20 @@ func createNote(args map[string]interface{}, basePath string) (string, error) {
 
 	// 检查是否已存在
 	if _, err := os.Stat(notePath); err == nil {
-		return "", fmt.Errorf("笔记 '%s' 已存在", strings.TrimSuffix(noteID, ".md"))
+		return "", fmt.Errorf("笔记 '%s' 已存在: %w", strings.TrimSuffix(noteID, ".md"), fs.ErrExist)
 	}
 
 	// 确保父目录存在
 	parentDir := filepath.Dir(notePath)
 	if err := os.MkdirAll(parentDir, 0755); err != nil {
-		return "", fmt.Errorf("创建目录失败: %v", err)
+		return "", fmt.Errorf("创建目录失败: %w", err)
 	}
 
 	// 创建笔记，添加标题作为第一行
 	fullContent := fmt.Sprintf("# %s\n\n%s", title, content)
 	err = os.WriteFile(notePath, []byte(fullContent), 0644)
 	if err != nil {
-		return "", fmt.Errorf("创建笔记失败: %v", err)
+		return "", fmt.Errorf("创建笔记失败: %w", err)
 	}
 
 	// 计算diff（与空内容对比）
@@ -652,7 +655,7 @@ func createNote(args map[string]interface{}, basePath string) (string, error) {
 
 	resultJSON, err := json.Marshal(result)
 	if err != nil {
-		return "", fmt.Errorf("序列化结果失败: %v", err)
+		return "", fmt.Errorf("序列化结果失败: %w", err)
 	}
 
 	return string(resultJSON), nil
@@ -663,7 +666,7 @@ func listNotes(basePath string) (string, error) {
 	// 构建文件树
 	tree, err := buildFileTree(basePath, "")
 	if err != nil {
-		return "", fmt.Errorf("构建文件树失败: %v", err)
+		return "", fmt.Errorf("构建文件树失败: %w", err)
 	}
 
 	// 如果是根目录节点，返回其子节点
@@ -680,7 +683,7 @@ func listNotes(basePath string) (string, error) {
 
 	resultJSON, err := json.MarshalIndent(nodes, "", "  ")
 	if err != nil {
-		return "", fmt.Errorf("序列化失败: %v", err)
+		return "", fmt.Errorf("序列化失败: %w", err)
 	}
 
 	// 计算文件总数
@@ -731,6 +734,9 @@ func sanitizeFileName(title string) string {
 	return replacer.Replace(title)
 }
 
+// frontMatterRegex 匹配文件开头的YAML Front Matter
+var frontMatterRegex = regexp.MustCompile(`^---\s*\n([\s\S]*?)\n---\s*\n`)
+
 // parseFrontMatter 解析YAML Front Matter
 func parseFrontMatter(content string) (map[string]interface{}, string, []string) {
 	metadata := make(map[string]interface{})
@@ -738,8 +744,7 @@ func parseFrontMatter(content string) (map[string]interface{}, string, []string)
 	plainContent := content
 
 	// 检查是否有YAML Front Matter (以 --- 开头和结尾)
-	yamlRegex := regexp.MustCompile(`^---\s*\n([\s\S]*?)\n---\s*\n`)
-	matches := yamlRegex.FindStringSubmatch(content)
+	matches := frontMatterRegex.FindStringSubmatch(content)
 
 	if len(matches) > 1 {
 		yamlContent := matches[1]
@@ -804,6 +809,61 @@ func parseFrontMatter(content string) (map[string]interface{}, string, []string)
 	return metadata, plainContent, tags
 }
 
+// CheckFrontMatter 遍历知识库中的Markdown笔记，返回 Front Matter 格式有误（解析时会被忽略）的文件
+func CheckFrontMatter(basePath string) ([]tools.FileIssue, error) {
+	var issues []tools.FileIssue
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // 无法访问的条目不影响其他文件的检查
+		}
+		if path != basePath && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(strings.ToLower(d.Name()), ".md") {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		if reason := frontMatterProblem(string(content)); reason != "" {
+			relPath, _ := filepath.Rel(basePath, path)
+			issues = append(issues, tools.FileIssue{Path: filepath.ToSlash(relPath), Reason: reason})
+		}
+		return nil
+	})
+	return issues, err
+}
+
+// frontMatterProblem 检查 Front Matter 格式，返回问题描述（没有 Front Matter 或格式正确时返回空字符串）
+func frontMatterProblem(content string) string {
+	firstLine, _, _ := strings.Cut(content, "\n")
+	if strings.TrimSpace(firstLine) != "---" {
+		return ""
+	}
+
+	matches := frontMatterRegex.FindStringSubmatch(content)
+	if matches == nil {
+		return "Front Matter 未闭合（缺少单独成行的结束 ---）"
+	}
+
+	for i, line := range strings.Split(matches[1], "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "- ") {
+			continue
+		}
+		if !strings.Contains(line, ":") {
+			// 第1行是开头的 ---
+			return fmt.Sprintf("第 %d 行无法解析（应为 key: value）: %s", i+2, line)
+		}
+	}
+	return ""
+}
+
 // isSupportedFileType 检查文件是否为支持的类型
 func isSupportedFileType(filename string) bool {
 	supportedExts := []string{".md", ".txt", ".pdf", ".log", ".json", ".yaml", ".yml", ".toml", ".xml", ".csv"}
@@ -1066,7 +1126,7 @@ func sanitizePath(basePath string, userPath string) (string, error) {
 
 	// 检查是否在允许的目录内
 	if !strings.HasPrefix(absFullPath, absBasePath) {
-		return "", fmt.Errorf("路径访问被拒绝: 路径在知识库目录之外")
+		return "", fmt.Errorf("路径在知识库目录之外: %w", tools.ErrPathDenied)
 	}
 
 	return fullPath, nil
@@ -1077,13 +1137,13 @@ func DeleteNote(path, itemType, basePath string) error {
 	// 验证路径
 	fullPath, err := sanitizePath(basePath, path)
 	if err != nil {
-		return fmt.Errorf("路径无效: %v", err)
+		return fmt.Errorf("路径无效: %w", err)
 	}
 
 	// 检查路径是否存在
 	info, err := os.Stat(fullPath)
 	if err != nil {
-		return fmt.Errorf("路径不存在: %v", err)
+		return fmt.Errorf("路径不存在: %w", err)
 	}
 
 	// 验证类型匹配
@@ -1104,7 +1164,7 @@ func DeleteNote(path, itemType, basePath string) error {
 	}
 
 	if err != nil {
-		return fmt.Errorf("删除失败: %v", err)
+		return fmt.Errorf("删除失败: %w", err)
 	}
 
 	return nil
@@ -1115,7 +1175,7 @@ func MoveNote(sourcePath, destFolderPath, basePath string) error {
 	// 验证源路径
 	fullSourcePath, err := sanitizePath(basePath, sourcePath)
 	if err != nil {
-		return fmt.Errorf("源路径无效: %v", err)
+		return fmt.Errorf("源路径无效: %w", err)
 	}
 
 	// 验证目标路径（空字符串表示根目录）
@@ -1126,20 +1186,20 @@ func MoveNote(sourcePath, destFolderPath, basePath string) error {
 	} else {
 		fullDestFolderPath, err = sanitizePath(basePath, destFolderPath)
 		if err != nil {
-			return fmt.Errorf("目标路径无效: %v", err)
+			return fmt.Errorf("目标路径无效: %w", err)
 		}
 	}
 
 	// 检查源路径是否存在
 	sourceInfo, err := os.Stat(fullSourcePath)
 	if err != nil {
-		return fmt.Errorf("源路径不存在: %v", err)
+		return fmt.Errorf("源路径不存在: %w", err)
 	}
 
 	// 检查目标文件夹是否存在
 	destInfo, err := os.Stat(fullDestFolderPath)
 	if err != nil {
-		return fmt.Errorf("目标文件夹不存在: %v", err)
+		return fmt.Errorf("目标文件夹不存在: %w", err)
 	}
 
 	// 确保目标是文件夹
@@ -1153,7 +1213,7 @@ func MoveNote(sourcePath, destFolderPath, basePath string) error {
 
 	// 检查目标位置是否已存在同名文件
 	if _, err := os.Stat(newFullPath); err == nil {
-		return fmt.Errorf("目标位置已存在同名文件: %s", sourceName)
+		return fmt.Errorf("目标位置已存在同名文件: %s: %w", sourceName, fs.ErrExist)
 	}
 
 	// 执行移动
@@ -1166,7 +1226,7 @@ func MoveNote(sourcePath, destFolderPath, basePath string) error {
 	}
 
 	if err != nil {
-		return fmt.Errorf("移动失败: %v", err)
+		return fmt.Errorf("移动失败: %w", err)
 	}
 
 	return nil
@@ -1203,7 +1263,7 @@ func readLines(args map[string]interface{}, basePath string) (string, error) {
 	// 读取文件
 	content, err := os.ReadFile(notePath)
 	if err != nil {
-		return "", fmt.Errorf("读取笔记失败: %v", err)
+		return "", fmt.Errorf("读取笔记失败: %w", err)
 	}
 
 	// 解析并跳过 Front Matter
@@ -1291,7 +1351,7 @@ func replaceLines(args map[string]interface{}, basePath string) (string, error)
 	// 读取原文件
 	originalFileContent, err := os.ReadFile(notePath)
 	if err != nil {
-		return "", fmt.Errorf("读取笔记失败: %v", err)
+		return "", fmt.Errorf("读取笔记失败: %w", err)
 	}
 
 	originalStr := string(originalFileContent)
@@ -1326,7 +1386,7 @@ func replaceLines(args map[string]interface{}, basePath string) (string, error)
 	// 写回文件
 	err = os.WriteFile(notePath, []byte(finalContent), 0644)
 	if err != nil {
-		return "", fmt.Errorf("写入笔记失败: %v", err)
+		return "", fmt.Errorf("写入笔记失败: %w", err)
 	}
 
 	// 计算diff
@@ -1377,7 +1437,7 @@ func insertLines(args map[string]interface{}, basePath string) (string, error) {
 	// 读取原文件
 	originalFileContent, err := os.ReadFile(notePath)
 	if err != nil {
-		return "", fmt.Errorf("读取笔记失败: %v", err)
+		return "", fmt.Errorf("读取笔记失败: %w", err)
 	}
 
 	originalStr := string(originalFileContent)
@@ -1414,7 +1474,7 @@ func insertLines(args map[string]interface{}, basePath string) (string, error) {
 	// 写回文件
 	err = os.WriteFile(notePath, []byte(finalContent), 0644)
 	if err != nil {
-		return "", fmt.Errorf("写入笔记失败: %v", err)
+		return "", fmt.Errorf("写入笔记失败: %w", err)
 	}
 
 	// 计算diff
@@ -1465,7 +1525,7 @@ func deleteLines(args map[string]interface{}, basePath string) (string, error) {
 	// 读取原文件
 	originalFileContent, err := os.ReadFile(notePath)
 	if err != nil {
-		return "", fmt.Errorf("读取笔记失败: %v", err)
+		return "", fmt.Errorf("读取笔记失败: %w", err)
 	}
 
 	originalStr := string(originalFileContent)
@@ -1502,7 +1562,7 @@ func deleteLines(args map[string]interface{}, basePath string) (string, error) {
 	// 写回文件
 	err = os.WriteFile(notePath, []byte(finalContent), 0644)
 	if err != nil {
-		return "", fmt.Errorf("写入笔记失败: %v", err)
+		return "", fmt.Errorf("写入笔记失败: %w", err)
 	}
 
 	// 计算diff
@@ -1599,7 +1659,7 @@ func AppendToFollowupNote(selectedText, question, answer, pdfFileName, basePath
 	mdFileName := pdfFileName + ".md"
 	mdPath, err := sanitizePath(basePath, mdFileName)
 	if err != nil {
-		return fmt.Errorf("路径无效: %v", err)
+		return fmt.Errorf("路径无效: %w", err)
 	}
 
 	// 检查md文件是否存在
@@ -1626,13 +1686,13 @@ func AppendToFollowupNote(selectedText, question, answer, pdfFileName, basePath
 	// 确保目录存在
 	mdDir := filepath.Dir(mdPath)
 	if err := os.MkdirAll(mdDir, 0755); err != nil {
-		return fmt.Errorf("创建目录失败: %v", err)
+		return fmt.Errorf("创建目录失败: %w", err)
 	}
 
 	// 写入文件
 	err = os.WriteFile(mdPath, []byte(newContent), 0644)
 	if err != nil {
-		return fmt.Errorf("写入文件失败: %v", err)
+		return fmt.Errorf("写入文件失败: %w", err)
 	}
 
 	return nil
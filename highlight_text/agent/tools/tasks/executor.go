@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"highlight_text/agent/tools"
 )
 
 // Task 表示一个任务
@@ -216,7 +218,7 @@ func ExecuteTaskTool(toolName string, args map[string]interface{}, tasksBasePath
 	case "delete_task":
 		return deleteTask(args, tasksBasePath)
 	default:
-		return "", fmt.Errorf("未知的任务工具: %s", toolName)
+		return "", fmt.Errorf("未知的任务工具: %s: %w", toolName, tools.ErrUnknownTool)
 	}
 }
 
@@ -289,7 +291,7 @@ func createTask(args map[string]interface{}, basePath string) (string, error) {
 
 	// 确保 _tasks 目录存在
 	if err := os.MkdirAll(basePath, 0755); err != nil {
-		return "", fmt.Errorf("创建任务目录失败: %v", err)
+		return "", fmt.Errorf("创建任务目录失败: %w", err)
 	}
 
 	// 写入文件
@@ -297,7 +299,7 @@ func createTask(args map[string]interface{}, basePath string) (string, error) {
 	fileContent := buildTaskFileContent(task)
 
 	if err := os.WriteFile(taskPath, []byte(fileContent), 0644); err != nil {
-		return "", fmt.Errorf("创建任务文件失败: %v", err)
+		return "", fmt.Errorf("创建任务文件失败: %w", err)
 	}
 
 	// 返回结果
@@ -320,7 +322,7 @@ func listTasks(args map[string]interface{}, basePath string) (string, error) {
 		if os.IsNotExist(err) {
 			return "[]", nil // 目录不存在，返回空数组
 		}
-		return "", fmt.Errorf("读取任务目录失败: %v", err)
+		return "", fmt.Errorf("读取任务目录失败: %w", err)
 	}
 
 	var tasks []Task
@@ -374,7 +376,7 @@ func updateTask(args map[string]interface{}, basePath string) (string, error) {
 	taskPath := filepath.Join(basePath, taskID+".md")
 	task, err := parseTaskFile(taskPath)
 	if err != nil {
-		return "", fmt.Errorf("读取任务失败: %v", err)
+		return "", fmt.Errorf("读取任务失败: %w", err)
 	}
 
 	// 应用更新
@@ -437,7 +439,7 @@ func updateTask(args map[string]interface{}, basePath string) (string, error) {
 	// 写回文件
 	fileContent := buildTaskFileContent(task)
 	if err := os.WriteFile(taskPath, []byte(fileContent), 0644); err != nil {
-		return "", fmt.Errorf("更新任务文件失败: %v", err)
+		return "", fmt.Errorf("更新任务文件失败: %w", err)
 	}
 
 	// 返回结果
@@ -462,7 +464,7 @@ func deleteTask(args map[string]interface{}, basePath string) (string, error) {
 	// 步骤1: 加载所有任务以构建父子关系
 	allTasks, err := loadAllTasks(basePath)
 	if err != nil {
-		return "", fmt.Errorf("加载任务列表失败: %v", err)
+		return "", fmt.Errorf("加载任务列表失败: %w", err)
 	}
 
 	// 步骤2: 构建任务ID到任务对象的映射
@@ -482,7 +484,7 @@ func deleteTask(args map[string]interface{}, basePath string) (string, error) {
 		if err := os.Remove(taskPath); err != nil {
 			// 如果文件不存在，继续删除其他文件
 			if !os.IsNotExist(err) {
-				return "", fmt.Errorf("删除任务 %s 失败: %v", id, err)
+				return "", fmt.Errorf("删除任务 %s 失败: %w", id, err)
 			}
 		} else {
 			deletedCount++
@@ -529,6 +531,28 @@ func loadAllTasks(basePath string) ([]Task, error) {
 	return tasks, nil
 }
 
+// CheckTaskFiles 检查任务目录，返回列表和加载时会被跳过的文件及原因
+func CheckTaskFiles(basePath string) ([]tools.FileIssue, error) {
+	files, err := os.ReadDir(basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var issues []tools.FileIssue
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".md") {
+			continue
+		}
+		if _, err := parseTaskFile(filepath.Join(basePath, file.Name())); err != nil {
+			issues = append(issues, tools.FileIssue{Path: file.Name(), Reason: err.Error()})
+		}
+	}
+	return issues, nil
+}
+
 // collectTasksToDelete 递归收集所有需要删除的任务ID
 func collectTasksToDelete(taskID string, taskMap map[string]Task, result *[]string) {
 	// 添加当前任务
@@ -553,63 +577,69 @@ func parseTaskFile(filePath string) (Task, error) {
 	contentStr := string(content)
 	task := Task{}
 
-	// 解析 YAML Front Matter
-	if strings.HasPrefix(contentStr, "---\n") {
-		parts := strings.SplitN(contentStr, "---\n", 3)
-		if len(parts) >= 3 {
-			yamlContent := parts[1]
-			task.Content = strings.TrimSpace(parts[2])
-
-			// 简单的 YAML 解析
-			lines := strings.Split(yamlContent, "\n")
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "#") {
-					continue
-				}
+	// 解析 YAML Front Matter（任务文件必须包含，且至少有 id 字段）
+	if !strings.HasPrefix(contentStr, "---\n") {
+		return Task{}, fmt.Errorf("缺少 YAML Front Matter")
+	}
+	parts := strings.SplitN(contentStr, "---\n", 3)
+	if len(parts) < 3 {
+		return Task{}, fmt.Errorf("Front Matter 未闭合（缺少结束的 ---）")
+	}
+	yamlContent := parts[1]
+	task.Content = strings.TrimSpace(parts[2])
+
+	// 简单的 YAML 解析
+	lines := strings.Split(yamlContent, "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
 
-				keyValue := strings.SplitN(line, ":", 2)
-				if len(keyValue) == 2 {
-					key := strings.TrimSpace(keyValue[0])
-					value := strings.TrimSpace(keyValue[1])
-					value = strings.Trim(value, "\"'")
-
-					switch key {
-					case "id":
-						task.ID = value
-					case "title":
-						task.Title = value
-					case "type":
-						task.Type = value
-					case "color":
-						task.Color = value
-					case "status":
-						task.Status = value
-					case "project":
-						task.Project = value
-					case "parent_id":
-						task.ParentID = value
-					case "progress":
-						// 解析进度为整数
-						if progress, err := fmt.Sscanf(value, "%d", new(int)); err == nil && progress == 1 {
-							task.Progress = *new(int)
-						}
-					case "dtstart":
-						task.DtStart = value
-					case "dtend":
-						task.DtEnd = value
-					case "created_at":
-						task.CreatedAt = value
-					case "updated_at":
-						task.UpdatedAt = value
-					case "completed_at":
-						task.CompletedAt = value
-					}
+		keyValue := strings.SplitN(line, ":", 2)
+		if len(keyValue) == 2 {
+			key := strings.TrimSpace(keyValue[0])
+			value := strings.TrimSpace(keyValue[1])
+			value = strings.Trim(value, "\"'")
+
+			switch key {
+			case "id":
+				task.ID = value
+			case "title":
+				task.Title = value
+			case "type":
+				task.Type = value
+			case "color":
+				task.Color = value
+			case "status":
+				task.Status = value
+			case "project":
+				task.Project = value
+			case "parent_id":
+				task.ParentID = value
+			case "progress":
+				// 解析进度为整数
+				if progress, err := fmt.Sscanf(value, "%d", new(int)); err == nil && progress == 1 {
+					task.Progress = *new(int)
 				}
+			case "dtstart":
+				task.DtStart = value
+			case "dtend":
+				task.DtEnd = value
+			case "created_at":
+				task.CreatedAt = value
+			case "updated_at":
+				task.UpdatedAt = value
+			case "completed_at":
+				task.CompletedAt = value
 			}
 		}
 	}
 
+	if task.ID == "" {
+		return Task{}, fmt.Errorf("Front Matter 缺少 id 字段")
+	}
+
 	return task, nil
 }
 
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"highlight_text/agent/terminal"
+	"highlight_text/agent/tools"
+)
+
+// API版本前缀
+const apiV1Prefix = "/api/v1"
+
+// API错误码（机器可读）
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidJSON      = "invalid_json"
+	CodeUnauthorized     = "unauthorized"
+	CodeOriginDenied     = "origin_denied"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodePathDenied       = "path_denied"
+	CodeConflict         = "conflict"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeInvalidConfig    = "invalid_config"
+	CodeUnknownTool      = "unknown_tool"
+	CodeToolFailed       = "tool_failed"
+	CodeTerminalError    = "terminal_error"
+	CodeCommandTimeout   = "command_timeout"
+	CodeCommandCanceled  = "command_canceled"
+	CodeTooManySessions  = "too_many_sessions"
+	CodeTooManyJobs      = "too_many_jobs"
+	CodeSandboxViolation = "sandbox_violation"
+	CodePolicyDenied     = "policy_denied"
+	CodeInternal         = "internal_error"
+)
+
+// 请求体大小上限（可通过配置文件的 body_limits 按路由覆盖）
+const (
+	defaultBodyLimit = 1 << 20  // 普通JSON请求
+	agentBodyLimit   = 4 << 20  // Agent工具调用（可能携带整篇文件内容）
+	noteBodyLimit    = 16 << 20 // 笔记全文
+	logBodyLimit     = 8 << 20  // Agent会话日志、HTML预览
+	uploadBodyLimit  = 10 << 20 // 图片上传
+)
+
+// APIError 统一的错误响应格式
+// 保留 success/error 字段以兼容前端现有的判断逻辑
+type APIError struct {
+	Success bool   `json:"success"`
+	Code    string `json:"code"`
+	Error   string `json:"error"`
+
+	Details []string `json:"details,omitempty"` // 可选的详细信息，如配置校验失败的各项原因
+}
+
+// writeJSON 以指定状态码输出JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 输出统一格式的错误响应
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, APIError{
+		Success: false,
+		Code:    code,
+		Error:   message,
+	})
+}
+
+// classifyError 将工具或文件系统错误映射为HTTP状态码和错误码
+func classifyError(err error) (int, string) {
+	switch {
+	case errors.Is(err, tools.ErrUnknownTool):
+		return http.StatusBadRequest, CodeUnknownTool
+	case errors.Is(err, tools.ErrPathDenied), errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden, CodePathDenied
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, fs.ErrExist), errors.Is(err, tools.ErrFileChanged):
+		return http.StatusConflict, CodeConflict
+	default:
+		return http.StatusUnprocessableEntity, CodeToolFailed
+	}
+}
+
+// classifyTerminalError 将终端命令执行错误映射为HTTP状态码和错误码
+func classifyTerminalError(err error) (int, string) {
+	switch {
+	case errors.Is(err, terminal.ErrCommandTimeout):
+		return http.StatusGatewayTimeout, CodeCommandTimeout
+	case errors.Is(err, terminal.ErrCommandCanceled):
+		return http.StatusConflict, CodeCommandCanceled
+	case errors.Is(err, terminal.ErrSandboxViolation):
+		return http.StatusForbidden, CodeSandboxViolation
+	default:
+		return http.StatusInternalServerError, CodeTerminalError
+	}
+}
+
+// decodeJSON 流式解码JSON请求体，失败时输出错误响应并返回false
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeBodyError(w, err, CodeInvalidJSON, "Invalid JSON")
+		return false
+	}
+	return true
+}
+
+// writeBodyError 请求体超过上限时输出413，其他读取或解析错误输出400
+func writeBodyError(w http.ResponseWriter, err error, code, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge,
+			fmt.Sprintf("Request body too large (limit %d bytes)", tooLarge.Limit))
+		return
+	}
+	writeError(w, http.StatusBadRequest, code, message)
+}
+
+// writeToolError 根据错误类型输出统一格式的错误响应
+func writeToolError(w http.ResponseWriter, err error) {
+	status, code := classifyError(err)
+	writeError(w, status, code, err.Error())
+}
+
+// apiRoute 描述一个API路由，同时用于生成OpenAPI文档
+type apiRoute struct {
+	path      string   // /api/v1 之下的路径，支持 {name...} 通配
+	methods   []string // 允许的HTTP方法
+	handler   http.HandlerFunc
+	legacy    []string    // 旧版路由（保留为别名）
+	summary   string      // 接口说明
+	query     []string    // 查询参数
+	request   interface{} // 请求体：Go类型的零值，或直接给出的JSON Schema（map）
+	response  interface{} // 成功响应体（可选），格式同 request
+	multipart bool        // 请求体为 multipart/form-data
+	bodyLimit int64       // 请求体大小上限，0 表示使用默认上限
+}
+
+// 图片上传的multipart表单结构
+var imageUploadForm = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"image":        map[string]interface{}{"type": "string", "format": "binary"},
+		"storage_mode": map[string]interface{}{"type": "string", "enum": []string{"fixed", "relative"}},
+		"note_id":      map[string]interface{}{"type": "string"},
+	},
+	"required": []string{"image"},
+}
+
+// apiRoutes 所有API路由
+var apiRoutes = []apiRoute{
+	// 交互日志、HTML预览、图片上传
+	{path: "/log", methods: []string{"POST"}, handler: handleLog, legacy: []string{"/log"},
+		summary: "记录一条交互日志", request: InteractionLog{}},
+	{path: "/preview", methods: []string{"GET", "POST"}, handler: handlePreview, legacy: []string{"/preview"},
+		summary: "HTML预览：GET返回预览页面，POST原样返回提交的HTML", request: PreviewRequest{}, bodyLimit: logBodyLimit},
+	{path: "/upload-image", methods: []string{"POST"}, handler: handleImageUpload, legacy: []string{"/upload-image"},
+		summary: "上传聊天图片", request: imageUploadForm, multipart: true, bodyLimit: uploadBodyLimit},
+
+	// 终端Agent
+	{path: "/agent/execute", methods: []string{"POST"}, handler: handleAgentExecute, legacy: []string{"/agent/execute"},
+		summary: "在终端会话中执行工具调用，args 结构见 x-agent-tools", request: AgentRequest{}, response: AgentResponse{}, bodyLimit: agentBodyLimit},
+	{path: "/agent/tools", methods: []string{"GET"}, handler: handleAgentTools, legacy: []string{"/agent/tools"},
+		summary: "终端Agent可用工具列表"},
+	{path: "/agent/sessions", methods: []string{"GET"}, handler: handleTerminalSessions, legacy: []string{"/agent/sessions"},
+		summary: "列出终端会话：当前目录、创建时间、最后使用时间和正在执行的命令", response: TerminalSessionList{}},
+	{path: "/agent/sessions/{id}", methods: []string{"DELETE"}, handler: handleTerminalSessionByID, legacy: []string{"/agent/sessions/{id}"},
+		summary: "强制关闭终端会话（终止正在执行的命令及其子进程）", response: AgentResponse{}},
+	{path: "/agent/sessions/{id}/transcript", methods: []string{"GET"}, handler: handleTerminalTranscript, legacy: []string{"/agent/sessions/{id}/transcript"},
+		summary: "终端会话的执行记录：format=json（默认）按命令分组，format=asciicast 返回 asciicast v2 文件", query: []string{"format"}, response: TerminalTranscript{}},
+	{path: "/agent/changesets/{id}/revert", methods: []string{"POST"}, handler: handleChangesetRevert, legacy: []string{"/agent/changesets/{id}/revert"},
+		summary: "撤销 apply_changeset 应用的变更集，恢复修改前的文件；文件在之后又被修改时返回409，force=true 时仍然恢复", query: []string{"force"}, response: AgentResponse{}},
+	{path: "/agent/save-log", methods: []string{"POST"}, handler: handleAgentSaveLog, legacy: []string{"/agent/save-log"},
+		summary: "保存终端Agent会话日志", request: map[string]interface{}{"type": "object"}, bodyLimit: logBodyLimit},
+
+	// 知识库
+	{path: "/notes", methods: []string{"GET"}, handler: handleNotes, legacy: []string{"/api/notes"},
+		summary: "知识库文件树"},
+	{path: "/notes/upload-image", methods: []string{"POST"}, handler: handleNoteImageUpload, legacy: []string{"/api/notes/upload-image"},
+		summary: "上传笔记图片", request: imageUploadForm, multipart: true, bodyLimit: uploadBodyLimit},
+	{path: "/notes/move", methods: []string{"POST"}, handler: handleMoveNote, legacy: []string{"/api/notes/move"},
+		summary: "移动笔记或文件夹", request: MoveNoteRequest{}},
+	{path: "/notes/delete", methods: []string{"POST"}, handler: handleDeleteNote, legacy: []string{"/api/notes/delete"},
+		summary: "删除笔记或文件夹", request: DeleteNoteRequest{}},
+	{path: "/notes/pdf-followup", methods: []string{"POST"}, handler: handlePdfFollowup, legacy: []string{"/api/notes/pdf-followup"},
+		summary: "保存PDF划词追问到对应的Markdown笔记", request: PdfFollowupRequest{}},
+	{path: "/notes/{id...}", methods: []string{"GET", "PUT", "DELETE"}, handler: handleNoteByID, legacy: []string{"/api/notes/{id...}"},
+		summary: "读取（纯文本）、更新或删除单篇笔记", request: UpdateNoteRequest{}, bodyLimit: noteBodyLimit},
+	{path: "/search", methods: []string{"GET"}, handler: handleSearchNotes, legacy: []string{"/api/search"},
+		summary: "全文搜索笔记", query: []string{"q"}},
+	{path: "/agent/knowledge/tools", methods: []string{"GET"}, handler: handleKnowledgeAgentTools, legacy: []string{"/agent/knowledge/tools"},
+		summary: "知识库Agent可用工具列表"},
+	{path: "/agent/knowledge/write-log", methods: []string{"POST"}, handler: handleKnowledgeAgentWriteLog, legacy: []string{"/agent/knowledge/write-log"},
+		summary: "追加知识库Agent日志", request: KnowledgeLogRequest{}, bodyLimit: logBodyLimit},
+
+	// 任务管理
+	{path: "/tasks", methods: []string{"GET"}, handler: handleTasks, legacy: []string{"/api/tasks"},
+		summary: "任务列表"},
+	{path: "/agent/tasks/tools", methods: []string{"GET"}, handler: handleTaskAgentTools, legacy: []string{"/agent/tasks/tools"},
+		summary: "任务Agent可用工具列表"},
+	{path: "/agent/tasks/execute", methods: []string{"POST"}, handler: handleTaskAgentExecute, legacy: []string{"/agent/tasks/execute"},
+		summary: "执行任务工具，args 结构见 x-agent-tools", request: TaskToolRequest{}, bodyLimit: agentBodyLimit},
+	{path: "/agent/tasks/log", methods: []string{"POST"}, handler: handleTaskAgentLog, legacy: []string{"/agent/tasks/log"},
+		summary: "保存任务Agent日志", request: map[string]interface{}{"type": "object"}, bodyLimit: logBodyLimit},
+
+	// 前端配置
+	{path: "/config", methods: []string{"GET", "PUT"}, handler: handleConfig, legacy: []string{"/api/config"},
+		summary: "GET返回合并内置默认值后的前端配置；PUT校验并保存用户配置，并通过WebSocket广播 config_changed",
+		request: appConfigSchema, response: appConfigSchema},
+	{path: "/save-config", methods: []string{"POST"}, handler: handleConfig, legacy: []string{"/api/save-config"},
+		summary: "保存前端配置（旧接口，等同于 PUT /config）", request: appConfigSchema, response: appConfigSchema},
+
+	// 自检
+	{path: "/diagnostics", methods: []string{"GET"}, handler: handleDiagnostics, legacy: []string{"/api/diagnostics"},
+		summary: "自检报告：工作空间、任务文件、笔记 Front Matter、数据目录和终端", response: DiagnosticsReport{}},
+
+	// 工作空间
+	{path: "/workspace", methods: []string{"GET"}, handler: HandleGetWorkspace, legacy: []string{"/api/workspace"},
+		summary: "当前工作空间信息", response: WorkspaceInfo{}},
+	{path: "/workspace/set", methods: []string{"POST"}, handler: HandleSetWorkspace, legacy: []string{"/api/workspace/set"},
+		summary: "切换工作空间", request: SetWorkspaceRequest{}},
+	{path: "/workspace/browse", methods: []string{"POST"}, handler: HandleBrowseFolder, legacy: []string{"/api/workspace/browse"},
+		summary: "列出目录下的子目录", request: BrowseFolderRequest{}},
+}
+
+// registerAPIRoutes 注册 /api/v1 路由及其旧版别名，所有路由共享同一中间件
+func registerAPIRoutes(mux *http.ServeMux) {
+	for _, route := range apiRoutes {
+		handler := apiMiddleware(route.methods, routeBodyLimit(route), route.handler)
+		mux.Handle(apiV1Prefix+route.path, handler)
+		for _, legacy := range route.legacy {
+			mux.Handle(legacy, handler)
+		}
+	}
+
+	// OpenAPI文档由路由表生成，不能放在表内（否则形成初始化循环）
+	openAPIHandler := apiMiddleware([]string{"GET"}, 0, handleOpenAPI)
+	mux.Handle(apiV1Prefix+openAPIPath, openAPIHandler)
+	mux.Handle("/api"+openAPIPath, openAPIHandler)
+
+	// 配置中写错的路由名不会生效，启动时给出提示
+	for key := range serverConfig.BodyLimits {
+		if key != defaultBodyLimitKey && !isAPIRoutePath(key) {
+			slog.Warn("body_limits entry does not match any route", "route", key)
+		}
+	}
+
+	// /api/v1 下未匹配的路径统一返回JSON格式的404
+	mux.HandleFunc(apiV1Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Not found: "+r.URL.Path)
+	})
+}
+
+// routeBodyLimit 返回路由生效的请求体上限
+func routeBodyLimit(route apiRoute) int64 {
+	return serverConfig.BodyLimit(route.path, route.bodyLimit)
+}
+
+func isAPIRoutePath(path string) bool {
+	for _, route := range apiRoutes {
+		if route.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// apiMiddleware 校验HTTP方法、限制请求体大小并捕获处理函数中的panic
+// bodyLimit 为 0 时使用默认上限
+func apiMiddleware(methods []string, bodyLimit int64, next http.HandlerFunc) http.Handler {
+	if bodyLimit <= 0 {
+		bodyLimit = defaultBodyLimit
+	}
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := false
+		for _, method := range methods {
+			if r.Method == method {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			w.Header().Set("Allow", allow)
+			writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		// 声明的长度已超过上限时直接拒绝；否则在读取超过上限时由 MaxBytesReader 报错
+		if r.ContentLength > bodyLimit {
+			writeError(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge,
+				fmt.Sprintf("Request body too large (limit %d bytes)", bodyLimit))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				slog.Error("panic while handling request", "method", r.Method, "path", r.URL.Path, "panic", rec)
+				writeError(w, http.StatusInternalServerError, CodeInternal, "Internal server error")
+			}
+		}()
+
+		next(w, r)
+	})
+}
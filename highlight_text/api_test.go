@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestAPI 使用临时数据目录和工作空间初始化全局状态，返回注册了 API 路由的 mux 和工作空间路径
+func newTestAPI(t *testing.T) (*http.ServeMux, string) {
+	t.Helper()
+	dataDir := t.TempDir()
+	workspace := filepath.Join(dataDir, "KnowledgeBase")
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadServerConfig([]string{"--data-dir", dataDir, "--workspace", workspace, "--terminal-mode", "pipe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig = cfg
+	if err := os.MkdirAll(cfg.LogsDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	InitWorkspaceManager(workspace, func(string) {})
+	if err := InitPolicyEngine(); err != nil {
+		t.Fatal(err)
+	}
+	// 不启动定期回收，测试结束时关闭所有会话
+	sessionManager = &SessionManager{
+		sessions:    make(map[string]*TerminalSession),
+		opts:        cfg.TerminalOptions(),
+		idleTimeout: time.Duration(cfg.Terminal.IdleTimeout),
+		maxSessions: cfg.Terminal.MaxSessions,
+	}
+	t.Cleanup(sessionManager.CloseAll)
+
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	return mux, workspace
+}
+
+// executeTool 调用 /api/v1/agent/execute，返回状态码和响应
+func executeTool(t *testing.T, mux *http.ServeMux, req AgentRequest) (int, AgentResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, apiV1Prefix+"/agent/execute", bytes.NewReader(body)))
+	var resp AgentResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+func TestAgentExecuteFileErrors(t *testing.T) {
+	mux, workspace := newTestAPI(t)
+	if err := os.WriteFile(filepath.Join(workspace, "a.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tool   string
+		args   map[string]interface{}
+		status int
+		code   string
+	}{
+		{"read existing file", "read_file", map[string]interface{}{"path": filepath.Join(workspace, "a.txt")}, http.StatusOK, ""},
+		{"read missing file", "read_file", map[string]interface{}{"path": filepath.Join(workspace, "missing.txt")}, http.StatusNotFound, CodeNotFound},
+		{"read directory", "read_file", map[string]interface{}{"path": workspace}, http.StatusUnprocessableEntity, CodeToolFailed},
+		{"unknown tool", "no_such_tool", map[string]interface{}{}, http.StatusBadRequest, CodeUnknownTool},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := executeTool(t, mux, AgentRequest{
+				SessionID:        "test",
+				Tool:             tt.tool,
+				Args:             tt.args,
+				InitialDirectory: workspace,
+			})
+			if status != tt.status || resp.Code != tt.code {
+				t.Errorf("status = %d, code = %q (%s), want %d, %q", status, resp.Code, resp.Error, tt.status, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 前端配置的默认值随程序一起打包，用户修改的部分保存在数据目录中
+//
+//go:embed web/config.json
+var defaultAppConfigJSON []byte
+
+// 用户配置文件名（位于数据目录下）
+const appConfigFileName = "app-config.json"
+
+// ErrInvalidConfig 配置不符合 appConfigSchema
+var ErrInvalidConfig = errors.New("invalid config")
+
+// appConfigSchema 前端配置的结构约束（JSON Schema 子集），同时用于校验和OpenAPI文档
+var appConfigSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"apiSettings": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"defaultEndpoint":  map[string]interface{}{"type": "string"},
+				"model":            map[string]interface{}{"type": "string"},
+				"maxTokens":        map[string]interface{}{"type": "integer", "minimum": 1},
+				"maxContextTokens": map[string]interface{}{"type": "integer", "minimum": 1},
+				"temperature":      map[string]interface{}{"type": "number", "minimum": 0, "maximum": 2},
+			},
+		},
+		"commands": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"label", "prompt"},
+				"properties": map[string]interface{}{
+					"label":  map[string]interface{}{"type": "string", "minLength": 1},
+					"prompt": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+		"knowledgeBase": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"imageStorage": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"mode":         map[string]interface{}{"type": "string", "enum": []string{"fixed", "relative"}},
+						"fixedPath":    map[string]interface{}{"type": "string"},
+						"relativePath": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+		},
+		"shortcuts": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"key", "description", "type"},
+				"properties": map[string]interface{}{
+					"key":         map[string]interface{}{"type": "string", "minLength": 1},
+					"description": map[string]interface{}{"type": "string", "minLength": 1},
+					"type":        map[string]interface{}{"type": "string", "enum": []string{"markdown", "action"}},
+					"template":    map[string]interface{}{"type": "string"},
+					"action":      map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+	},
+}
+
+// AppConfigStore 管理前端配置：内置默认值 + 数据目录中的用户配置
+type AppConfigStore struct {
+	mu       sync.Mutex
+	defaults map[string]interface{}
+	path     string
+}
+
+var appConfigStore *AppConfigStore
+
+// InitAppConfigStore 解析内置默认配置并指定用户配置文件路径
+func InitAppConfigStore(path string) error {
+	var defaults map[string]interface{}
+	if err := json.Unmarshal(defaultAppConfigJSON, &defaults); err != nil {
+		return fmt.Errorf("内置默认配置格式错误: %v", err)
+	}
+	appConfigStore = &AppConfigStore{defaults: defaults, path: path}
+	return nil
+}
+
+// Get 返回合并后的配置；用户配置文件损坏时回退到默认值并记录日志
+func (s *AppConfigStore) Get() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	override, err := s.readOverride()
+	if err != nil {
+		slog.Warn("ignoring unreadable app config", "path", s.path, "error", err)
+		override = nil
+	}
+	return mergeConfig(s.defaults, override)
+}
+
+// Save 校验并保存用户配置，返回合并后的配置
+// 只保存与默认值不同的部分，以便升级后新增或调整的默认值仍能生效
+func (s *AppConfigStore) Save(config map[string]interface{}) (map[string]interface{}, error) {
+	merged := mergeConfig(s.defaults, config)
+	if problems := validateSchema(appConfigSchema, merged, ""); len(problems) > 0 {
+		return nil, &ConfigValidationError{Problems: problems}
+	}
+
+	data, err := json.MarshalIndent(diffConfig(s.defaults, merged), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(s.path, data, 0644); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// readOverride 读取用户配置，文件不存在时返回 nil
+func (s *AppConfigStore) readOverride() (map[string]interface{}, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var override map[string]interface{}
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, err
+	}
+	return override, nil
+}
+
+// ConfigValidationError 配置校验失败的详细信息
+type ConfigValidationError struct {
+	Problems []string
+}
+
+func (e *ConfigValidationError) Error() string {
+	return "配置校验失败: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *ConfigValidationError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+// mergeConfig 深度合并：对象逐键合并，数组和标量由 override 整体替换
+func mergeConfig(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseObj, baseIsObj := merged[key].(map[string]interface{})
+		overrideObj, overrideIsObj := value.(map[string]interface{})
+		if baseIsObj && overrideIsObj {
+			merged[key] = mergeConfig(baseObj, overrideObj)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// diffConfig 返回 config 中与 base 不同的部分（mergeConfig 的逆操作）
+func diffConfig(base, config map[string]interface{}) map[string]interface{} {
+	diff := make(map[string]interface{})
+	for key, value := range config {
+		baseObj, baseIsObj := base[key].(map[string]interface{})
+		valueObj, valueIsObj := value.(map[string]interface{})
+		if baseIsObj && valueIsObj {
+			if child := diffConfig(baseObj, valueObj); len(child) > 0 {
+				diff[key] = child
+			}
+		} else if !reflect.DeepEqual(base[key], value) {
+			diff[key] = value
+		}
+	}
+	return diff
+}
+
+// validateSchema 按 JSON Schema 子集（type、properties、required、items、enum、minimum、maximum、minLength）校验，
+// 返回所有不符合之处；未在 properties 中声明的字段不做限制
+func validateSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	if path == "" {
+		path = "$"
+	}
+	var problems []string
+
+	if typ, ok := schema["type"].(string); ok && !matchesType(typ, value) {
+		return []string{fmt.Sprintf("%s: 应为 %s", path, typ)}
+	}
+
+	if enum, ok := schema["enum"].([]string); ok {
+		str, _ := value.(string)
+		found := false
+		for _, option := range enum {
+			if str == option {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: 应为 %s 之一", path, strings.Join(enum, "、")))
+		}
+	}
+
+	if number, ok := value.(float64); ok {
+		if min, ok := schemaNumber(schema["minimum"]); ok && number < min {
+			problems = append(problems, fmt.Sprintf("%s: 不能小于 %v", path, min))
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && number > max {
+			problems = append(problems, fmt.Sprintf("%s: 不能大于 %v", path, max))
+		}
+	}
+
+	if str, ok := value.(string); ok {
+		if minLength, ok := schemaNumber(schema["minLength"]); ok && float64(len([]rune(str))) < minLength {
+			problems = append(problems, fmt.Sprintf("%s: 不能为空", path))
+		}
+	}
+
+	if obj, ok := value.(map[string]interface{}); ok {
+		if required, ok := schema["required"].([]string); ok {
+			for _, key := range required {
+				if _, exists := obj[key]; !exists {
+					problems = append(problems, fmt.Sprintf("%s.%s: 缺少必填字段", path, key))
+				}
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			keys := make([]string, 0, len(properties))
+			for key := range properties {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				child, exists := obj[key]
+				if !exists || child == nil {
+					continue
+				}
+				problems = append(problems, validateSchema(properties[key].(map[string]interface{}), child, path+"."+key)...)
+			}
+		}
+	}
+
+	if arr, ok := value.([]interface{}); ok {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range arr {
+				problems = append(problems, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	return problems
+}
+
+// matchesType 检查解码后的JSON值是否符合 Schema 类型
+func matchesType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	default:
+		return true
+	}
+}
+
+func schemaNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// writeFileAtomic 先写入临时文件再重命名，避免写入中断导致配置损坏
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// handleConfig GET 返回合并后的配置；PUT 校验并保存用户配置，然后通过WebSocket广播
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, appConfigStore.Get())
+		return
+	}
+
+	var config map[string]interface{}
+	if !decodeJSON(w, r, &config) {
+		return
+	}
+	if config == nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidConfig, "Config must be a JSON object")
+		return
+	}
+
+	merged, err := appConfigStore.Save(config)
+	if err != nil {
+		var invalid *ConfigValidationError
+		if errors.As(err, &invalid) {
+			writeJSON(w, http.StatusBadRequest, APIError{
+				Success: false,
+				Code:    CodeInvalidConfig,
+				Error:   "Config validation failed",
+				Details: invalid.Problems,
+			})
+			return
+		}
+		slog.Error("failed to save app config", "path", appConfigStore.path, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to save config")
+		return
+	}
+
+	slog.Info("app config saved", "path", appConfigStore.path)
+	broadcastMessage(map[string]interface{}{
+		"type":   "config_changed",
+		"config": merged,
+	})
+	writeJSON(w, http.StatusOK, merged)
+}
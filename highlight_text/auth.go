@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 访问令牌的传递方式
+const (
+	tokenHeader = "X-Access-Token"
+	tokenCookie = "aihelper_token"
+	tokenQuery  = "token"
+)
+
+// protectedPrefixes 需要访问令牌的路由前缀（前端静态资源不在此列）
+// 前缀以 / 结尾，匹配去掉 / 后的路径本身及其下的所有路径，/log 不会匹配 /logo.png、/login
+var protectedPrefixes = []string{
+	"/api/",
+	"/agent/",
+	"/ws/",
+	"/log/",
+	"/preview/",
+	"/upload-image/",
+	"/uploads/",
+	"/KnowledgeBase/",
+	"/metrics/",
+}
+
+// AccessGuard 本地API访问控制：校验访问令牌和请求来源
+type AccessGuard struct {
+	token          string
+	allowedOrigins map[string]bool
+}
+
+var accessGuard *AccessGuard
+
+// InitAccessGuard 加载（首次启动时生成）访问令牌并初始化来源白名单
+func InitAccessGuard(tokenPath string, allowedOrigins []string) error {
+	token, err := loadOrCreateToken(tokenPath)
+	if err != nil {
+		return err
+	}
+
+	origins := make(map[string]bool)
+	for _, origin := range allowedOrigins {
+		origins[strings.TrimRight(origin, "/")] = true
+	}
+
+	accessGuard = &AccessGuard{
+		token:          token,
+		allowedOrigins: origins,
+	}
+	return nil
+}
+
+// loadOrCreateToken 读取令牌文件，不存在时生成新的随机令牌并保存
+func loadOrCreateToken(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("读取访问令牌失败: %v", err)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成访问令牌失败: %v", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("创建令牌目录失败: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("保存访问令牌失败: %v", err)
+	}
+
+	slog.Info("generated new access token", "path", path)
+	return token, nil
+}
+
+// Token 返回当前访问令牌
+func (g *AccessGuard) Token() string {
+	return g.token
+}
+
+// OriginAllowed 检查请求来源：无Origin（非浏览器）、同源或在白名单中的来源允许访问
+func (g *AccessGuard) OriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if g.allowedOrigins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// validToken 常量时间比较令牌
+func (g *AccessGuard) validToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) == 1
+}
+
+// requestToken 从请求头、Cookie或查询参数中取出令牌
+func requestToken(r *http.Request) (string, bool) {
+	if token := r.Header.Get(tokenHeader); token != "" {
+		return token, false
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer "), false
+	}
+	if cookie, err := r.Cookie(tokenCookie); err == nil {
+		return cookie.Value, false
+	}
+	if token := r.URL.Query().Get(tokenQuery); token != "" {
+		return token, true
+	}
+	return "", false
+}
+
+// setTokenCookie 下发令牌Cookie；SameSite=Strict 保证其他站点发起的请求不会携带
+func (g *AccessGuard) setTokenCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    g.token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// isProtectedPath 判断路径是否需要访问令牌
+func isProtectedPath(path string) bool {
+	for _, prefix := range protectedPrefixes {
+		if path == strings.TrimSuffix(prefix, "/") || strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopbackHost 判断Host头是否为本机地址（用于防御DNS重绑定）
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Middleware 为所有路由统一处理CORS、来源校验和令牌校验
+func (g *AccessGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.OriginAllowed(r) {
+			writeError(w, http.StatusForbidden, CodeOriginDenied, "Origin not allowed")
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Add("Vary", "Origin")
+		}
+
+		// 预检请求不携带令牌，直接放行
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+tokenHeader)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		token, fromQuery := requestToken(r)
+		valid := g.validToken(token)
+
+		// 通过链接携带令牌访问时（如局域网内其他设备首次打开），写入Cookie以便后续请求使用
+		if valid && fromQuery {
+			g.setTokenCookie(w, r)
+		}
+
+		if !isProtectedPath(r.URL.Path) {
+			// 本机打开前端页面时自动下发Cookie，其他设备需通过 ?token= 链接登录
+			if !valid && r.URL.Path == "/" && isLoopbackHost(r.Host) && isLoopbackHost(r.RemoteAddr) {
+				g.setTokenCookie(w, r)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !valid {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized: missing or invalid access token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsProtectedPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", false},
+		{"/assets/index.js", false},
+		{"/api/v1/notes", true},
+		{"/api", true},
+		{"/agent/execute", true},
+		{"/ws/terminal/abc", true},
+		{"/log", true},
+		{"/log/", true},
+		{"/logo.png", false},
+		{"/login", false},
+		{"/preview", true},
+		{"/preview.html", false},
+		{"/upload-image", true},
+		{"/uploads/a.png", true},
+		{"/KnowledgeBase/a.json", true},
+		{"/metrics", true},
+		{"/metrics.js", false},
+	}
+	for _, tt := range tests {
+		if got := isProtectedPath(tt.path); got != tt.want {
+			t.Errorf("isProtectedPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAccessGuardMiddleware(t *testing.T) {
+	g := &AccessGuard{token: "secret", allowedOrigins: map[string]bool{"http://allowed.test": true}}
+	handler := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{name: "static file", path: "/logo.png", want: http.StatusOK},
+		{name: "unrelated page with log prefix", path: "/login", want: http.StatusOK},
+		{name: "log without token", method: http.MethodPost, path: "/log", want: http.StatusUnauthorized},
+		{name: "log with token", method: http.MethodPost, path: "/log", header: map[string]string{tokenHeader: "secret"}, want: http.StatusOK},
+		{name: "wrong token", path: "/api/v1/notes", header: map[string]string{tokenHeader: "wrong"}, want: http.StatusUnauthorized},
+		{name: "bearer token", path: "/api/v1/notes", header: map[string]string{"Authorization": "Bearer secret"}, want: http.StatusOK},
+		{name: "query token", path: "/metrics?token=secret", want: http.StatusOK},
+		{name: "foreign origin", path: "/", header: map[string]string{"Origin": "http://evil.test"}, want: http.StatusForbidden},
+		{name: "allowed origin", path: "/api/v1/notes", header: map[string]string{"Origin": "http://allowed.test", tokenHeader: "secret"}, want: http.StatusOK},
+		{name: "preflight", method: http.MethodOptions, path: "/agent/execute", header: map[string]string{"Origin": "http://allowed.test"}, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d", method, tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
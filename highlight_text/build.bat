@@ -33,7 +33,7 @@ REM Windows 64-bit
 echo   - 正在编译 Windows x64 版本...
 set GOOS=windows
 set GOARCH=amd64
-go build -ldflags "-H windowsgui" -o build\AIHelper-Windows-x64.exe main.go workspace.go
+go build -ldflags "-H windowsgui" -o build\AIHelper-Windows-x64.exe .
 if errorlevel 1 (
     echo ❌ Windows 编译失败！
     pause
@@ -45,7 +45,7 @@ REM macOS Intel
 echo   - 正在编译 macOS Intel 版本...
 set GOOS=darwin
 set GOARCH=amd64
-go build -o build\AIHelper-macOS-Intel main.go workspace.go
+go build -o build\AIHelper-macOS-Intel .
 if errorlevel 1 (
     echo ❌ macOS Intel 编译失败！
     pause
@@ -57,7 +57,7 @@ REM macOS Apple Silicon
 echo   - 正在编译 macOS Apple Silicon 版本...
 set GOOS=darwin
 set GOARCH=arm64
-go build -o build\AIHelper-macOS-AppleSilicon main.go workspace.go
+go build -o build\AIHelper-macOS-AppleSilicon .
 if errorlevel 1 (
     echo ❌ macOS Apple Silicon 编译失败！
     pause
@@ -26,17 +26,17 @@ echo "🔨 第三步: 编译跨平台可执行文件..."
 
 # Windows 64-bit
 echo "  - 正在编译 Windows x64 版本..."
-GOOS=windows GOARCH=amd64 go build -ldflags "-H windowsgui" -o build/AIHelper-Windows-x64.exe main.go workspace.go
+GOOS=windows GOARCH=amd64 go build -ldflags "-H windowsgui" -o build/AIHelper-Windows-x64.exe .
 echo "    ✓ AIHelper-Windows-x64.exe"
 
 # macOS Intel
 echo "  - 正在编译 macOS Intel 版本..."
-GOOS=darwin GOARCH=amd64 go build -o build/AIHelper-macOS-Intel main.go workspace.go
+GOOS=darwin GOARCH=amd64 go build -o build/AIHelper-macOS-Intel .
 echo "    ✓ AIHelper-macOS-Intel"
 
 # macOS Apple Silicon
 echo "  - 正在编译 macOS Apple Silicon 版本..."
-GOOS=darwin GOARCH=arm64 go build -o build/AIHelper-macOS-AppleSilicon main.go workspace.go
+GOOS=darwin GOARCH=arm64 go build -o build/AIHelper-macOS-AppleSilicon .
 echo "    ✓ AIHelper-macOS-AppleSilicon"
 
 echo "✅ 所有平台编译完成"
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"highlight_text/agent/tools"
+)
+
+// 变更集的回滚记录保存在 <data-dir>/changesets/<ID>/：record.json 和修改前的文件内容（files/<序号>）
+const (
+	changesetsDirName   = "changesets"
+	changesetRecordName = "record.json"
+	maxChangesetRecords = 100 // 保留的回滚记录数，超过时删除最早的记录
+)
+
+// 变更集ID：创建时间加随机后缀，按名称排序即按时间排序
+var changesetIDPattern = regexp.MustCompile(`^\d{8}-\d{6}-[0-9a-f]{8}$`)
+
+// changesetMutex 串行化变更集的应用和撤销，避免两者交错修改同一文件
+var changesetMutex sync.Mutex
+
+// ChangesetRecord 变更集的回滚记录
+type ChangesetRecord struct {
+	ID          string          `json:"id"`
+	SessionID   string          `json:"session_id,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	RevertedAt  *time.Time      `json:"reverted_at,omitempty"`
+	Files       []ChangesetFile `json:"files"`
+	CreatedDirs []string        `json:"created_dirs,omitempty"` // 应用时新建的目录，撤销时删除其中的空目录
+}
+
+// ChangesetFile 回滚记录中的一个文件
+type ChangesetFile struct {
+	Path        string      `json:"path"`
+	Action      string      `json:"action"`                 // created、modified 或 deleted
+	Backup      string      `json:"backup,omitempty"`       // 修改前内容的备份（相对于记录目录），新建的文件为空
+	Mode        fs.FileMode `json:"mode,omitempty"`         // 修改前的权限
+	AfterSHA256 string      `json:"after_sha256,omitempty"` // 修改后内容的哈希，删除的文件为空
+}
+
+func changesetsDir() string {
+	return filepath.Join(serverConfig.DataDir, changesetsDirName)
+}
+
+func newChangesetID() string {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+}
+
+// stateHash 文件内容的哈希，文件不存在时为空
+func stateHash(state *tools.FileState) string {
+	if state == nil {
+		return ""
+	}
+	sum := sha256.Sum256(state.Content)
+	return hex.EncodeToString(sum[:])
+}
+
+// saveChangesetRecord 在应用变更集之前保存回滚记录和修改前的文件内容
+func saveChangesetRecord(id, sessionID string, cs *tools.Changeset) (*ChangesetRecord, error) {
+	dir := filepath.Join(changesetsDir(), id)
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0700); err != nil {
+		return nil, err
+	}
+	record := &ChangesetRecord{ID: id, SessionID: sessionID, CreatedAt: time.Now()}
+	for i, fc := range cs.Files {
+		file := ChangesetFile{Path: fc.Path, Action: fc.Action(), AfterSHA256: stateHash(fc.After)}
+		if fc.Before != nil {
+			file.Backup = filepath.ToSlash(filepath.Join("files", fmt.Sprint(i)))
+			file.Mode = fc.Before.Mode
+			if err := os.WriteFile(filepath.Join(dir, file.Backup), fc.Before.Content, 0600); err != nil {
+				os.RemoveAll(dir)
+				return nil, err
+			}
+		}
+		record.Files = append(record.Files, file)
+	}
+	if err := writeChangesetRecord(record); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return record, nil
+}
+
+func writeChangesetRecord(record *ChangesetRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(changesetsDir(), record.ID, changesetRecordName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readChangesetRecord(id string) (*ChangesetRecord, error) {
+	data, err := os.ReadFile(filepath.Join(changesetsDir(), id, changesetRecordName))
+	if err != nil {
+		return nil, err
+	}
+	var record ChangesetRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// pruneChangesetRecords 删除超出保留数量的最早的回滚记录
+func pruneChangesetRecords() {
+	entries, err := os.ReadDir(changesetsDir())
+	if err != nil {
+		return
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() && changesetIDPattern.MatchString(e.Name()) {
+			ids = append(ids, e.Name())
+		}
+	}
+	sort.Strings(ids)
+	for len(ids) > maxChangesetRecords {
+		if err := os.RemoveAll(filepath.Join(changesetsDir(), ids[0])); err != nil {
+			slog.Warn("failed to remove changeset record", "changeset_id", ids[0], "error", err)
+		}
+		ids = ids[1:]
+	}
+}
+
+// handleChangesetTool 保存回滚记录后应用 apply_changeset 的修改
+func handleChangesetTool(w http.ResponseWriter, session *TerminalSession, cs *tools.Changeset, initialDir string) {
+	changesetMutex.Lock()
+	defer changesetMutex.Unlock()
+
+	id := newChangesetID()
+	record, err := saveChangesetRecord(id, session.ID, cs)
+	if err != nil {
+		metrics.ObserveTool("terminal", "apply_changeset", err)
+		slog.Error("failed to save changeset record", "session_id", session.ID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, AgentResponse{
+			Success:          false,
+			Code:             CodeInternal,
+			Error:            fmt.Sprintf("Failed to save rollback record: %v", err),
+			Cwd:              session.Term.GetCwd(),
+			InitialDirectory: initialDir,
+		})
+		return
+	}
+
+	if err := cs.Apply(); err != nil {
+		os.RemoveAll(filepath.Join(changesetsDir(), id))
+		metrics.ObserveTool("terminal", "apply_changeset", err)
+		slog.Warn("changeset failed", "session_id", session.ID, "error", err)
+		status, code := classifyError(err)
+		writeJSON(w, status, AgentResponse{
+			Success:          false,
+			Code:             code,
+			Error:            fmt.Sprintf("Failed to execute tool: %v", err),
+			Cwd:              session.Term.GetCwd(),
+			InitialDirectory: initialDir,
+		})
+		return
+	}
+	if len(cs.CreatedDirs) > 0 {
+		record.CreatedDirs = cs.CreatedDirs
+		if err := writeChangesetRecord(record); err != nil {
+			slog.Warn("failed to update changeset record", "changeset_id", id, "error", err)
+		}
+	}
+	pruneChangesetRecords()
+
+	metrics.ObserveTool("terminal", "apply_changeset", nil)
+	slog.Info("changeset applied", "session_id", session.ID, "changeset_id", id, "files", len(cs.Files))
+	writeJSON(w, http.StatusOK, AgentResponse{
+		Success:          true,
+		Output:           cs.Result(id),
+		Cwd:              session.Term.GetCwd(),
+		InitialDirectory: initialDir,
+		ChangesetID:      id,
+	})
+}
+
+// handleChangesetRevert 将变更集涉及的文件恢复为应用前的状态
+// 文件在应用之后又被修改过时拒绝撤销，除非指定 force=true
+func handleChangesetRevert(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	force := r.URL.Query().Get("force") == "true"
+	if !changesetIDPattern.MatchString(id) {
+		writeError(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("Changeset not found: %s", id))
+		return
+	}
+
+	changesetMutex.Lock()
+	defer changesetMutex.Unlock()
+
+	record, err := readChangesetRecord(id)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("Changeset not found: %s", id))
+		return
+	}
+	if err != nil {
+		slog.Error("failed to read changeset record", "changeset_id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to read changeset record")
+		return
+	}
+	if record.RevertedAt != nil {
+		writeError(w, http.StatusConflict, CodeConflict, fmt.Sprintf("Changeset %s was already reverted at %s", id, record.RevertedAt.Format(time.RFC3339)))
+		return
+	}
+
+	// 当前状态作为修改前的状态，备份的内容作为修改后的状态，复用变更集的应用和失败恢复
+	cs := &tools.Changeset{}
+	var modified []string
+	for _, f := range record.Files {
+		current, err := tools.ReadFileState(f.Path)
+		if err != nil {
+			writeError(w, http.StatusConflict, CodeConflict, fmt.Sprintf("Cannot restore %s: %v", f.Path, err))
+			return
+		}
+		if stateHash(current) != f.AfterSHA256 {
+			modified = append(modified, f.Path)
+		}
+		var original *tools.FileState
+		if f.Backup != "" {
+			data, err := os.ReadFile(filepath.Join(changesetsDir(), id, filepath.FromSlash(f.Backup)))
+			if err != nil {
+				slog.Error("failed to read changeset backup", "changeset_id", id, "path", f.Path, "error", err)
+				writeError(w, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to read backup of %s", f.Path))
+				return
+			}
+			original = &tools.FileState{Content: data, Mode: f.Mode}
+		}
+		cs.Files = append(cs.Files, &tools.FileChange{Path: f.Path, Before: current, After: original})
+	}
+	if len(modified) > 0 && !force {
+		writeError(w, http.StatusConflict, CodeConflict, fmt.Sprintf("Files were modified after the changeset was applied: %s (use force=true to overwrite them)", strings.Join(modified, ", ")))
+		return
+	}
+
+	if err := cs.Apply(); err != nil {
+		slog.Error("failed to revert changeset", "changeset_id", id, "error", err)
+		status, code := classifyError(err)
+		writeError(w, status, code, fmt.Sprintf("Failed to revert changeset: %v", err))
+		return
+	}
+	for i := len(record.CreatedDirs) - 1; i >= 0; i-- {
+		// 目录中还有其他文件时保留
+		os.Remove(record.CreatedDirs[i])
+	}
+
+	now := time.Now()
+	record.RevertedAt = &now
+	if err := writeChangesetRecord(record); err != nil {
+		slog.Warn("failed to update changeset record", "changeset_id", id, "error", err)
+	}
+	slog.Info("changeset reverted", "changeset_id", id, "files", len(record.Files), "forced", len(modified) > 0)
+	writeJSON(w, http.StatusOK, AgentResponse{
+		Success: true,
+		Output:  fmt.Sprintf("Reverted changeset %s (%d files restored)", id, len(record.Files)),
+	})
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"highlight_text/agent/terminal"
+)
+
+// 服务启动配置相关的环境变量
+const (
+	envAddr       = "AIHELPER_ADDR"
+	envWorkspace  = "AIHELPER_WORKSPACE"
+	envDataDir    = "AIHELPER_DATA_DIR"
+	envConfig     = "AIHELPER_CONFIG"
+	envOrigins    = "AIHELPER_ALLOWED_ORIGINS"
+	envLogLevel   = "AIHELPER_LOG_LEVEL"
+	envTLS        = "AIHELPER_TLS"
+	envTLSCert    = "AIHELPER_TLS_CERT"
+	envTLSKey     = "AIHELPER_TLS_KEY"
+	envMaxBody    = "AIHELPER_MAX_BODY"
+	envTermMode   = "AIHELPER_TERMINAL_MODE"
+	envCmdTimeout = "AIHELPER_COMMAND_TIMEOUT"
+	envIdleTime   = "AIHELPER_SESSION_IDLE_TIMEOUT"
+	envMaxSession = "AIHELPER_MAX_SESSIONS"
+	envSandbox    = "AIHELPER_SANDBOX"
+)
+
+// 默认的服务配置文件名（位于数据目录下）
+const serverConfigFileName = "server.json"
+
+// ServerConfig 服务启动配置
+// 优先级：命令行参数 > 环境变量 > 配置文件 > 默认值
+type ServerConfig struct {
+	Addr      string `json:"addr"`      // 监听地址，如 :8080
+	Workspace string `json:"workspace"` // 知识库（工作空间）目录
+	DataDir   string `json:"data_dir"`  // 数据目录：uploads、logs、交互日志均存放于此
+	File      string `json:"-"`         // 实际加载的配置文件路径（未加载时为空）
+
+	AllowedOrigins []string `json:"allowed_origins"` // 允许跨域访问的来源（同源请求始终允许）
+
+	TLS     bool   `json:"tls"`      // 启用HTTPS；未指定证书时自动生成自签名证书
+	TLSCert string `json:"tls_cert"` // 证书文件路径（PEM），与 tls_key 同时指定时使用
+	TLSKey  string `json:"tls_key"`  // 私钥文件路径（PEM）
+
+	// 请求体大小上限：键为 /api/v1 之下的路由（如 "/notes/{id...}"），
+	// "default" 用于没有专门上限的路由
+	BodyLimits map[string]ByteSize `json:"body_limits"`
+
+	Terminal TerminalConfig `json:"terminal"` // 终端Agent的会话设置
+}
+
+// TerminalConfig 终端会话设置
+type TerminalConfig struct {
+	Mode     string `json:"mode"`      // auto（默认，Linux上优先使用PTY）、pty 或 pipe
+	KeepANSI bool   `json:"keep_ansi"` // PTY模式下保留输出中的ANSI转义序列（默认去除）
+
+	CommandTimeout Duration `json:"command_timeout"` // 单条命令的默认超时时间，请求中可通过 timeout_seconds 覆盖
+
+	IdleTimeout Duration `json:"idle_timeout"` // 会话空闲超过该时间后自动关闭
+	MaxSessions int      `json:"max_sessions"` // 同时存在的会话数上限，达到上限时关闭最久未使用的空闲会话
+
+	Sandbox SandboxConfig `json:"sandbox"` // 受限模式（仅Linux）
+}
+
+// SandboxConfig 终端受限模式设置
+// 启用后 shell 只继承 env_allow 中的环境变量，工作目录限制在会话的初始目录之下，资源上限作用于 shell 启动的每个进程
+type SandboxConfig struct {
+	Enabled      bool     `json:"enabled"`
+	CPUSeconds   int      `json:"cpu_seconds"`   // 每个进程的CPU时间上限（秒）
+	Memory       ByteSize `json:"memory"`        // 每个进程的虚拟内存上限
+	Output       ByteSize `json:"output"`        // 单条命令的输出上限，同时限制写入的单个文件大小
+	MaxProcesses int      `json:"max_processes"` // 进程数上限（按系统用户统计，包括服务自身的进程），0 表示不限制
+	EnvAllow     []string `json:"env_allow"`     // 保留的环境变量名，默认 PATH、LANG、LC_*、TZ、USER、LOGNAME
+}
+
+// 终端会话的默认设置
+const (
+	defaultCommandTimeout = 5 * time.Minute
+	defaultIdleTimeout    = 30 * time.Minute
+	defaultMaxSessions    = 16
+
+	defaultSandboxCPUSeconds = 60
+	defaultSandboxMemory     = 2 << 30
+	defaultSandboxOutput     = 10 << 20
+)
+
+// defaultBodyLimitKey BodyLimits 中表示默认上限的键
+const defaultBodyLimitKey = "default"
+
+var serverConfig *ServerConfig
+
+// LoadServerConfig 解析命令行参数、环境变量和配置文件，得到最终的启动配置
+func LoadServerConfig(args []string) (*ServerConfig, error) {
+	fset := flag.NewFlagSet("AIHelper", flag.ContinueOnError)
+	flagAddr := fset.String("addr", "", "HTTP监听地址 (环境变量 "+envAddr+", 默认 :8080)")
+	flagWorkspace := fset.String("workspace", "", "知识库目录 (环境变量 "+envWorkspace+", 默认 <data-dir>/KnowledgeBase)")
+	flagDataDir := fset.String("data-dir", "", "数据目录，存放uploads、logs和交互日志 (环境变量 "+envDataDir+", 默认当前目录)")
+	flagOrigins := fset.String("allowed-origins", "", "允许跨域访问的来源，逗号分隔 (环境变量 "+envOrigins+")")
+	flagTLS := fset.Bool("tls", false, "启用HTTPS，未指定证书时在数据目录生成自签名证书 (环境变量 "+envTLS+")")
+	flagTLSCert := fset.String("tls-cert", "", "HTTPS证书文件路径 (环境变量 "+envTLSCert+")")
+	flagTLSKey := fset.String("tls-key", "", "HTTPS私钥文件路径 (环境变量 "+envTLSKey+")")
+	flagMaxBody := fset.String("max-body", "", "请求体默认大小上限，如 1MB (环境变量 "+envMaxBody+", 默认 1MB)")
+	flagTermMode := fset.String("terminal-mode", "", "终端实现：auto、pty 或 pipe (环境变量 "+envTermMode+", 默认 auto)")
+	flagCmdTimeout := fset.String("command-timeout", "", "终端命令的默认超时时间，如 90s、10m (环境变量 "+envCmdTimeout+", 默认 5m)")
+	flagIdleTime := fset.String("session-idle-timeout", "", "终端会话的空闲超时时间 (环境变量 "+envIdleTime+", 默认 30m)")
+	flagMaxSession := fset.Int("max-sessions", 0, "终端会话数上限 (环境变量 "+envMaxSession+", 默认 16)")
+	flagSandbox := fset.Bool("sandbox", false, "终端命令以受限模式执行，仅Linux支持 (环境变量 "+envSandbox+")")
+	flagConfig := fset.String("config", "", "配置文件路径 (环境变量 "+envConfig+", 默认 <data-dir>/"+serverConfigFileName+")")
+	if err := fset.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var err error
+
+	// 命令行参数优先，其次是环境变量
+	pick := func(flagValue, envName string) string {
+		if flagValue != "" {
+			return flagValue
+		}
+		return os.Getenv(envName)
+	}
+
+	cfg := &ServerConfig{
+		Addr:      pick(*flagAddr, envAddr),
+		Workspace: pick(*flagWorkspace, envWorkspace),
+		DataDir:   pick(*flagDataDir, envDataDir),
+		TLSCert:   pick(*flagTLSCert, envTLSCert),
+		TLSKey:    pick(*flagTLSKey, envTLSKey),
+		Terminal:  TerminalConfig{Mode: pick(*flagTermMode, envTermMode)},
+	}
+	if *flagTLS {
+		cfg.TLS = true
+	} else if value := os.Getenv(envTLS); value != "" {
+		if cfg.TLS, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("环境变量 %s 的值无效: %s", envTLS, value)
+		}
+	}
+	var sandbox bool
+	if *flagSandbox {
+		sandbox = true
+	} else if value := os.Getenv(envSandbox); value != "" {
+		if sandbox, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("环境变量 %s 的值无效: %s", envSandbox, value)
+		}
+	}
+	if origins := pick(*flagOrigins, envOrigins); origins != "" {
+		cfg.AllowedOrigins = splitList(origins)
+	}
+	var cmdTimeout Duration
+	if value := pick(*flagCmdTimeout, envCmdTimeout); value != "" {
+		if cmdTimeout, err = ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("命令超时时间无效: %v", err)
+		}
+	}
+	var idleTimeout Duration
+	if value := pick(*flagIdleTime, envIdleTime); value != "" {
+		if idleTimeout, err = ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("会话空闲超时时间无效: %v", err)
+		}
+	}
+	maxSessions := *flagMaxSession
+	if value := os.Getenv(envMaxSession); maxSessions == 0 && value != "" {
+		if maxSessions, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("环境变量 %s 的值无效: %s", envMaxSession, value)
+		}
+	}
+	var maxBody ByteSize
+	if value := pick(*flagMaxBody, envMaxBody); value != "" {
+		if maxBody, err = ParseByteSize(value); err != nil {
+			return nil, fmt.Errorf("请求体上限无效: %v", err)
+		}
+	}
+
+	// 确定配置文件：显式指定的文件必须存在，默认位置的文件可选
+	configPath := pick(*flagConfig, envConfig)
+	explicit := configPath != ""
+	if !explicit {
+		dataDir := cfg.DataDir
+		if dataDir == "" {
+			dataDir = "."
+		}
+		configPath = filepath.Join(dataDir, serverConfigFileName)
+	}
+
+	fileCfg, err := readServerConfigFile(configPath)
+	if err != nil {
+		if explicit || !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		cfg.File = configPath
+		if cfg.Addr == "" {
+			cfg.Addr = fileCfg.Addr
+		}
+		if cfg.Workspace == "" {
+			cfg.Workspace = fileCfg.Workspace
+		}
+		if cfg.DataDir == "" {
+			cfg.DataDir = fileCfg.DataDir
+		}
+		if len(cfg.AllowedOrigins) == 0 {
+			cfg.AllowedOrigins = fileCfg.AllowedOrigins
+		}
+		if !cfg.TLS {
+			cfg.TLS = fileCfg.TLS
+		}
+		if cfg.TLSCert == "" && cfg.TLSKey == "" {
+			cfg.TLSCert, cfg.TLSKey = fileCfg.TLSCert, fileCfg.TLSKey
+		}
+		cfg.BodyLimits = fileCfg.BodyLimits
+		if cfg.Terminal.Mode == "" {
+			cfg.Terminal.Mode = fileCfg.Terminal.Mode
+		}
+		cfg.Terminal.KeepANSI = fileCfg.Terminal.KeepANSI
+		cfg.Terminal.CommandTimeout = fileCfg.Terminal.CommandTimeout
+		cfg.Terminal.IdleTimeout = fileCfg.Terminal.IdleTimeout
+		cfg.Terminal.MaxSessions = fileCfg.Terminal.MaxSessions
+		cfg.Terminal.Sandbox = fileCfg.Terminal.Sandbox
+	}
+	if sandbox {
+		cfg.Terminal.Sandbox.Enabled = true
+	}
+	if cmdTimeout > 0 {
+		cfg.Terminal.CommandTimeout = cmdTimeout
+	}
+	if idleTimeout > 0 {
+		cfg.Terminal.IdleTimeout = idleTimeout
+	}
+	if maxSessions > 0 {
+		cfg.Terminal.MaxSessions = maxSessions
+	}
+
+	// 命令行参数或环境变量指定的默认上限优先于配置文件
+	if maxBody > 0 {
+		if cfg.BodyLimits == nil {
+			cfg.BodyLimits = make(map[string]ByteSize)
+		}
+		cfg.BodyLimits[defaultBodyLimitKey] = maxBody
+	}
+
+	// 证书和私钥必须成对指定，指定后自动启用HTTPS
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("HTTPS证书和私钥必须同时指定")
+	}
+	if cfg.TLSCert != "" {
+		cfg.TLS = true
+	}
+
+	mode, ok := terminal.ParseMode(cfg.Terminal.Mode)
+	if !ok {
+		return nil, fmt.Errorf("终端模式无效: %q（可选 auto、pty、pipe）", cfg.Terminal.Mode)
+	}
+	cfg.Terminal.Mode = string(mode)
+	if cfg.Terminal.CommandTimeout <= 0 {
+		cfg.Terminal.CommandTimeout = Duration(defaultCommandTimeout)
+	}
+	if cfg.Terminal.IdleTimeout <= 0 {
+		cfg.Terminal.IdleTimeout = Duration(defaultIdleTimeout)
+	}
+	if cfg.Terminal.MaxSessions <= 0 {
+		cfg.Terminal.MaxSessions = defaultMaxSessions
+	}
+	if sb := &cfg.Terminal.Sandbox; sb.Enabled {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("终端受限模式仅支持Linux")
+		}
+		if sb.CPUSeconds <= 0 {
+			sb.CPUSeconds = defaultSandboxCPUSeconds
+		}
+		if sb.Memory <= 0 {
+			sb.Memory = defaultSandboxMemory
+		}
+		if sb.Output <= 0 {
+			sb.Output = defaultSandboxOutput
+		}
+	}
+
+	// 默认值
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+	if cfg.DataDir == "" {
+		cfg.DataDir = "."
+	}
+	if cfg.Workspace == "" {
+		cfg.Workspace = filepath.Join(cfg.DataDir, "KnowledgeBase")
+	}
+
+	// 统一转换为绝对路径，避免后续依赖进程的工作目录
+	if cfg.DataDir, err = filepath.Abs(cfg.DataDir); err != nil {
+		return nil, fmt.Errorf("无法解析数据目录: %v", err)
+	}
+	if cfg.Workspace, err = filepath.Abs(cfg.Workspace); err != nil {
+		return nil, fmt.Errorf("无法解析知识库目录: %v", err)
+	}
+	if cfg.TLSCert != "" {
+		if cfg.TLSCert, err = filepath.Abs(cfg.TLSCert); err != nil {
+			return nil, fmt.Errorf("无法解析证书路径: %v", err)
+		}
+		if cfg.TLSKey, err = filepath.Abs(cfg.TLSKey); err != nil {
+			return nil, fmt.Errorf("无法解析私钥路径: %v", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// readServerConfigFile 读取JSON配置文件，文件中的相对路径相对于配置文件所在目录
+func readServerConfigFile(path string) (*ServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg ServerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("配置文件格式错误 %s: %v", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	if cfg.Workspace != "" && !filepath.IsAbs(cfg.Workspace) {
+		cfg.Workspace = filepath.Join(baseDir, cfg.Workspace)
+	}
+	if cfg.DataDir != "" && !filepath.IsAbs(cfg.DataDir) {
+		cfg.DataDir = filepath.Join(baseDir, cfg.DataDir)
+	}
+	if cfg.TLSCert != "" && !filepath.IsAbs(cfg.TLSCert) {
+		cfg.TLSCert = filepath.Join(baseDir, cfg.TLSCert)
+	}
+	if cfg.TLSKey != "" && !filepath.IsAbs(cfg.TLSKey) {
+		cfg.TLSKey = filepath.Join(baseDir, cfg.TLSKey)
+	}
+
+	return &cfg, nil
+}
+
+// BodyLimit 返回路由的请求体上限：配置的路由上限 > 路由内置上限 > 配置的默认上限 > defaultBodyLimit
+func (c *ServerConfig) BodyLimit(path string, builtin int64) int64 {
+	if limit, ok := c.BodyLimits[path]; ok && limit > 0 {
+		return int64(limit)
+	}
+	if builtin > 0 {
+		return builtin
+	}
+	if limit, ok := c.BodyLimits[defaultBodyLimitKey]; ok && limit > 0 {
+		return int64(limit)
+	}
+	return defaultBodyLimit
+}
+
+// TerminalOptions 返回创建终端会话使用的选项
+// 启用受限模式时 Sandbox.Root 为空，由会话管理器按会话的初始目录设置
+func (c *ServerConfig) TerminalOptions() terminal.Options {
+	opts := terminal.Options{
+		Mode:     terminal.Mode(c.Terminal.Mode),
+		KeepANSI: c.Terminal.KeepANSI,
+	}
+	if sb := c.Terminal.Sandbox; sb.Enabled {
+		opts.Sandbox = &terminal.Sandbox{
+			CPUSeconds:   sb.CPUSeconds,
+			MemoryBytes:  int64(sb.Memory),
+			OutputBytes:  int64(sb.Output),
+			MaxProcesses: sb.MaxProcesses,
+			EnvAllow:     sb.EnvAllow,
+		}
+	}
+	return opts
+}
+
+// CommandTimeout 返回命令的超时时间：请求中指定的秒数优先（不超过配置的值），否则使用配置的默认值
+func (c *ServerConfig) CommandTimeout(requestedSeconds int) time.Duration {
+	limit := time.Duration(c.Terminal.CommandTimeout)
+	if requestedSeconds > 0 && time.Duration(requestedSeconds) < limit/time.Second {
+		return time.Duration(requestedSeconds) * time.Second
+	}
+	return limit
+}
+
+// ByteSize 字节数，配置文件中可写为数字或带单位的字符串（如 "10MB"、"512KB"）
+type ByteSize int64
+
+// UnmarshalJSON 支持数字和带单位的字符串两种写法
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*b = ByteSize(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("无效的大小: %s", data)
+	}
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// ParseByteSize 解析带单位的大小（B、KB、MB、GB，按1024换算，单位不区分大小写）
+func ParseByteSize(value string) (ByteSize, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"G", 1 << 30}, {"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("无效的大小: %q", value)
+	}
+	return ByteSize(n * multiplier), nil
+}
+
+// Duration 时长，配置文件中可写为秒数或带单位的字符串（如 "90s"、"10m"）
+type Duration time.Duration
+
+// UnmarshalJSON 支持数字（秒）和字符串两种写法
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("无效的时长: %s", data)
+	}
+	value, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = value
+	return nil
+}
+
+// ParseDuration 解析时长：纯数字视为秒，否则按 Go 的时长格式（如 "90s"、"1h30m"）解析
+func ParseDuration(value string) (Duration, error) {
+	s := strings.TrimSpace(value)
+	if n, err := strconv.ParseFloat(s, 64); err == nil && n > 0 {
+		return Duration(n * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("无效的时长: %q", value)
+	}
+	return Duration(d), nil
+}
+
+// splitList 拆分逗号分隔的列表并去除空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// UploadsDir 返回上传文件目录
+func (c *ServerConfig) UploadsDir() string {
+	return filepath.Join(c.DataDir, "uploads")
+}
+
+// LogsDir 返回日志目录
+func (c *ServerConfig) LogsDir() string {
+	return filepath.Join(c.DataDir, "logs")
+}
+
+// PolicyPath 返回工具调用规则文件路径
+func (c *ServerConfig) PolicyPath() string {
+	return filepath.Join(c.DataDir, policyFileName)
+}
+
+// TokenPath 返回访问令牌文件路径
+func (c *ServerConfig) TokenPath() string {
+	return filepath.Join(c.DataDir, "access_token")
+}
+
+// InteractionLogPath 返回交互日志文件路径
+func (c *ServerConfig) InteractionLogPath() string {
+	return filepath.Join(c.DataDir, "interactions.log.json")
+}
+
+// AppConfigPath 返回前端配置（用户修改部分）的保存路径
+func (c *ServerConfig) AppConfigPath() string {
+	return filepath.Join(c.DataDir, appConfigFileName)
+}
+
+// TLSDir 返回自签名证书目录
+func (c *ServerConfig) TLSDir() string {
+	return filepath.Join(c.DataDir, "tls")
+}
+
+// Scheme 返回HTTP和WebSocket的协议名
+func (c *ServerConfig) Scheme() (httpScheme, wsScheme string) {
+	if c.TLS {
+		return "https", "wss"
+	}
+	return "http", "ws"
+}
+
+// DisplayHost 返回用于展示的 host:port（监听所有地址时显示为 localhost）
+func (c *ServerConfig) DisplayHost() string {
+	host, port, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return c.Addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
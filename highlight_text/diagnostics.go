@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"highlight_text/agent/terminal"
+	"highlight_text/agent/tools"
+	"highlight_text/agent/tools/notes"
+	"highlight_text/agent/tools/tasks"
+)
+
+// 检查结果状态，严重程度依次递增
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// 终端自检的最长等待时间
+const terminalCheckTimeout = 5 * time.Second
+
+// DiagnosticCheck 单项检查结果
+type DiagnosticCheck struct {
+	Name       string            `json:"name"`
+	Status     string            `json:"status"` // ok / warn / fail
+	Message    string            `json:"message,omitempty"`
+	Path       string            `json:"path,omitempty"`
+	Issues     []tools.FileIssue `json:"issues,omitempty"`
+	DurationMs float64           `json:"duration_ms"`
+}
+
+// DiagnosticsReport 自检报告
+type DiagnosticsReport struct {
+	Status string            `json:"status"` // 所有检查中最严重的状态
+	Time   time.Time         `json:"time"`
+	Checks []DiagnosticCheck `json:"checks"`
+}
+
+// HealthStatus /healthz 的响应（不含路径等细节，无需令牌即可访问）
+type HealthStatus struct {
+	Status string            `json:"status"` // ok / unavailable
+	Checks map[string]string `json:"checks"`
+}
+
+// handleHealthz 健康检查：服务可用且工作空间、数据目录可写时返回200，否则返回503
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	checks := []DiagnosticCheck{
+		runCheck("workspace", checkWorkspace),
+		runCheck("data_dir", func() DiagnosticCheck { return checkWritableDir(serverConfig.DataDir) }),
+	}
+
+	health := HealthStatus{Status: "ok", Checks: make(map[string]string)}
+	status := http.StatusOK
+	for _, check := range checks {
+		health.Checks[check.Name] = check.Status
+		if check.Status == CheckFail {
+			health.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, health)
+}
+
+// handleDiagnostics 返回完整的自检报告
+func handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, runDiagnostics())
+}
+
+// runDiagnostics 依次执行所有检查
+func runDiagnostics() DiagnosticsReport {
+	report := DiagnosticsReport{
+		Status: CheckOK,
+		Time:   time.Now(),
+		Checks: []DiagnosticCheck{
+			runCheck("workspace", checkWorkspace),
+			runCheck("tasks", checkTasks),
+			runCheck("notes_front_matter", checkNotes),
+			runCheck("uploads_dir", func() DiagnosticCheck { return checkWritableDir(serverConfig.UploadsDir()) }),
+			runCheck("logs_dir", func() DiagnosticCheck { return checkWritableDir(serverConfig.LogsDir()) }),
+			runCheck("terminal", checkTerminal),
+			runCheck("policy", checkPolicy),
+		},
+	}
+
+	for _, check := range report.Checks {
+		if severity(check.Status) > severity(report.Status) {
+			report.Status = check.Status
+		}
+	}
+	return report
+}
+
+// runCheck 执行单项检查并记录名称和耗时
+func runCheck(name string, check func() DiagnosticCheck) DiagnosticCheck {
+	start := time.Now()
+	result := check()
+	result.Name = name
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+func severity(status string) int {
+	switch status {
+	case CheckFail:
+		return 2
+	case CheckWarn:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// checkWorkspace 工作空间目录存在且可写
+func checkWorkspace() DiagnosticCheck {
+	return checkWritableDir(workspaceManager.GetWorkspacePath())
+}
+
+// checkWritableDir 检查目录存在、是目录且可以创建文件
+func checkWritableDir(dir string) DiagnosticCheck {
+	result := DiagnosticCheck{Path: dir}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("目录不可访问: %v", err)
+		return result
+	}
+	if !info.IsDir() {
+		result.Status = CheckFail
+		result.Message = "路径不是目录"
+		return result
+	}
+
+	// 以隐藏文件名试写，避免出现在知识库文件树中
+	f, err := os.CreateTemp(dir, ".aihelper-write-check-*")
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("目录不可写: %v", err)
+		return result
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	result.Status = CheckOK
+	return result
+}
+
+// checkTasks 列出 _tasks 中无法解析、会被任务列表跳过的文件
+func checkTasks() DiagnosticCheck {
+	tasksPath := filepath.Join(workspaceManager.GetWorkspacePath(), "_tasks")
+	result := DiagnosticCheck{Path: tasksPath}
+
+	issues, err := tasks.CheckTaskFiles(tasksPath)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("读取任务目录失败: %v", err)
+		return result
+	}
+	return fileIssuesResult(result, issues, "个任务文件无法解析，已在任务列表中跳过")
+}
+
+// checkNotes 列出 Front Matter 格式有误的笔记
+func checkNotes() DiagnosticCheck {
+	workspacePath := workspaceManager.GetWorkspacePath()
+	result := DiagnosticCheck{Path: workspacePath}
+
+	issues, err := notes.CheckFrontMatter(workspacePath)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("遍历知识库失败: %v", err)
+		return result
+	}
+	return fileIssuesResult(result, issues, "篇笔记的 Front Matter 格式有误，部分或全部元数据未被解析")
+}
+
+func fileIssuesResult(result DiagnosticCheck, issues []tools.FileIssue, message string) DiagnosticCheck {
+	if len(issues) == 0 {
+		result.Status = CheckOK
+		return result
+	}
+	result.Status = CheckWarn
+	result.Message = fmt.Sprintf("%d %s", len(issues), message)
+	result.Issues = issues
+	return result
+}
+
+// checkPolicy 规则文件格式有误时所有工具调用都会被拒绝
+func checkPolicy() DiagnosticCheck {
+	result := DiagnosticCheck{Status: CheckOK}
+	var issues []tools.FileIssue
+	for source, err := range policyEngine.Sources() {
+		if err != nil {
+			issues = append(issues, tools.FileIssue{Path: source, Reason: err.Error()})
+		}
+	}
+	if len(issues) > 0 {
+		result.Status = CheckFail
+		result.Message = "规则文件格式有误，所有工具调用都会被拒绝"
+		result.Issues = issues
+	}
+	return result
+}
+
+// checkTerminal 启动一个临时终端并执行一条简单命令
+func checkTerminal() DiagnosticCheck {
+	result := DiagnosticCheck{}
+
+	term, err := terminal.NewWithOptions(serverConfig.TerminalOptions())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("无法启动终端: %v", err)
+		return result
+	}
+	defer term.Close()
+	result.Path = term.GetCwd()
+
+	const marker = "aihelper-diagnostics"
+	ctx, cancel := context.WithTimeout(context.Background(), terminalCheckTimeout)
+	defer cancel()
+	res, err := term.Execute(ctx, "echo "+marker)
+	switch {
+	case errors.Is(err, terminal.ErrCommandTimeout):
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("终端在 %v 内未返回结果", terminalCheckTimeout)
+	case err != nil:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("终端执行命令失败: %v", err)
+	case res.ExitCode != 0 || !strings.Contains(res.Stdout, marker):
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("终端输出不符合预期: %q (exit %d, stderr %q)", res.Stdout, res.ExitCode, res.Stderr)
+	default:
+		result.Status = CheckOK
+	}
+	return result
+}
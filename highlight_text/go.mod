@@ -2,7 +2,6 @@ module highlight_text
 
 go 1.24.6
 
-require (
-	github.com/gorilla/websocket v1.5.3 // indirect
-	github.com/sergi/go-diff v1.4.0 // indirect
-)
+require github.com/gorilla/websocket v1.5.3
+
+require github.com/sergi/go-diff v1.4.0
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"highlight_text/agent/terminal"
+	"highlight_text/agent/tools"
+)
+
+// 后台任务相关参数
+const (
+	jobOutputBuffer = 1 << 20 // 每个任务保留的输出字节数
+	maxRunningJobs  = 8       // 每个会话同时运行的任务数上限
+	maxFinishedJobs = 16      // 每个会话保留的已结束任务数，超过时移除最早结束的
+)
+
+// ErrTooManyJobs 会话中运行的后台任务数已达上限
+var ErrTooManyJobs = errors.New("too many background jobs")
+
+// ErrJobNotFound 会话中没有该后台任务
+var ErrJobNotFound = errors.New("background job not found")
+
+// startJob 在会话中启动后台任务，任务ID在会话内递增（job-1、job-2……）
+// 启动任务需要等待 shell 空闲，等待期间不持有锁；名额在检查时预留，并发启动的任务总数不会超过上限
+func (s *TerminalSession) startJob(ctx context.Context, command string) (*terminal.Job, error) {
+	s.mu.Lock()
+	running := s.starting
+	for _, job := range s.jobs {
+		if job.Running() {
+			running++
+		}
+	}
+	if running >= maxRunningJobs {
+		s.mu.Unlock()
+		return nil, ErrTooManyJobs
+	}
+	s.starting++
+	s.jobSeq++
+	id := fmt.Sprintf("job-%d", s.jobSeq)
+	s.mu.Unlock()
+
+	job, err := s.Term.StartJob(ctx, id, command, jobOutputBuffer)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.starting--
+	if err != nil {
+		return nil, err
+	}
+	if s.jobs == nil {
+		s.jobs = make(map[string]*terminal.Job)
+	}
+	s.jobs[id] = job
+	s.pruneJobsLocked()
+	return job, nil
+}
+
+// pruneJobsLocked 移除超出保留数量的已结束任务，调用方需持有 s.mu
+func (s *TerminalSession) pruneJobsLocked() {
+	var finished []terminal.JobStatus
+	for _, job := range s.jobs {
+		if !job.Running() {
+			finished = append(finished, job.Status())
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].EndedAt.Before(*finished[j].EndedAt) })
+	for _, status := range finished[:len(finished)-maxFinishedJobs] {
+		delete(s.jobs, status.ID)
+	}
+}
+
+// job 查找会话中的后台任务
+func (s *TerminalSession) job(id string) (*terminal.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return job, nil
+}
+
+// jobStatuses 返回会话中所有后台任务的状态，按启动时间排序
+func (s *TerminalSession) jobStatuses() []terminal.JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]terminal.JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		statuses = append(statuses, job.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].StartedAt.Before(statuses[j].StartedAt) })
+	return statuses
+}
+
+// runningJobs 返回会话中正在运行的后台任务数
+func (s *TerminalSession) runningJobs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, job := range s.jobs {
+		if job.Running() {
+			n++
+		}
+	}
+	return n
+}
+
+// killJobs 终止会话中所有正在运行的后台任务
+func (s *TerminalSession) killJobs() {
+	s.mu.Lock()
+	jobs := make([]*terminal.Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		if job.Kill() {
+			slog.Info("background job killed", "session_id", s.ID, "job_id", job.ID, "reason", "session_closed")
+		}
+	}
+}
+
+// handleJobTool 执行后台任务类工具，tool 为调用的工具名（run_background、job_output 等），用于指标和日志
+func handleJobTool(w http.ResponseWriter, r *http.Request, session *TerminalSession, tool string, req *tools.JobRequest, initialDir string) {
+	resp := AgentResponse{Success: true, InitialDirectory: initialDir}
+	var err error
+
+	switch req.Action {
+	case tools.JobRun:
+		var job *terminal.Job
+		ctx, cancel := context.WithTimeout(r.Context(), serverConfig.CommandTimeout(0))
+		job, err = session.startJob(ctx, req.Command)
+		cancel()
+		if err == nil {
+			status := job.Status()
+			slog.Info("background job started", "session_id", session.ID, "job_id", job.ID, "pid", status.Pid)
+			recordJobStart(session.ID, job)
+			resp.Job = &status
+			resp.Output = fmt.Sprintf("Started background job %s (pid %d). Use job_output to read its output.", job.ID, status.Pid)
+		}
+
+	case tools.JobOutput:
+		var job *terminal.Job
+		if job, err = session.job(req.JobID); err == nil {
+			out := job.Output(req.Offset, req.MaxBytes)
+			resp.JobOutput = &out
+			resp.Output = out.Data
+			if out.Dropped > 0 {
+				resp.Output = fmt.Sprintf("[%d bytes of earlier output were discarded]\n%s", out.Dropped, out.Data)
+			}
+			if !out.Running {
+				status := job.Status()
+				resp.Job = &status
+			}
+		}
+
+	case tools.JobStatus:
+		if req.JobID == "" {
+			resp.Jobs = session.jobStatuses()
+			resp.Output = fmt.Sprintf("%d background jobs", len(resp.Jobs))
+			break
+		}
+		var job *terminal.Job
+		if job, err = session.job(req.JobID); err == nil {
+			status := job.Status()
+			resp.Job = &status
+			resp.Output = jobSummary(status)
+		}
+
+	case tools.JobKill:
+		var job *terminal.Job
+		if job, err = session.job(req.JobID); err == nil {
+			killed := job.Kill()
+			status := job.Status()
+			resp.Job = &status
+			resp.Output = fmt.Sprintf("Background job %s had already exited", job.ID)
+			if killed {
+				slog.Info("background job killed", "session_id", session.ID, "job_id", job.ID, "reason", "job_kill")
+				resp.Output = fmt.Sprintf("Killed background job %s", job.ID)
+			}
+		}
+	}
+
+	resp.Cwd = session.Term.GetCwd()
+	metrics.ObserveTool("terminal", tool, err)
+	if err != nil {
+		if errors.Is(err, terminal.ErrSessionClosed) {
+			sessionManager.Discard(session)
+		}
+		slog.Warn("background job failed", "session_id", session.ID, "tool", tool, "error", err)
+		status, code := classifyJobError(err)
+		resp.Success = false
+		resp.Code = code
+		resp.Error = fmt.Sprintf("Failed to execute tool: %v", err)
+		writeJSON(w, status, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// jobSummary 任务状态的简短说明
+func jobSummary(status terminal.JobStatus) string {
+	if status.Running {
+		return fmt.Sprintf("Background job %s is running (pid %d, %d bytes of output)", status.ID, status.Pid, status.OutputBytes)
+	}
+	return fmt.Sprintf("Background job %s exited with code %d (%d bytes of output)", status.ID, *status.ExitCode, status.OutputBytes)
+}
+
+// classifyJobError 将后台任务的错误映射为HTTP状态码和错误码
+func classifyJobError(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, ErrTooManyJobs):
+		return http.StatusServiceUnavailable, CodeTooManyJobs
+	default:
+		return classifyTerminalError(err)
+	}
+}
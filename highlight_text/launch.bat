@@ -27,7 +27,7 @@ echo.
 
 REM 编译项目
 echo 📦 正在编译项目...
-go build -o ai-helper-web.exe main.go
+go build -o ai-helper-web.exe .
 if errorlevel 1 (
     echo ❌ 编译失败
     pause
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// initLogger 将默认日志输出设置为JSON结构化格式（stderr）
+// 日志级别由环境变量 AIHELPER_LOG_LEVEL 控制：debug、info（默认）、warn、error
+func initLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(os.Getenv(envLogLevel)))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	// SetDefault 同时会把标准 log 包（net/http 内部错误等）的输出转到该 Handler
+	slog.SetDefault(logger)
+}
@@ -1,20 +1,26 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"highlight_text/agent/policy"
 	"highlight_text/agent/terminal"
 	"highlight_text/agent/tools"
 	"highlight_text/agent/tools/notes"
@@ -38,10 +44,15 @@ type AgentRequest struct {
 	SessionID        string                 `json:"session_id"`
 	Tool             string                 `json:"tool"`
 	Args             map[string]interface{} `json:"args"`
-	Action           string                 `json:"action"` // "execute" or "close"
+	Action           string                 `json:"action"` // "execute"、"cancel"、"close" 或 "resize"
 	UserConfirmed    bool                   `json:"user_confirmed"`
 	InitialDirectory string                 `json:"initial_directory"` // 初始工作目录
 	AgentType        string                 `json:"agent_type,omitempty"` // "terminal" or "knowledge"
+	Cols             int                    `json:"cols,omitempty"`       // resize：终端列数
+	Rows             int                    `json:"rows,omitempty"`       // resize：终端行数
+	TimeoutSeconds   int                    `json:"timeout_seconds,omitempty"` // 命令超时时间，默认使用配置的 command_timeout
+	ConfirmID        string                 `json:"confirm_id,omitempty"`      // 与 user_confirmed 一起提交：需要确认时服务端返回的 confirm_id
+	AlwaysAllow      bool                   `json:"always_allow,omitempty"`    // 与 user_confirmed 一起提交：本会话内同一规则下的该工具不再询问
 }
 
 // AgentResponse Agent响应结构
@@ -49,19 +60,39 @@ type AgentResponse struct {
 	Success           bool   `json:"success"`
 	Output            string `json:"output"`
 	Error             string `json:"error,omitempty"`
+	Code              string `json:"code,omitempty"` // 出错时的机器可读错误码
 	Cwd               string `json:"cwd"`
 	RequiresConfirm   bool   `json:"requires_confirm"`
 	ConfirmMessage    string `json:"confirm_message,omitempty"`
+	ConfirmID         string `json:"confirm_id,omitempty"` // 确认后重新提交时需要携带
 	InitialDirectory  string `json:"initial_directory,omitempty"`
+
+	// 在终端中执行的命令（如 path_switch）的结构化结果
+	Stdout     string  `json:"stdout,omitempty"`
+	Stderr     string  `json:"stderr,omitempty"`
+	ExitCode   *int    `json:"exit_code,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
+
+	EnvChanges map[string]*string `json:"env_changes,omitempty"` // 命令导致的环境变量变化，被删除的变量为null
+
+	Violations []terminal.Violation `json:"violations,omitempty"` // 受限模式下命令违反的限制，inferred 为 true 的项根据错误输出推断
+
+	Policy *policy.Result `json:"policy,omitempty"` // 需要确认或被拒绝时，策略给出的决定和匹配的规则
+
+	// 后台任务类工具（run_background、job_output、job_status、job_kill）的结构化结果
+	Job       *terminal.JobStatus  `json:"job,omitempty"`
+	Jobs      []terminal.JobStatus `json:"jobs,omitempty"`
+	JobOutput *terminal.JobOutput  `json:"job_output,omitempty"`
+
+	ChangesetID string `json:"changeset_id,omitempty"` // apply_changeset 应用的变更集，可通过 /agent/changesets/{id}/revert 撤销
 }
 
 var logMutex sync.Mutex
-var terminals sync.Map // 存储所有活动的终端会话
 
 // WebSocket相关
 var wsUpgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有来源
+		return accessGuard.OriginAllowed(r) // 仅允许同源或白名单中的来源
 	},
 }
 var wsClients = make(map[*websocket.Conn]bool)
@@ -69,62 +100,75 @@ var wsClientsMutex sync.Mutex
 var lastKBModTime time.Time
 
 func main() {
-	// 初始化工作空间管理器
-	defaultWorkspace := "./KnowledgeBase"
-	InitWorkspaceManager(defaultWorkspace, func(newPath string) {
-		log.Printf("工作空间已切换至: %s", newPath)
-		broadcastWorkspaceChange(newPath)
-	})
-
-	// API端点必须在静态文件服务器之前注册
-	// API端点：记录交互日志
-	http.HandleFunc("/log", handleLog)
+	initLogger()
 
-	// API端点：HTML预览
-	http.HandleFunc("/preview", handlePreview)
+	// 解析启动配置（命令行参数、环境变量、配置文件）
+	cfg, err := LoadServerConfig(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		slog.Error("failed to load server config", "error", err)
+		os.Exit(1)
+	}
+	serverConfig = cfg
 
-	// API端点：图片上传
-	http.HandleFunc("/upload-image", handleImageUpload)
+	// 初始化访问控制（首次启动时生成访问令牌）
+	if err := InitAccessGuard(serverConfig.TokenPath(), serverConfig.AllowedOrigins); err != nil {
+		slog.Error("failed to initialize access guard", "error", err)
+		os.Exit(1)
+	}
 
-	// API端点：Agent执行
-	http.HandleFunc("/agent/execute", handleAgentExecute)
+	// HTTPS模式：加载或生成证书
+	var tlsSetup *TLSSetup
+	if serverConfig.TLS {
+		if tlsSetup, err = LoadTLS(serverConfig); err != nil {
+			slog.Error("failed to set up tls", "error", err)
+			os.Exit(1)
+		}
+	}
 
-	// API端点：获取可用工具
-	http.HandleFunc("/agent/tools", handleAgentTools)
+	// 加载前端配置（内置默认值 + 数据目录中的用户配置）
+	if err := InitAppConfigStore(serverConfig.AppConfigPath()); err != nil {
+		slog.Error("failed to initialize app config", "error", err)
+		os.Exit(1)
+	}
 
-	// API端点：保存Agent日志
-	http.HandleFunc("/agent/save-log", handleAgentSaveLog)
+	// 初始化终端会话管理器（空闲会话定期回收）
+	InitSessionManager(serverConfig.TerminalOptions(), time.Duration(serverConfig.Terminal.IdleTimeout), serverConfig.Terminal.MaxSessions)
 
-	// 知识库API端点
-	http.HandleFunc("/api/notes", handleNotes)
-	http.HandleFunc("/api/notes/upload-image", handleNoteImageUpload)
-	http.HandleFunc("/api/notes/move", handleMoveNote)
-	http.HandleFunc("/api/notes/delete", handleDeleteNote)
-	http.HandleFunc("/api/notes/pdf-followup", handlePdfFollowup)
-	http.HandleFunc("/api/notes/", handleNoteByID)
-	http.HandleFunc("/api/search", handleSearchNotes)
-	http.HandleFunc("/agent/knowledge/tools", handleKnowledgeAgentTools)
-	http.HandleFunc("/agent/knowledge/write-log", handleKnowledgeAgentWriteLog)
+	// 初始化工作空间管理器
+	InitWorkspaceManager(serverConfig.Workspace, func(newPath string) {
+		slog.Info("workspace changed", "path", newPath)
+		broadcastWorkspaceChange(newPath)
+	})
 
-	// 任务管理API端点
-	http.HandleFunc("/api/tasks", handleTasks)
-	http.HandleFunc("/agent/tasks/tools", handleTaskAgentTools)
-	http.HandleFunc("/agent/tasks/execute", handleTaskAgentExecute)
-	http.HandleFunc("/agent/tasks/log", handleTaskAgentLog)
+	// 初始化工具调用策略（内置规则 + 数据目录和工作空间中的规则文件）
+	if err := InitPolicyEngine(); err != nil {
+		slog.Error("failed to initialize policy engine", "error", err)
+		os.Exit(1)
+	}
 
-	// 配置API端点
-	http.HandleFunc("/api/save-config", handleSaveConfig)
+	// API端点必须在静态文件服务器之前注册（/api/v1 及旧版路由别名）
+	registerAPIRoutes(http.DefaultServeMux)
 
 	// WebSocket端点
 	http.HandleFunc("/ws/notes", handleNotesWebSocket)
+	http.HandleFunc("/ws/terminal/{session_id}", handleTerminalWebSocket)
+
+	// 自签名证书模式下提供CA证书下载
+	if tlsSetup != nil && tlsSetup.SelfSigned {
+		http.HandleFunc("GET "+caCertPath, handleCACert(tlsSetup.CACertPath))
+	}
+
+	// 健康检查（无需令牌，供进程管理器或负载均衡探测）
+	http.Handle("/healthz", apiMiddleware([]string{"GET"}, 0, handleHealthz))
 
-	// 工作空间管理API端点
-	http.HandleFunc("/api/workspace", HandleGetWorkspace)
-	http.HandleFunc("/api/workspace/set", HandleSetWorkspace)
-	http.HandleFunc("/api/workspace/browse", HandleBrowseFolder)
+	// Prometheus 指标
+	http.Handle("/metrics", apiMiddleware([]string{"GET"}, 0, handleMetrics))
 
 	// 静态文件服务：提供uploads目录的访问
-	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
+	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir(serverConfig.UploadsDir()))))
 
 	// 静态文件服务：提供KnowledgeBase目录的访问（用于图片）
 	// 注意：这里仍使用/KnowledgeBase/作为URL路径，但实际映射到动态工作空间
@@ -138,74 +182,87 @@ func main() {
 	// 设置静态文件服务器，指向嵌入的dist目录（必须放在最后）
 	distFS, err := fs.Sub(embeddedFiles, "dist")
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("failed to load embedded frontend", "error", err)
+		os.Exit(1)
 	}
 	fileServer := http.FileServer(http.FS(distFS))
 	http.Handle("/", fileServer)
 
 	// 确保uploads目录存在
-	if err := os.MkdirAll("./uploads", 0755); err != nil {
-		log.Printf("创建uploads目录失败: %v", err)
+	if err := os.MkdirAll(serverConfig.UploadsDir(), 0755); err != nil {
+		slog.Warn("failed to create uploads directory", "path", serverConfig.UploadsDir(), "error", err)
 	}
 
 	// 确保logs目录存在
-	if err := os.MkdirAll("./logs", 0755); err != nil {
-		log.Printf("创建logs目录失败: %v", err)
+	if err := os.MkdirAll(serverConfig.LogsDir(), 0755); err != nil {
+		slog.Warn("failed to create logs directory", "path", serverConfig.LogsDir(), "error", err)
 	}
 
 	// 确保知识库目录存在
 	workspacePath := workspaceManager.GetWorkspacePath()
 	if err := os.MkdirAll(workspacePath, 0755); err != nil {
-		log.Printf("创建知识库目录失败: %v", err)
+		slog.Warn("failed to create knowledge base directory", "path", workspacePath, "error", err)
 	}
 
 	// 确保任务目录存在
 	tasksPath := filepath.Join(workspacePath, "_tasks")
 	if err := os.MkdirAll(tasksPath, 0755); err != nil {
-		log.Printf("创建任务目录失败: %v", err)
+		slog.Warn("failed to create tasks directory", "path", tasksPath, "error", err)
 	}
 
+	host := serverConfig.DisplayHost()
+	httpScheme, wsScheme := serverConfig.Scheme()
 	fmt.Println("🚀 AI助手Web服务启动成功!")
-	fmt.Println("📱 请访问: http://localhost:8080")
-	fmt.Println("📝 交互日志将保存至: interactions.log.json")
-	fmt.Println("🔍 HTML预览: http://localhost:8080/preview")
-	fmt.Println("📷 图片上传: http://localhost:8080/upload-image")
+	fmt.Printf("📱 请访问: %s://%s\n", httpScheme, host)
+	fmt.Printf("📝 交互日志将保存至: %s\n", serverConfig.InteractionLogPath())
+	fmt.Printf("🔍 HTML预览: %s://%s/preview\n", httpScheme, host)
+	fmt.Printf("📷 图片上传: %s://%s/upload-image\n", httpScheme, host)
 	fmt.Printf("📚 知识库路径: %s\n", workspacePath)
-	fmt.Println("🔌 WebSocket: ws://localhost:8080/ws/notes")
+	fmt.Printf("🗂️  数据目录: %s\n", serverConfig.DataDir)
+	if serverConfig.File != "" {
+		fmt.Printf("⚙️  配置文件: %s\n", serverConfig.File)
+	}
+	fmt.Printf("🔌 WebSocket: %s://%s/ws/notes, %s://%s/ws/terminal/{session_id}\n", wsScheme, host, wsScheme, host)
+	fmt.Printf("📈 指标: %s://%s/metrics\n", httpScheme, host)
+	fmt.Printf("🔑 访问令牌: %s (其他设备请通过 %s://%s/?token=<令牌> 登录)\n", serverConfig.TokenPath(), httpScheme, host)
+	if tlsSetup != nil && tlsSetup.SelfSigned {
+		fmt.Printf("🔒 自签名CA证书: %s (其他设备可从 %s://%s%s 下载并安装信任)\n", tlsSetup.CACertPath, httpScheme, host, caCertPath)
+		fmt.Printf("   CA指纹(SHA-256): %s\n", tlsSetup.CAFingerprint)
+	}
 	fmt.Println("⏹️  按 Ctrl+C 停止服务")
 
 	// 启动文件监控协程
 	go monitorKnowledgeBase()
 
 	// 启动HTTP服务器
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	server := &http.Server{
+		Addr:    serverConfig.Addr,
+		Handler: observeRequests(http.DefaultServeMux, accessGuard.Middleware(http.DefaultServeMux)),
+	}
+	if tlsSetup != nil {
+		server.TLSConfig = tlsSetup.Config
+	}
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			// 证书已在 TLSConfig 中，无需再传文件路径
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("http server failed", "addr", serverConfig.Addr, "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// 等待退出信号并优雅关闭
+	waitForShutdown(server)
 }
 
 func handleLog(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头，允许前端访问
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 读取请求体
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
 	var logEntry InteractionLog
-	if err := json.Unmarshal(body, &logEntry); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !decodeJSON(w, r, &logEntry) {
 		return
 	}
 
@@ -214,8 +271,8 @@ func handleLog(w http.ResponseWriter, r *http.Request) {
 
 	// 写入日志文件
 	if err := writeLogEntry(logEntry); err != nil {
-		log.Printf("Error writing log: %v", err)
-		http.Error(w, "Failed to write log", http.StatusInternalServerError)
+		slog.Error("failed to write interaction log", "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to write log")
 		return
 	}
 
@@ -224,10 +281,11 @@ func handleLog(w http.ResponseWriter, r *http.Request) {
 }
 
 func writeLogEntry(entry InteractionLog) error {
+	defer beginWrite()()
 	logMutex.Lock()
 	defer logMutex.Unlock()
 
-	logFile := "interactions.log.json"
+	logFile := serverConfig.InteractionLogPath()
 
 	var logs []InteractionLog
 
@@ -267,16 +325,12 @@ func writeLogEntry(entry InteractionLog) error {
 	return nil
 }
 
-func handlePreview(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
+// PreviewRequest HTML预览请求
+type PreviewRequest struct {
+	HTML string `json:"html"`
+}
 
+func handlePreview(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
 		// 返回预览页面模板
 		previewTemplate := `<!DOCTYPE html>
@@ -367,26 +421,15 @@ func handlePreview(w http.ResponseWriter, r *http.Request) {
 		var htmlContent string
 
 		if strings.Contains(contentType, "application/json") {
-			// 处理JSON格式的请求
-			body, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				http.Error(w, "Failed to read request body", http.StatusBadRequest)
-				return
-			}
-
-			var request struct {
-				HTML string `json:"html"`
-			}
-
-			if err := json.Unmarshal(body, &request); err != nil {
-				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			var request PreviewRequest
+			if !decodeJSON(w, r, &request) {
 				return
 			}
 			htmlContent = request.HTML
 		} else {
 			// 处理表单格式的请求
 			if err := r.ParseForm(); err != nil {
-				http.Error(w, "Failed to parse form", http.StatusBadRequest)
+				writeBodyError(w, err, CodeBadRequest, "Failed to parse form")
 				return
 			}
 			htmlContent = r.FormValue("html")
@@ -398,34 +441,20 @@ func handlePreview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 }
 
 func handleImageUpload(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 解析multipart表单，限制最大内存为10MB
+	// 解析multipart表单，最多10MB保存在内存中（请求体总大小由路由上限控制）
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, CodeBadRequest, "Failed to parse form")
 		return
 	}
 
 	// 获取上传的文件
 	file, handler, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Failed to get file", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Failed to get file")
 		return
 	}
 	defer file.Close()
@@ -433,28 +462,28 @@ func handleImageUpload(w http.ResponseWriter, r *http.Request) {
 	// 验证文件类型
 	contentType := handler.Header.Get("Content-Type")
 	if !strings.HasPrefix(contentType, "image/") {
-		http.Error(w, "File must be an image", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "File must be an image")
 		return
 	}
 
 	// 生成唯一的文件名
 	ext := filepath.Ext(handler.Filename)
 	filename := fmt.Sprintf("%d_%s%s", time.Now().Unix(), generateRandomString(8), ext)
-	filePath := filepath.Join("./uploads", filename)
+	filePath := filepath.Join(serverConfig.UploadsDir(), filename)
 
 	// 创建目标文件
 	dst, err := os.Create(filePath)
 	if err != nil {
-		log.Printf("Failed to create file: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		slog.Error("failed to create upload file", "path", filePath, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to save file")
 		return
 	}
 	defer dst.Close()
 
 	// 将上传的文件内容复制到目标文件
 	if _, err := dst.ReadFrom(file); err != nil {
-		log.Printf("Failed to write file: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		slog.Error("failed to write upload file", "path", filePath, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to save file")
 		return
 	}
 
@@ -480,30 +509,16 @@ func generateRandomString(length int) string {
 
 // handleNoteImageUpload 处理笔记中的图片上传
 func handleNoteImageUpload(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 解析multipart表单，限制最大内存为10MB
+	// 解析multipart表单，最多10MB保存在内存中（请求体总大小由路由上限控制）
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, CodeBadRequest, "Failed to parse form")
 		return
 	}
 
 	// 获取上传的文件
 	file, handler, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Failed to get file", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Failed to get file")
 		return
 	}
 	defer file.Close()
@@ -511,7 +526,7 @@ func handleNoteImageUpload(w http.ResponseWriter, r *http.Request) {
 	// 验证文件类型
 	contentType := handler.Header.Get("Content-Type")
 	if !strings.HasPrefix(contentType, "image/") {
-		http.Error(w, "File must be an image", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "File must be an image")
 		return
 	}
 
@@ -551,14 +566,14 @@ func handleNoteImageUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		// 固定路径模式：统一存储在uploads/nodes
-		uploadsDir = "./uploads/nodes"
+		uploadsDir = filepath.Join(serverConfig.UploadsDir(), "nodes")
 		webPath = fmt.Sprintf("/uploads/nodes/%s", filename)
 	}
 
 	// 确保目录存在
 	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		log.Printf("Failed to create uploads directory: %v", err)
-		http.Error(w, "Failed to create uploads directory", http.StatusInternalServerError)
+		slog.Error("failed to create uploads directory", "path", uploadsDir, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to create uploads directory")
 		return
 	}
 
@@ -567,16 +582,16 @@ func handleNoteImageUpload(w http.ResponseWriter, r *http.Request) {
 	// 创建目标文件
 	dst, err := os.Create(filePath)
 	if err != nil {
-		log.Printf("Failed to create file: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		slog.Error("failed to create upload file", "path", filePath, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to save file")
 		return
 	}
 	defer dst.Close()
 
 	// 将上传的文件内容复制到目标文件
 	if _, err := dst.ReadFrom(file); err != nil {
-		log.Printf("Failed to write file: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		slog.Error("failed to write upload file", "path", filePath, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to save file")
 		return
 	}
 
@@ -593,20 +608,6 @@ func handleNoteImageUpload(w http.ResponseWriter, r *http.Request) {
 
 // handleAgentTools 返回可用的工具列表
 func handleAgentTools(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	availableTools := tools.GetAvailableTools()
 
 	w.Header().Set("Content-Type", "application/json")
@@ -617,41 +618,14 @@ func handleAgentTools(w http.ResponseWriter, r *http.Request) {
 
 // handleAgentExecute 处理Agent命令执行请求
 func handleAgentExecute(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 读取请求体
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
 	var req AgentRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	// 如果是关闭请求
 	if req.Action == "close" {
-		if term, ok := terminals.Load(req.SessionID); ok {
-			if t, ok := term.(terminal.Terminal); ok {
-				t.Close()
-			}
-			terminals.Delete(req.SessionID)
-		}
+		sessionManager.Close(req.SessionID)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(AgentResponse{
@@ -661,87 +635,136 @@ func handleAgentExecute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取或创建终端实例
-	var term terminal.Terminal
-	var initialDir string
+	// 终止会话中正在执行的命令（会话本身保留）
+	if req.Action == "cancel" {
+		handleTerminalCancel(w, req)
+		return
+	}
 
-	if t, ok := terminals.Load(req.SessionID); ok {
-		term = t.(terminal.Terminal)
-	} else {
-		newTerm, err := terminal.New()
-		if err != nil {
-			log.Printf("Failed to create terminal: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(AgentResponse{
+	// 调整终端窗口大小（仅PTY模式支持）
+	if req.Action == "resize" {
+		handleTerminalResize(w, req)
+		return
+	}
+
+	// 获取或创建终端会话，请求处理期间会话不会被空闲回收
+	// 受限模式下会话的工作目录限制在 initial_directory 之下
+	session, err := sessionManager.Acquire(req.SessionID, req.InitialDirectory)
+	if err != nil {
+		if errors.Is(err, ErrTooManySessions) {
+			writeJSON(w, http.StatusServiceUnavailable, AgentResponse{
 				Success: false,
-				Error:   fmt.Sprintf("Failed to create terminal: %v", err),
+				Code:    CodeTooManySessions,
+				Error:   fmt.Sprintf("Too many terminal sessions (limit %d), close an unused session and retry", serverConfig.Terminal.MaxSessions),
 			})
 			return
 		}
-		term = newTerm
-		terminals.Store(req.SessionID, term)
-		initialDir = term.GetCwd()
+		slog.Error("failed to create terminal", "session_id", req.SessionID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, AgentResponse{
+			Success: false,
+			Code:    CodeTerminalError,
+			Error:   fmt.Sprintf("Failed to create terminal: %v", err),
+		})
+		return
 	}
+	defer session.Release()
+	term := session.Term
 
-	// 如果是第一次请求，记录初始目录
-	if req.InitialDirectory == "" {
-		initialDir = term.GetCwd()
-	} else {
-		initialDir = req.InitialDirectory
-	}
+	// 初始目录在创建会话时确定，之后请求中的 initial_directory 不再生效
+	initialDir := session.InitialDir
 
-	// 检查是否需要用户确认
-	needsConfirm, confirmMsg := checkIfNeedsConfirmation(req.Tool, req.Args, initialDir, term.GetCwd())
+	agent := agentTerminal
+	if req.AgentType == agentKnowledge {
+		agent = agentKnowledge
+	}
 
-	if needsConfirm && !req.UserConfirmed {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(AgentResponse{
-			Success:          false,
-			RequiresConfirm:  true,
-			ConfirmMessage:   confirmMsg,
-			Cwd:              term.GetCwd(),
-			InitialDirectory: initialDir,
-		})
+	// 按策略决定直接执行、需要用户确认还是拒绝
+	cwd := term.GetCwd()
+	call := newPolicyCall(agent, req, initialDir, cwd)
+	if !authorizeToolCall(w, session, req, call, cwd, initialDir) {
 		return
 	}
 
 	// 根据Agent类型执行不同的工具
-	var result *tools.ToolResult
-	var output string
 
-	if req.AgentType == "knowledge" {
+	if agent == agentKnowledge {
 		// 执行知识库工具
 		workspacePath := workspaceManager.GetWorkspacePath()
 		knowledgeOutput, err := notes.ExecuteKnowledgeTool(req.Tool, req.Args, workspacePath)
+		metrics.ObserveTool("knowledge", req.Tool, err)
 		if err != nil {
-			log.Printf("Failed to execute knowledge tool: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(AgentResponse{
+			slog.Warn("knowledge tool failed", "tool", req.Tool, "error", err)
+			status, code := classifyError(err)
+			writeJSON(w, status, AgentResponse{
 				Success: false,
+				Code:    code,
 				Error:   fmt.Sprintf("Failed to execute knowledge tool: %v", err),
 				Cwd:     workspacePath,
 			})
 			return
 		}
-		output = knowledgeOutput
 
 		// 返回成功响应
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(AgentResponse{
 			Success: true,
-			Output:  output,
+			Output:  knowledgeOutput,
 			Cwd:     workspacePath,
 		})
 		return
 	}
 
+	// 文件类工具在服务进程中直接读写，相对路径按终端的当前目录解析，与策略评估的路径一致；list_files 和 glob 未指定路径时使用当前目录
+	var paths []string
+	switch req.Tool {
+	case "read_file", "write_file", "edit_file", "grep", "list_files", "glob":
+		if key, path := toolCallPath(req.Args, cwd); key != "" {
+			req.Args[key] = path
+			paths = append(paths, path)
+		} else if req.Tool == "list_files" || req.Tool == "glob" {
+			req.Args["path"] = cwd
+			paths = append(paths, cwd)
+		}
+	case "apply_changeset":
+		for _, entry := range tools.ChangesetEntries(req.Args) {
+			if key, path := toolCallPath(entry, cwd); key != "" {
+				entry[key] = path
+				paths = append(paths, path)
+			}
+		}
+	case "path_switch":
+		if _, path := toolCallPath(req.Args, cwd); path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	// 受限模式下工具涉及的路径必须位于会话根目录之下，在执行前检查
+	for _, path := range paths {
+		if !term.Allows(path) {
+			err := fmt.Errorf("%w: %s is outside the sandbox root", tools.ErrPathDenied, path)
+			metrics.ObserveTool("terminal", req.Tool, err)
+			slog.Warn("tool path outside sandbox", "tool", req.Tool, "session_id", req.SessionID, "path", path)
+			status, code := classifyError(err)
+			writeJSON(w, status, AgentResponse{
+				Success:          false,
+				Code:             code,
+				Error:            fmt.Sprintf("Failed to execute tool: %v", err),
+				Cwd:              term.GetCwd(),
+				InitialDirectory: initialDir,
+			})
+			return
+		}
+	}
+
 	// 执行终端工具
-	result, err = tools.ExecuteTool(req.Tool, req.Args)
+	result, err := tools.ExecuteTool(req.Tool, req.Args)
 	if err != nil {
-		log.Printf("Failed to execute tool: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(AgentResponse{
+		metrics.ObserveTool("terminal", req.Tool, err)
+		slog.Warn("terminal tool failed", "tool", req.Tool, "session_id", req.SessionID, "error", err)
+		status, code := classifyError(err)
+		writeJSON(w, status, AgentResponse{
 			Success:          false,
+			Code:             code,
 			Error:            fmt.Sprintf("Failed to execute tool: %v", err),
 			Cwd:              term.GetCwd(),
 			InitialDirectory: initialDir,
@@ -749,112 +772,184 @@ func handleAgentExecute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 后台任务在会话中启动和查询，不占用终端
+	if result.Job != nil {
+		handleJobTool(w, r, session, req.Tool, result.Job, initialDir)
+		return
+	}
+
+	// 多文件修改先保存回滚记录再应用
+	if result.Changeset != nil {
+		handleChangesetTool(w, session, result.Changeset, initialDir)
+		return
+	}
+
 	// 如果是直接结果，直接使用输出
 	if result.DirectResult {
-		output = result.Output
-	} else if result.IsCommand {
-		// 如果是命令，在终端中执行
-		cmdOutput, err := term.Execute(result.Command)
-		if err != nil {
-			log.Printf("Failed to execute command: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(AgentResponse{
-				Success:          false,
-				Error:            fmt.Sprintf("Failed to execute command: %v", err),
-				Output:           cmdOutput,
-				Cwd:              term.GetCwd(),
-				InitialDirectory: initialDir,
-			})
-			return
+		metrics.ObserveTool("terminal", req.Tool, nil)
+		writeJSON(w, http.StatusOK, AgentResponse{
+			Success:          true,
+			Output:           result.Output,
+			Cwd:              term.GetCwd(),
+			InitialDirectory: initialDir,
+		})
+		return
+	}
+
+	// 其余工具（path_switch）需要改变 shell 的工作目录，在 shell 中执行 cd，路径经过引用
+	command, err := terminal.ChdirCommand(result.Chdir)
+	if err != nil {
+		metrics.ObserveTool("terminal", req.Tool, err)
+		writeJSON(w, http.StatusBadRequest, AgentResponse{
+			Success:          false,
+			Code:             CodeBadRequest,
+			Error:            fmt.Sprintf("Failed to execute tool: %v", err),
+			Cwd:              term.GetCwd(),
+			InitialDirectory: initialDir,
+		})
+		return
+	}
+
+	// 在终端中执行（输出同时推送给 /ws/terminal/{session_id} 的订阅者），超时或客户端断开时终止命令
+	ctx, cancel := context.WithTimeout(r.Context(), serverConfig.CommandTimeout(req.TimeoutSeconds))
+	defer cancel()
+	cmdResult, err := streamCommand(ctx, session, command)
+	if cmdResult != nil {
+		metrics.ObserveCommand(cmdResult.Duration, err)
+	}
+	metrics.ObserveTool("terminal", req.Tool, err)
+	if err != nil {
+		slog.Warn("terminal command failed", "tool", req.Tool, "session_id", req.SessionID, "error", err)
+		if errors.Is(err, terminal.ErrSessionClosed) {
+			// shell 已无法继续使用，下次请求时重新创建会话
+			sessionManager.Discard(session)
 		}
-		output = cmdOutput
+		status, code := classifyTerminalError(err)
+		resp := AgentResponse{Cwd: term.GetCwd(), InitialDirectory: initialDir}
+		if cmdResult != nil {
+			resp = commandResponse(cmdResult, term.GetCwd(), initialDir)
+		}
+		resp.Success = false
+		resp.Code = code
+		resp.Error = fmt.Sprintf("Failed to execute command: %v", err)
+		resp.Violations = append(resp.Violations, sandboxViolations(err)...)
+		writeJSON(w, status, resp)
+		return
 	}
 
-	// 返回成功响应
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(AgentResponse{
+	// 命令以非零状态退出仍视为工具执行成功，由Agent根据 exit_code 和 stderr 判断
+	writeJSON(w, http.StatusOK, commandResponse(cmdResult, term.GetCwd(), initialDir))
+}
+
+// commandResponse 将终端命令的执行结果转换为Agent响应
+func commandResponse(result *terminal.Result, cwd, initialDir string) AgentResponse {
+	exitCode := result.ExitCode
+	return AgentResponse{
 		Success:          true,
-		Output:           output,
-		Cwd:              term.GetCwd(),
+		Output:           result.Stdout,
+		Cwd:              cwd,
 		InitialDirectory: initialDir,
-	})
+		Stdout:           result.Stdout,
+		Stderr:           result.Stderr,
+		ExitCode:         &exitCode,
+		DurationMs:       float64(result.Duration.Microseconds()) / 1000,
+		EnvChanges:       result.EnvChanges,
+		Violations:       result.Violations,
+	}
 }
 
-// checkIfNeedsConfirmation 检查操作是否需要用户确认
-func checkIfNeedsConfirmation(toolName string, args map[string]interface{}, initialDir, currentDir string) (bool, string) {
-	switch toolName {
-	case "path_switch":
-		targetPath, ok := args["path"].(string)
-		if !ok {
-			return false, ""
-		}
-
-		// 如果是绝对路径
-		if filepath.IsAbs(targetPath) {
-			// 检查是否在初始目录或其子目录下
-			absInitialDir, _ := filepath.Abs(initialDir)
-			absTargetPath, _ := filepath.Abs(targetPath)
-
-			rel, err := filepath.Rel(absInitialDir, absTargetPath)
-			if err != nil || strings.HasPrefix(rel, "..") {
-				return true, fmt.Sprintf("切换到初始目录之外的路径: %s", targetPath)
-			}
-		} else {
-			// 相对路径，检查是否会跳出初始目录
-			absCurrentDir, _ := filepath.Abs(currentDir)
-			absTargetPath := filepath.Join(absCurrentDir, targetPath)
-			absInitialDir, _ := filepath.Abs(initialDir)
-
-			rel, err := filepath.Rel(absInitialDir, absTargetPath)
-			if err != nil || strings.HasPrefix(rel, "..") {
-				return true, fmt.Sprintf("切换到初始目录之外的路径: %s (解析为 %s)", targetPath, absTargetPath)
-			}
-		}
+// sandboxViolations 返回错误中包含的受限模式违规项
+func sandboxViolations(err error) []terminal.Violation {
+	var sbErr *terminal.SandboxError
+	if errors.As(err, &sbErr) {
+		return sbErr.Violations
+	}
+	return nil
+}
 
-	case "write_file":
-		// 兼容多种路径参数名：path, file_path, filename
-		path, ok := args["path"].(string)
-		if !ok {
-			path, ok = args["file_path"].(string)
-			if !ok {
-				path, ok = args["filename"].(string)
-				if !ok {
-					return false, ""
-				}
-			}
-		}
-		return true, fmt.Sprintf("写入文件: %s", path)
+// handleTerminalCancel 终止终端会话中正在执行的命令
+func handleTerminalCancel(w http.ResponseWriter, req AgentRequest) {
+	session, ok := sessionManager.Get(req.SessionID)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, AgentResponse{
+			Success: false,
+			Code:    CodeNotFound,
+			Error:   fmt.Sprintf("Terminal session not found: %s", req.SessionID),
+		})
+		return
 	}
+	term := session.Term
 
-	return false, ""
+	output := "No command is running"
+	if term.Cancel() {
+		output = "Command canceled"
+		slog.Info("terminal command canceled", "session_id", req.SessionID)
+	}
+	writeJSON(w, http.StatusOK, AgentResponse{
+		Success: true,
+		Output:  output,
+		Cwd:     term.GetCwd(),
+	})
 }
 
-// handleAgentSaveLog 保存Agent日志到logs目录
-func handleAgentSaveLog(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
+// handleTerminalResize 调整已有终端会话的窗口大小
+func handleTerminalResize(w http.ResponseWriter, req AgentRequest) {
+	session, ok := sessionManager.Get(req.SessionID)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, AgentResponse{
+			Success: false,
+			Code:    CodeNotFound,
+			Error:   fmt.Sprintf("Terminal session not found: %s", req.SessionID),
+		})
 		return
 	}
+	term := session.Term
 
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	resizer, ok := term.(terminal.Resizer)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, AgentResponse{
+			Success: false,
+			Code:    CodeBadRequest,
+			Error:   "Terminal session does not support resizing (pipe mode)",
+			Cwd:     term.GetCwd(),
+		})
 		return
 	}
-
-	// 读取请求体
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	if err := resizer.Resize(req.Cols, req.Rows); err != nil {
+		writeJSON(w, http.StatusBadRequest, AgentResponse{
+			Success: false,
+			Code:    CodeBadRequest,
+			Error:   fmt.Sprintf("Failed to resize terminal: %v", err),
+			Cwd:     term.GetCwd(),
+		})
 		return
 	}
 
+	writeJSON(w, http.StatusOK, AgentResponse{
+		Success: true,
+		Output:  fmt.Sprintf("Terminal resized to %dx%d", req.Cols, req.Rows),
+		Cwd:     term.GetCwd(),
+	})
+}
+
+// unsafeFileNameChars 文件名中需要替换的字符
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// safeFileName 将客户端指定的名称转换为文件名（不含扩展名）
+// 替换其中不能用于文件名的字符（包括路径分隔符和 .）；替换过的名称追加哈希避免不同名称冲突
+func safeFileName(name string) string {
+	safe := unsafeFileNameChars.ReplaceAllString(name, "_")
+	if safe != name || safe == "" {
+		sum := sha256.Sum256([]byte(name))
+		safe += "-" + hex.EncodeToString(sum[:4])
+	}
+	return safe
+}
+
+// handleAgentSaveLog 保存Agent日志到logs目录
+func handleAgentSaveLog(w http.ResponseWriter, r *http.Request) {
 	var logData map[string]interface{}
-	if err := json.Unmarshal(body, &logData); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !decodeJSON(w, r, &logData) {
 		return
 	}
 
@@ -863,23 +958,24 @@ func handleAgentSaveLog(w http.ResponseWriter, r *http.Request) {
 	if sessionID == "" {
 		sessionID = fmt.Sprintf("agent_%d", time.Now().Unix())
 	}
-	logFileName := fmt.Sprintf("logs/%s.json", sessionID)
+	logFileName := filepath.Join(serverConfig.LogsDir(), safeFileName(sessionID)+".json")
 
 	// 写入日志文件
+	defer beginWrite()()
 	logBytes, err := json.MarshalIndent(logData, "", "  ")
 	if err != nil {
-		log.Printf("Failed to marshal log data: %v", err)
-		http.Error(w, "Failed to marshal log data", http.StatusInternalServerError)
+		slog.Error("failed to encode agent log", "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to marshal log data")
 		return
 	}
 
 	if err := ioutil.WriteFile(logFileName, logBytes, 0644); err != nil {
-		log.Printf("Failed to write log file: %v", err)
-		http.Error(w, "Failed to write log file", http.StatusInternalServerError)
+		slog.Error("failed to write agent log", "path", logFileName, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to write log file")
 		return
 	}
 
-	log.Printf("Agent日志已保存: %s", logFileName)
+	slog.Info("agent log saved", "path", logFileName)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -890,19 +986,6 @@ func handleAgentSaveLog(w http.ResponseWriter, r *http.Request) {
 
 // handleKnowledgeAgentTools 返回知识库专用工具列表
 func handleKnowledgeAgentTools(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	knowledgeTools := notes.GetKnowledgeTools()
 
 	w.Header().Set("Content-Type", "application/json")
@@ -911,41 +994,30 @@ func handleKnowledgeAgentTools(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// KnowledgeLogRequest 知识库Agent日志写入请求
+type KnowledgeLogRequest struct {
+	Filename string                 `json:"filename"`
+	LogEntry map[string]interface{} `json:"logEntry"`
+}
+
 // handleKnowledgeAgentWriteLog 处理日志写入请求
 func handleKnowledgeAgentWriteLog(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// 解析请求体
-	var req struct {
-		Filename string                 `json:"filename"`
-		LogEntry map[string]interface{} `json:"logEntry"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req KnowledgeLogRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	// 确保日志目录存在
-	logDir := "./logs/notes"
+	defer beginWrite()()
+	logDir := filepath.Join(serverConfig.LogsDir(), "notes")
 	if err := os.MkdirAll(logDir, 0755); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create log directory: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to create log directory: %v", err))
 		return
 	}
 
-	// 日志文件路径
-	logFilePath := filepath.Join(logDir, req.Filename)
+	// 日志文件路径：文件名由客户端指定，不能包含路径
+	logFilePath := filepath.Join(logDir, safeFileName(strings.TrimSuffix(req.Filename, ".json"))+".json")
 
 	// 读取现有日志（如果存在）
 	var logs []map[string]interface{}
@@ -959,12 +1031,12 @@ func handleKnowledgeAgentWriteLog(w http.ResponseWriter, r *http.Request) {
 	// 写入文件
 	logData, err := json.MarshalIndent(logs, "", "  ")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to marshal log data: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to marshal log data: %v", err))
 		return
 	}
 
 	if err := ioutil.WriteFile(logFilePath, logData, 0644); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write log file: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to write log file: %v", err))
 		return
 	}
 
@@ -977,23 +1049,10 @@ func handleKnowledgeAgentWriteLog(w http.ResponseWriter, r *http.Request) {
 
 // handleNotes 处理笔记列表请求
 func handleNotes(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	workspacePath := workspaceManager.GetWorkspacePath()
 	result, err := notes.ExecuteKnowledgeTool("list_notes", map[string]interface{}{}, workspacePath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeToolError(w, err)
 		return
 	}
 
@@ -1001,35 +1060,18 @@ func handleNotes(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(result))
 }
 
+// PdfFollowupRequest PDF划词追问请求
+type PdfFollowupRequest struct {
+	SelectedText string `json:"selectedText"`
+	Question     string `json:"question"`
+	Answer       string `json:"answer"`
+	PdfPath      string `json:"pdfPath"`
+}
+
 // handlePdfFollowup 处理PDF划词追问
 func handlePdfFollowup(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	var req struct {
-		SelectedText string `json:"selectedText"`
-		Question     string `json:"question"`
-		Answer       string `json:"answer"`
-		PdfPath      string `json:"pdfPath"`
-	}
-	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	var req PdfFollowupRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -1039,14 +1081,10 @@ func handlePdfFollowup(w http.ResponseWriter, r *http.Request) {
 
 	// 调用notes包的AppendToFollowupNote函数
 	workspacePath := workspaceManager.GetWorkspacePath()
-	err = notes.AppendToFollowupNote(req.SelectedText, req.Question, req.Answer, pdfFileName, workspacePath)
+	err := notes.AppendToFollowupNote(req.SelectedText, req.Question, req.Answer, pdfFileName, workspacePath)
 	if err != nil {
-		log.Printf("PDF追问失败: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		slog.Warn("failed to save pdf follow-up", "pdf", pdfFileName, "error", err)
+		writeToolError(w, err)
 		return
 	}
 
@@ -1060,46 +1098,25 @@ func handlePdfFollowup(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// DeleteNoteRequest 删除笔记或文件夹请求
+type DeleteNoteRequest struct {
+	Path string `json:"path"`
+	Type string `json:"type"` // "file" or "folder"
+}
+
 // handleDeleteNote 处理笔记或文件夹删除
 func handleDeleteNote(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	var req struct {
-		Path string `json:"path"`
-		Type string `json:"type"` // "file" or "folder"
-	}
-	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	var req DeleteNoteRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	// 调用notes包的删除函数
 	workspacePath := workspaceManager.GetWorkspacePath()
-	err = notes.DeleteNote(req.Path, req.Type, workspacePath)
+	err := notes.DeleteNote(req.Path, req.Type, workspacePath)
 	if err != nil {
-		log.Printf("删除失败: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		slog.Warn("failed to delete note", "path", req.Path, "error", err)
+		writeToolError(w, err)
 		return
 	}
 
@@ -1113,46 +1130,25 @@ func handleDeleteNote(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// MoveNoteRequest 移动笔记或文件夹请求
+type MoveNoteRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
 // handleMoveNote 处理笔记或文件夹移动
 func handleMoveNote(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	var req struct {
-		Source      string `json:"source"`
-		Destination string `json:"destination"`
-	}
-	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	var req MoveNoteRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	// 调用notes包的移动函数
 	workspacePath := workspaceManager.GetWorkspacePath()
-	err = notes.MoveNote(req.Source, req.Destination, workspacePath)
+	err := notes.MoveNote(req.Source, req.Destination, workspacePath)
 	if err != nil {
-		log.Printf("移动文件失败: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		slog.Warn("failed to move note", "source", req.Source, "destination", req.Destination, "error", err)
+		writeToolError(w, err)
 		return
 	}
 
@@ -1166,28 +1162,17 @@ func handleMoveNote(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// UpdateNoteRequest 更新笔记内容请求
+type UpdateNoteRequest struct {
+	Content string `json:"content"`
+}
+
 // handleNoteByID 处理单个笔记的GET/PUT/DELETE
 func handleNoteByID(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	// 提取note_id并URL解码
-	noteID := strings.TrimPrefix(r.URL.Path, "/api/notes/")
-
-	// 排除特殊路径（这些路径由其他处理器处理）
-	if noteID == "move" || noteID == "delete" || noteID == "upload-image" {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
-	}
-
-	noteID, err := url.QueryUnescape(noteID)
-	if err != nil {
-		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+	// 路由通配符中的note_id已完成URL解码
+	noteID := r.PathValue("id")
+	if noteID == "" {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Missing note ID")
 		return
 	}
 
@@ -1198,7 +1183,7 @@ func handleNoteByID(w http.ResponseWriter, r *http.Request) {
 			"note_id": noteID,
 		}, workspacePath)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeToolError(w, err)
 			return
 		}
 
@@ -1218,17 +1203,8 @@ func handleNoteByID(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(result))
 
 	case "PUT":
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
-			return
-		}
-
-		var req struct {
-			Content string `json:"content"`
-		}
-		if err := json.Unmarshal(body, &req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		var req UpdateNoteRequest
+		if !decodeJSON(w, r, &req) {
 			return
 		}
 
@@ -1238,7 +1214,7 @@ func handleNoteByID(w http.ResponseWriter, r *http.Request) {
 			"content": req.Content,
 		}, workspacePath)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeToolError(w, err)
 			return
 		}
 
@@ -1249,11 +1225,10 @@ func handleNoteByID(w http.ResponseWriter, r *http.Request) {
 		})
 
 	case "DELETE":
-		// 删除笔记
+		// 删除笔记（经过路径校验，禁止删除知识库之外的文件）
 		workspacePath := workspaceManager.GetWorkspacePath()
-		notePath := filepath.Join(workspacePath, noteID+".md")
-		if err := os.Remove(notePath); err != nil {
-			http.Error(w, "Failed to delete note", http.StatusInternalServerError)
+		if err := notes.DeleteNote(noteID+".md", "file", workspacePath); err != nil {
+			writeToolError(w, err)
 			return
 		}
 
@@ -1264,28 +1239,15 @@ func handleNoteByID(w http.ResponseWriter, r *http.Request) {
 		})
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 	}
 }
 
 // handleSearchNotes 处理笔记搜索
 func handleSearchNotes(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		http.Error(w, "Missing query parameter 'q'", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Missing query parameter 'q'")
 		return
 	}
 
@@ -1294,7 +1256,7 @@ func handleSearchNotes(w http.ResponseWriter, r *http.Request) {
 		"query": query,
 	}, workspacePath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeToolError(w, err)
 		return
 	}
 
@@ -1302,65 +1264,11 @@ func handleSearchNotes(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(result))
 }
 
-// handleSaveConfig 保存配置到config.json
-func handleSaveConfig(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 读取请求体
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	// 验证JSON格式
-	var config map[string]interface{}
-	if err := json.Unmarshal(body, &config); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	// 格式化JSON并写入文件
-	formattedJSON, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		http.Error(w, "Failed to format JSON", http.StatusInternalServerError)
-		return
-	}
-
-	// 保存到web/config.json
-	configPath := "./web/config.json"
-	if err := ioutil.WriteFile(configPath, formattedJSON, 0644); err != nil {
-		log.Printf("Failed to write config file: %v", err)
-		http.Error(w, "Failed to save config", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("配置已保存到: %s", configPath)
-
-	// 返回成功响应
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Configuration saved successfully",
-	})
-}
-
 // handleNotesWebSocket 处理知识库WebSocket连接
 func handleNotesWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket升级失败: %v", err)
+		slog.Warn("websocket upgrade failed", "error", err)
 		return
 	}
 	defer conn.Close()
@@ -1368,9 +1276,10 @@ func handleNotesWebSocket(w http.ResponseWriter, r *http.Request) {
 	// 注册客户端
 	wsClientsMutex.Lock()
 	wsClients[conn] = true
+	clients := len(wsClients)
 	wsClientsMutex.Unlock()
 
-	log.Printf("新的WebSocket客户端已连接, 当前客户端数: %d", len(wsClients))
+	slog.Info("websocket client connected", "remote", r.RemoteAddr, "clients", clients)
 
 	// 保持连接直到客户端断开
 	for {
@@ -1379,8 +1288,9 @@ func handleNotesWebSocket(w http.ResponseWriter, r *http.Request) {
 			// 客户端断开连接
 			wsClientsMutex.Lock()
 			delete(wsClients, conn)
+			clients := len(wsClients)
 			wsClientsMutex.Unlock()
-			log.Printf("WebSocket客户端已断开, 当前客户端数: %d", len(wsClients))
+			slog.Info("websocket client disconnected", "remote", r.RemoteAddr, "clients", clients)
 			break
 		}
 	}
@@ -1388,41 +1298,27 @@ func handleNotesWebSocket(w http.ResponseWriter, r *http.Request) {
 
 // broadcastNotesUpdate 广播知识库更新通知
 func broadcastNotesUpdate() {
-	wsClientsMutex.Lock()
-	defer wsClientsMutex.Unlock()
-
-	message := map[string]string{
+	broadcastMessage(map[string]string{
 		"type": "refresh_notes",
-	}
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("序列化WebSocket消息失败: %v", err)
-		return
-	}
-
-	// 向所有连接的客户端发送消息
-	for conn := range wsClients {
-		err := conn.WriteMessage(websocket.TextMessage, messageJSON)
-		if err != nil {
-			log.Printf("发送WebSocket消息失败: %v", err)
-			conn.Close()
-			delete(wsClients, conn)
-		}
-	}
+	})
 }
 
 // broadcastWorkspaceChange 广播工作空间变更通知
 func broadcastWorkspaceChange(newPath string) {
+	broadcastMessage(map[string]string{
+		"type":      "workspace_changed",
+		"workspace": newPath,
+	})
+}
+
+// broadcastMessage 向所有WebSocket客户端发送JSON消息
+func broadcastMessage(message interface{}) {
 	wsClientsMutex.Lock()
 	defer wsClientsMutex.Unlock()
 
-	message := map[string]string{
-		"type":      "workspace_changed",
-		"workspace": newPath,
-	}
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
-		log.Printf("序列化WebSocket消息失败: %v", err)
+		slog.Error("failed to encode websocket message", "error", err)
 		return
 	}
 
@@ -1430,7 +1326,7 @@ func broadcastWorkspaceChange(newPath string) {
 	for conn := range wsClients {
 		err := conn.WriteMessage(websocket.TextMessage, messageJSON)
 		if err != nil {
-			log.Printf("发送WebSocket消息失败: %v", err)
+			slog.Warn("failed to send websocket message", "error", err)
 			conn.Close()
 			delete(wsClients, conn)
 		}
@@ -1466,7 +1362,7 @@ func monitorKnowledgeBase() {
 	for range ticker.C {
 		currentModTime := getKBModTime()
 		if currentModTime.After(lastKBModTime) {
-			log.Printf("检测到知识库文件变化，通知客户端刷新")
+			slog.Info("knowledge base changed, notifying clients")
 			lastKBModTime = currentModTime
 			broadcastNotesUpdate()
 		}
@@ -1475,19 +1371,6 @@ func monitorKnowledgeBase() {
 
 // handleTaskAgentTools 返回任务管理专用工具列表
 func handleTaskAgentTools(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	taskTools := tasks.GetTaskTools()
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1496,34 +1379,16 @@ func handleTaskAgentTools(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// TaskToolRequest 任务Agent工具执行请求
+type TaskToolRequest struct {
+	Tool string                 `json:"tool"`
+	Args map[string]interface{} `json:"args"`
+}
+
 // handleTaskAgentExecute 处理任务Agent工具执行
 func handleTaskAgentExecute(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 读取请求体
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	var req struct {
-		Tool string                 `json:"tool"`
-		Args map[string]interface{} `json:"args"`
-	}
-	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	var req TaskToolRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -1531,55 +1396,35 @@ func handleTaskAgentExecute(w http.ResponseWriter, r *http.Request) {
 	workspacePath := workspaceManager.GetWorkspacePath()
 	tasksPath := filepath.Join(workspacePath, "_tasks")
 	result, err := tasks.ExecuteTaskTool(req.Tool, req.Args, tasksPath)
+	metrics.ObserveTool("tasks", req.Tool, err)
 	if err != nil {
-		log.Printf("Failed to execute task tool: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("Failed to execute task tool: %v", err),
-		})
+		slog.Warn("task tool failed", "tool", req.Tool, "error", err)
+		writeToolError(w, err)
 		return
 	}
 
-	// 返回成功响应
+	// 任务工具返回JSON文本；非JSON结果编码为JSON字符串，保证响应始终是合法JSON
+	if !json.Valid([]byte(result)) {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(result))
 }
 
 // handleTaskAgentLog 处理任务Agent日志写入
 func handleTaskAgentLog(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 读取请求体
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	// 解析JSON
 	var logData map[string]interface{}
-	if err := json.Unmarshal(body, &logData); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !decodeJSON(w, r, &logData) {
 		return
 	}
 
 	// 确保 logs/tasks 目录存在
-	logsDir := "./logs/tasks"
+	defer beginWrite()()
+	logsDir := filepath.Join(serverConfig.LogsDir(), "tasks")
 	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		log.Printf("Failed to create logs directory: %v", err)
-		http.Error(w, "Failed to create logs directory", http.StatusInternalServerError)
+		slog.Error("failed to create logs directory", "path", logsDir, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to create logs directory")
 		return
 	}
 
@@ -1591,18 +1436,18 @@ func handleTaskAgentLog(w http.ResponseWriter, r *http.Request) {
 	// 将日志数据写入文件（格式化JSON）
 	formattedJSON, err := json.MarshalIndent(logData, "", "  ")
 	if err != nil {
-		log.Printf("Failed to marshal log data: %v", err)
-		http.Error(w, "Failed to format log data", http.StatusInternalServerError)
+		slog.Error("failed to encode agent log", "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to format log data")
 		return
 	}
 
 	if err := ioutil.WriteFile(logPath, formattedJSON, 0644); err != nil {
-		log.Printf("Failed to write log file: %v", err)
-		http.Error(w, "Failed to write log file", http.StatusInternalServerError)
+		slog.Error("failed to write agent log", "path", logPath, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to write log file")
 		return
 	}
 
-	log.Printf("Task agent log saved to: %s", logPath)
+	slog.Info("task agent log saved", "path", logPath)
 
 	// 返回成功响应
 	w.Header().Set("Content-Type", "application/json")
@@ -1615,24 +1460,11 @@ func handleTaskAgentLog(w http.ResponseWriter, r *http.Request) {
 
 // handleTasks 处理任务列表请求
 func handleTasks(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	workspacePath := workspaceManager.GetWorkspacePath()
 	tasksPath := filepath.Join(workspacePath, "_tasks")
 	result, err := tasks.ExecuteTaskTool("list_tasks", map[string]interface{}{}, tasksPath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeToolError(w, err)
 		return
 	}
 
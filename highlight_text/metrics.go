@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"highlight_text/agent/tools"
+)
+
+// 请求耗时直方图的桶（秒）
+var requestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// 终端命令耗时直方图的桶（秒）
+var commandBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// histogram 简单的累积直方图
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write 按 Prometheus 文本格式输出，labels 为已格式化的标签（不含花括号）
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, upper, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, wrapLabels(labels), h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, wrapLabels(labels), h.count)
+}
+
+type requestKey struct {
+	route  string
+	method string
+	status int
+}
+
+type toolKey struct {
+	agent string
+	tool  string
+}
+
+// Metrics 进程内指标，按 Prometheus 文本格式导出
+type Metrics struct {
+	mu             sync.Mutex
+	requests       map[requestKey]uint64
+	requestLatency map[string]*histogram
+	toolCalls      map[toolKey]uint64
+	toolErrors     map[toolKey]uint64
+	commandLatency *histogram
+	commandErrors  uint64
+}
+
+var metrics = &Metrics{
+	requests:       make(map[requestKey]uint64),
+	requestLatency: make(map[string]*histogram),
+	toolCalls:      make(map[toolKey]uint64),
+	toolErrors:     make(map[toolKey]uint64),
+	commandLatency: newHistogram(commandBuckets),
+}
+
+// ObserveRequest 记录一次HTTP请求
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{route, method, status}]++
+	h, ok := m.requestLatency[route]
+	if !ok {
+		h = newHistogram(requestBuckets)
+		m.requestLatency[route] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// ObserveTool 记录一次Agent工具调用
+func (m *Metrics) ObserveTool(agent, tool string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 未知工具名来自客户端输入，统一归为一个标签值以免标签数量失控
+	if errors.Is(err, tools.ErrUnknownTool) {
+		tool = "unknown"
+	}
+	key := toolKey{agent, tool}
+	m.toolCalls[key]++
+	if err != nil {
+		m.toolErrors[key]++
+	}
+}
+
+// ObserveCommand 记录一次终端命令执行
+func (m *Metrics) ObserveCommand(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.commandLatency.observe(duration.Seconds())
+	if err != nil {
+		m.commandErrors++
+	}
+}
+
+// Render 以 Prometheus 文本格式输出所有指标
+func (m *Metrics) Render(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP http_requests_total Total HTTP requests by route, method and status.")
+	fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	requestKeys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	for _, key := range requestKeys {
+		fmt.Fprintf(w, "http_requests_total{route=%q,method=%q,status=\"%d\"} %d\n",
+			key.route, key.method, key.status, m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP http_request_duration_seconds HTTP request latency by route.")
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+	routes := make([]string, 0, len(m.requestLatency))
+	for route := range m.requestLatency {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		m.requestLatency[route].write(w, "http_request_duration_seconds", fmt.Sprintf("route=%q", route))
+	}
+
+	writeToolCounter(w, "agent_tool_invocations_total", "Agent tool invocations by agent and tool.", m.toolCalls)
+	writeToolCounter(w, "agent_tool_errors_total", "Agent tool invocations that returned an error.", m.toolErrors)
+
+	fmt.Fprintln(w, "# HELP terminal_command_duration_seconds Wall time of commands executed in terminal sessions.")
+	fmt.Fprintln(w, "# TYPE terminal_command_duration_seconds histogram")
+	m.commandLatency.write(w, "terminal_command_duration_seconds", "")
+	fmt.Fprintln(w, "# HELP terminal_command_errors_total Terminal commands that failed to execute.")
+	fmt.Fprintln(w, "# TYPE terminal_command_errors_total counter")
+	fmt.Fprintf(w, "terminal_command_errors_total %d\n", m.commandErrors)
+
+	// 以下为实时计算的 gauge
+	sessions := sessionManager.Count()
+	fmt.Fprintln(w, "# HELP terminal_sessions_active Open terminal sessions.")
+	fmt.Fprintln(w, "# TYPE terminal_sessions_active gauge")
+	fmt.Fprintf(w, "terminal_sessions_active %d\n", sessions)
+
+	wsClientsMutex.Lock()
+	clients := len(wsClients)
+	wsClientsMutex.Unlock()
+	clients += terminalStreams.count()
+	fmt.Fprintln(w, "# HELP websocket_clients Connected WebSocket clients.")
+	fmt.Fprintln(w, "# TYPE websocket_clients gauge")
+	fmt.Fprintf(w, "websocket_clients %d\n", clients)
+}
+
+func writeToolCounter(w io.Writer, name, help string, values map[toolKey]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	keys := make([]toolKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].agent != keys[j].agent {
+			return keys[i].agent < keys[j].agent
+		}
+		return keys[i].tool < keys[j].tool
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{agent=%q,tool=%q} %d\n", name, key.agent, key.tool, values[key])
+	}
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// handleMetrics 以 Prometheus 文本格式输出指标
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Render(w)
+}
+
+// statusRecorder 记录响应状态码和字节数，同时保留 Hijack 能力以支持 WebSocket
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not implement http.Hijacker")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// observeRequests 记录每个请求的指标和结构化访问日志
+// 路由标签使用 ServeMux 的匹配模式，避免按原始路径产生过多标签
+func observeRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		// 去掉 Go 1.22 模式中的方法前缀，如 "GET /x"
+		if _, path, ok := strings.Cut(route, " "); ok {
+			route = path
+		}
+		duration := time.Since(start)
+
+		metrics.ObserveRequest(route, r.Method, rec.status, duration)
+		slog.Info("http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", float64(duration.Microseconds())/1000,
+			"remote", r.RemoteAddr,
+		)
+	})
+}
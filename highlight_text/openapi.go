@@ -0,0 +1,299 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"highlight_text/agent/tools"
+	"highlight_text/agent/tools/notes"
+	"highlight_text/agent/tools/tasks"
+)
+
+// OpenAPI文档路径（位于 /api/v1 之下，/api/openapi.json 为别名）
+const openAPIPath = "/openapi.json"
+
+// handleOpenAPI 返回根据路由表和工具定义生成的OpenAPI文档
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildOpenAPIDocument())
+}
+
+// buildOpenAPIDocument 根据 apiRoutes 和各Agent的工具定义生成 OpenAPI 3.1 文档
+func buildOpenAPIDocument() map[string]interface{} {
+	paths := make(map[string]interface{})
+	for _, route := range apiRoutes {
+		paths[apiV1Prefix+openAPIPathTemplate(route.path)] = pathItem(route)
+	}
+
+	paths[apiV1Prefix+openAPIPath] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "getOpenAPI",
+			"summary":     "OpenAPI文档（包含所有Agent工具的参数结构）",
+			"x-aliases":   []string{"/api" + openAPIPath},
+			"responses":   defaultResponses(nil),
+		},
+	}
+	paths["/healthz"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "getHealthz",
+			"summary":     "健康检查：工作空间和数据目录不可写时返回503（无需令牌）",
+			"security":    []map[string]interface{}{},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "OK",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": schemaOf(HealthStatus{})},
+					},
+				},
+				"503": map[string]interface{}{"description": "Service Unavailable"},
+			},
+		},
+	}
+	paths["/ws/notes"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "notesWebSocket",
+			"summary":     "WebSocket：推送 refresh_notes / workspace_changed 等事件",
+			"responses": map[string]interface{}{
+				"101": map[string]interface{}{"description": "Switching Protocols"},
+			},
+		},
+	}
+
+	// 工具参数结构：既放入 components 便于引用，也按Agent分组列出，可直接作为LLM的工具定义
+	schemas := map[string]interface{}{
+		"Error": schemaOf(APIError{}),
+	}
+	agentTools := map[string]interface{}{}
+	addTools := func(group string, defs []toolSpec) {
+		var list []map[string]interface{}
+		for _, def := range defs {
+			schemas[group+"."+def.Name] = def.Parameters
+			list = append(list, map[string]interface{}{
+				"name":        def.Name,
+				"description": def.Description,
+				"parameters":  map[string]interface{}{"$ref": "#/components/schemas/" + group + "." + def.Name},
+			})
+		}
+		agentTools[group] = list
+	}
+	addTools("terminal", terminalToolSpecs())
+	addTools("knowledge", knowledgeToolSpecs())
+	addTools("tasks", taskToolSpecs())
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       "AI助手 API",
+			"version":     "1.0.0",
+			"description": "错误响应统一为 Error 结构；工具调用的 args 结构见 x-agent-tools。",
+		},
+		"servers": []map[string]interface{}{{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"tokenHeader": map[string]interface{}{"type": "apiKey", "in": "header", "name": tokenHeader},
+				"tokenCookie": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": tokenCookie},
+				"bearer":      map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []map[string]interface{}{
+			{"tokenHeader": []string{}},
+			{"tokenCookie": []string{}},
+			{"bearer": []string{}},
+		},
+		"x-agent-tools": agentTools,
+	}
+}
+
+// pathItem 生成单个路由的 Path Item
+func pathItem(route apiRoute) map[string]interface{} {
+	var params []map[string]interface{}
+	for _, name := range pathParams(route.path) {
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "path", "required": true,
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, name := range route.query {
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "query", "required": true,
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+
+	var aliases []string
+	for _, legacy := range route.legacy {
+		aliases = append(aliases, openAPIPathTemplate(legacy))
+	}
+
+	item := make(map[string]interface{})
+	for _, method := range route.methods {
+		op := map[string]interface{}{
+			"operationId": operationID(method, route.path),
+			"summary":     route.summary,
+			"responses":   defaultResponses(route.response),
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if len(aliases) > 0 {
+			op["x-aliases"] = aliases
+		}
+		if route.request != nil && (method == "POST" || method == "PUT") {
+			contentType := "application/json"
+			if route.multipart {
+				contentType = "multipart/form-data"
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required":    true,
+				"x-max-bytes": routeBodyLimit(route),
+				"content": map[string]interface{}{
+					contentType: map[string]interface{}{"schema": schemaOf(route.request)},
+				},
+			}
+		}
+		item[strings.ToLower(method)] = op
+	}
+	return item
+}
+
+// defaultResponses 成功响应 + 统一错误响应
+func defaultResponses(response interface{}) map[string]interface{} {
+	ok := map[string]interface{}{"description": "OK"}
+	if response != nil {
+		ok["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemaOf(response)},
+		}
+	}
+	return map[string]interface{}{
+		"200": ok,
+		"default": map[string]interface{}{
+			"description": "错误",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+				},
+			},
+		},
+	}
+}
+
+// openAPIPathTemplate 将 ServeMux 的 {name...} 通配转换为 OpenAPI 的 {name}
+func openAPIPathTemplate(path string) string {
+	return strings.ReplaceAll(path, "...}", "}")
+}
+
+// pathParams 提取路径中的参数名
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(strings.Trim(segment, "{}"), "..."))
+		}
+	}
+	return names
+}
+
+// operationID 由方法和路径生成唯一的 operationId，如 POST /notes/move -> postNotesMove
+func operationID(method, path string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(method))
+	for _, segment := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '-' || r == '{' || r == '}' || r == '.'
+	}) {
+		sb.WriteString(strings.ToUpper(segment[:1]) + segment[1:])
+	}
+	return sb.String()
+}
+
+// toolSpec 各工具包中 ToolDefinition 的公共字段
+type toolSpec struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+func terminalToolSpecs() []toolSpec {
+	var specs []toolSpec
+	for _, def := range tools.GetAvailableTools() {
+		specs = append(specs, toolSpec{def.Name, def.Description, def.Parameters})
+	}
+	return specs
+}
+
+func knowledgeToolSpecs() []toolSpec {
+	var specs []toolSpec
+	for _, def := range notes.GetKnowledgeTools() {
+		specs = append(specs, toolSpec{def.Name, def.Description, def.Parameters})
+	}
+	return specs
+}
+
+func taskToolSpecs() []toolSpec {
+	var specs []toolSpec
+	for _, def := range tasks.GetTaskTools() {
+		specs = append(specs, toolSpec{def.Name, def.Description, def.Parameters})
+	}
+	return specs
+}
+
+// schemaOf 返回请求/响应体的JSON Schema：map 直接视为 Schema，其余通过反射生成
+func schemaOf(v interface{}) map[string]interface{} {
+	if schema, ok := v.(map[string]interface{}); ok {
+		return schema
+	}
+	return schemaForType(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaForType 根据Go类型和json标签生成JSON Schema
+func schemaForType(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaForType(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Struct:
+		// 处理函数对缺省字段均有兼容处理，因此不生成 required 列表
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaForType(field.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	default:
+		// interface{} 等任意类型
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"highlight_text/agent/pathutil"
+	"highlight_text/agent/policy"
+	"highlight_text/agent/tools"
+)
+
+// 规则文件名：数据目录下的 policy.json 优先于工作空间中的 .aihelper/policy.json
+const (
+	policyFileName         = "policy.json"
+	workspacePolicyDir     = ".aihelper"
+	policyDecisionsLogName = "policy-decisions.jsonl"
+)
+
+// 待确认调用的有效期和每个会话最多保留的数量
+const (
+	confirmationTTL         = 10 * time.Minute
+	maxPendingConfirmations = 32
+)
+
+// Agent类型
+const (
+	agentTerminal  = "terminal"
+	agentKnowledge = "knowledge"
+)
+
+// builtinPolicy 规则文件都没有匹配时使用的内置规则
+var builtinPolicy = &policy.Policy{Rules: []policy.Rule{
+	{Agent: agentTerminal, Tool: "path_switch", OutsideInitialDir: true, Decision: policy.Confirm, Reason: "切换到初始目录之外的路径"},
+	{Agent: agentTerminal, Tool: "write_file", Decision: policy.Confirm, Reason: "写入文件"},
+	{Agent: agentTerminal, Tool: "edit_file", Decision: policy.Confirm, Reason: "修改文件"},
+	{Agent: agentTerminal, Tool: "apply_changeset", Decision: policy.Confirm, Reason: "修改多个文件"},
+	{Agent: agentTerminal, Tool: "run_background", Decision: policy.Confirm, Reason: "在后台运行命令"},
+}}
+
+var policyEngine *policy.Engine
+
+// InitPolicyEngine 初始化策略引擎，规则文件在每次评估时按需重新加载
+func InitPolicyEngine() error {
+	if err := builtinPolicy.Compile("builtin"); err != nil {
+		return err
+	}
+	policyEngine = policy.NewEngine(builtinPolicy, policySources, protectedPaths)
+	// 遍历目录的工具同样跳过受保护的路径，避免对上级目录的 grep、list_files 读到规则文件
+	tools.Hidden = hiddenFromTools
+	return nil
+}
+
+// policySources 返回规则文件，靠前的优先
+// 工作空间中的规则文件可能随仓库内容变化，只能收紧内置规则；数据目录中的规则文件由服务的使用者维护，可以放宽
+func policySources() []policy.Source {
+	return []policy.Source{
+		{Path: serverConfig.PolicyPath()},
+		{Path: filepath.Join(workspaceManager.GetWorkspacePath(), workspacePolicyDir, policyFileName), Untrusted: true},
+	}
+}
+
+// hiddenFromTools 遍历目录时跳过受保护的路径
+// 遍历不跟随符号链接，只需解析与受保护路径同名的文件和目录，避免对每一项都解析路径
+func hiddenFromTools(path string) bool {
+	name := pathutil.Fold(filepath.Base(path))
+	for _, p := range protectedPaths() {
+		if name == pathutil.Fold(filepath.Base(p)) {
+			return policyEngine.Protected(path)
+		}
+	}
+	return false
+}
+
+// protectedPaths 不允许工具访问的路径：数据目录中的规则文件和工作空间中规则文件所在的整个目录
+func protectedPaths() []string {
+	return []string{
+		serverConfig.PolicyPath(),
+		filepath.Join(workspaceManager.GetWorkspacePath(), workspacePolicyDir),
+	}
+}
+
+// PolicyDecisionRecord 每次工具调用的策略决定，追加写入 logs/policy-decisions.jsonl
+type PolicyDecisionRecord struct {
+	Time      time.Time       `json:"time"`
+	SessionID string          `json:"session_id"`
+	Agent     string          `json:"agent"`
+	Tool      string          `json:"tool"`
+	Path      string          `json:"path,omitempty"`
+	Paths     []string        `json:"paths,omitempty"`
+	Command   string          `json:"command,omitempty"`
+	Decision  policy.Decision `json:"decision"`
+	Rule      string          `json:"rule,omitempty"`
+	Reason    string          `json:"reason,omitempty"`
+	Outcome   string          `json:"outcome"` // allowed、denied、confirmation_required、confirmed 或 session_grant
+}
+
+var policyLogMutex sync.Mutex
+
+// recordPolicyDecision 追加一条决定记录，写入失败只记录日志
+func recordPolicyDecision(record PolicyDecisionRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	policyLogMutex.Lock()
+	defer policyLogMutex.Unlock()
+
+	path := filepath.Join(serverConfig.LogsDir(), policyDecisionsLogName)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("failed to record policy decision", "path", path, "error", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// sessionPolicy 会话中待确认的调用和"本会话始终允许"的授权，只保存在服务端
+type sessionPolicy struct {
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation // 键为 confirm_id
+	grants  map[string]bool                // 键为 grantKey
+}
+
+type pendingConfirmation struct {
+	call    string // callKey
+	expires time.Time
+}
+
+// request 登记一次待确认的调用，返回交给客户端的 confirm_id
+func (p *sessionPolicy) request(call string) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = make(map[string]pendingConfirmation)
+	}
+	now := time.Now()
+	for key, c := range p.pending {
+		if now.After(c.expires) || len(p.pending) >= maxPendingConfirmations {
+			delete(p.pending, key)
+		}
+	}
+	p.pending[id] = pendingConfirmation{call: call, expires: now.Add(confirmationTTL)}
+	return id
+}
+
+// confirm 核对并消耗 confirm_id，调用必须与登记时完全一致
+func (p *sessionPolicy) confirm(id, call string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.pending[id]
+	if !ok || c.call != call || time.Now().After(c.expires) {
+		return false
+	}
+	delete(p.pending, id)
+	return true
+}
+
+func (p *sessionPolicy) grant(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.grants == nil {
+		p.grants = make(map[string]bool)
+	}
+	p.grants[key] = true
+}
+
+func (p *sessionPolicy) granted(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.grants[key]
+}
+
+// callKey 标识一次调用（Agent类型、工具名和参数），用于核对确认
+func callKey(agent string, req AgentRequest) string {
+	args, _ := json.Marshal(req.Args)
+	sum := sha256.Sum256(append([]byte(agent+"\x00"+req.Tool+"\x00"), args...))
+	return hex.EncodeToString(sum[:])
+}
+
+// grantKey "始终允许"的范围：同一条规则下的同一个工具
+func grantKey(result policy.Result, tool string) string {
+	return result.Rule + "\x00" + tool
+}
+
+// toolCallPath 返回调用涉及的路径参数名及解析后的绝对路径，相对路径以 base 为起点
+func toolCallPath(args map[string]interface{}, base string) (string, string) {
+	for _, key := range []string{"path", "file_path", "filename", "note_id"} {
+		if p, ok := args[key].(string); ok && p != "" {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(base, p)
+			}
+			return key, filepath.Clean(p)
+		}
+	}
+	return "", ""
+}
+
+// newPolicyCall 根据请求构造待评估的调用
+// 终端Agent的相对路径按终端当前目录解析，知识库Agent按工作空间解析
+func newPolicyCall(agent string, req AgentRequest, initialDir, cwd string) policy.Call {
+	call := policy.Call{Agent: agent, Tool: req.Tool, InitialDir: initialDir}
+	if agent == agentKnowledge {
+		call.InitialDir = workspaceManager.GetWorkspacePath()
+		_, call.Path = toolCallPath(req.Args, call.InitialDir)
+		return call
+	}
+	_, call.Path = toolCallPath(req.Args, cwd)
+	call.Command = tools.PreviewCommand(req.Tool, req.Args)
+	if req.Tool == "apply_changeset" {
+		for _, entry := range tools.ChangesetEntries(req.Args) {
+			if _, p := toolCallPath(entry, cwd); p != "" && !slices.Contains(call.Paths, p) {
+				call.Paths = append(call.Paths, p)
+			}
+		}
+	}
+	return call
+}
+
+// policyMessage 向用户展示的说明：规则给出的原因和调用的目标
+func policyMessage(result policy.Result, call policy.Call) string {
+	reason := result.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("工具 %s", call.Tool)
+		if result.Decision == policy.Deny {
+			reason = fmt.Sprintf("策略禁止调用工具 %s", call.Tool)
+		}
+	}
+	switch {
+	case call.Path != "":
+		return fmt.Sprintf("%s: %s", reason, call.Path)
+	case len(call.Paths) > 0:
+		return fmt.Sprintf("%s: %s", reason, strings.Join(call.Paths, ", "))
+	case call.Command != "":
+		return fmt.Sprintf("%s: %s", reason, call.Command)
+	default:
+		return reason
+	}
+}
+
+// authorizeToolCall 按策略决定工具调用能否执行，不能执行时输出响应并返回 false
+// user_confirmed 只有携带服务端签发的 confirm_id、且调用与登记时完全一致时才有效
+func authorizeToolCall(w http.ResponseWriter, session *TerminalSession, req AgentRequest, call policy.Call, cwd, initialDir string) bool {
+	result := policyEngine.Evaluate(call)
+	if result.Decision == policy.Allow && result.Rule == "" && tools.RequiresShell(call.Tool) {
+		// 作为 shell 文本执行的命令不能仅凭默认决定执行，必须由规则明确允许或经用户确认
+		result = policy.Result{Decision: policy.Confirm, Rule: "shell", Reason: "以 shell 执行命令"}
+	}
+	record := PolicyDecisionRecord{
+		Time:      time.Now(),
+		SessionID: session.ID,
+		Agent:     call.Agent,
+		Tool:      call.Tool,
+		Path:      call.Path,
+		Paths:     call.Paths,
+		Command:   call.Command,
+		Decision:  result.Decision,
+		Rule:      result.Rule,
+		Reason:    result.Reason,
+	}
+
+	switch result.Decision {
+	case policy.Deny:
+		record.Outcome = "denied"
+		recordPolicyDecision(record)
+		slog.Warn("tool call denied by policy", "session_id", session.ID, "tool", call.Tool, "rule", result.Rule)
+		writeJSON(w, http.StatusForbidden, AgentResponse{
+			Success:          false,
+			Code:             CodePolicyDenied,
+			Error:            policyMessage(result, call),
+			Cwd:              cwd,
+			InitialDirectory: initialDir,
+			Policy:           &result,
+		})
+		return false
+
+	case policy.Confirm:
+		key := callKey(call.Agent, req)
+		switch {
+		case session.policy.granted(grantKey(result, call.Tool)):
+			record.Outcome = "session_grant"
+		case req.UserConfirmed && session.policy.confirm(req.ConfirmID, key):
+			record.Outcome = "confirmed"
+			if req.AlwaysAllow {
+				session.policy.grant(grantKey(result, call.Tool))
+			}
+		default:
+			record.Outcome = "confirmation_required"
+			recordPolicyDecision(record)
+			writeJSON(w, http.StatusOK, AgentResponse{
+				Success:          false,
+				RequiresConfirm:  true,
+				ConfirmMessage:   policyMessage(result, call),
+				ConfirmID:        session.policy.request(key),
+				Cwd:              cwd,
+				InitialDirectory: initialDir,
+				Policy:           &result,
+			})
+			return false
+		}
+
+	default:
+		record.Outcome = "allowed"
+	}
+	recordPolicyDecision(record)
+	return true
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"highlight_text/agent/terminal"
+)
+
+// ErrTooManySessions 会话数已达上限，且所有会话都在使用中
+var ErrTooManySessions = errors.New("too many terminal sessions")
+
+// TerminalSession 一个终端Agent会话
+type TerminalSession struct {
+	ID         string
+	Term       terminal.Terminal
+	Created    time.Time
+	InitialDir string // 创建会话时确定的初始目录，策略规则中的相对路径和 outside_initial_dir 以此为准
+
+	mu       sync.Mutex
+	lastUsed time.Time
+	running  string // 正在执行的命令
+	active   int    // 正在处理的请求数，大于0时不会被回收
+
+	policy sessionPolicy // 待确认的调用和"始终允许"的授权
+
+	jobs     map[string]*terminal.Job // 后台任务，会话关闭时终止
+	jobSeq   int
+	starting int // 已通过数量检查、正在启动的后台任务数，计入运行中任务的上限
+}
+
+// TerminalSessionInfo GET /agent/sessions 返回的会话信息
+type TerminalSessionInfo struct {
+	ID               string    `json:"id"`
+	Cwd              string    `json:"cwd"`
+	InitialDirectory string    `json:"initial_directory"`
+	CreatedAt        time.Time `json:"created_at"`
+	LastUsedAt       time.Time `json:"last_used_at"`
+	RunningCommand   string    `json:"running_command,omitempty"`
+	RunningJobs      int       `json:"running_jobs,omitempty"`
+}
+
+// TerminalSessionList GET /agent/sessions 的响应
+type TerminalSessionList struct {
+	Sessions           []TerminalSessionInfo `json:"sessions"`
+	MaxSessions        int                   `json:"max_sessions"`
+	IdleTimeoutSeconds float64               `json:"idle_timeout_seconds"`
+}
+
+// Release 结束一次使用，刷新最后使用时间
+func (s *TerminalSession) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	s.lastUsed = time.Now()
+}
+
+// setRunning 记录正在执行的命令，命令结束时传入空字符串
+func (s *TerminalSession) setRunning(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = command
+	s.lastUsed = time.Now()
+}
+
+// idle 返回会话是否空闲及最后使用时间，有请求正在使用或有后台任务在运行时不空闲
+func (s *TerminalSession) idle() (bool, time.Time) {
+	running := s.runningJobs()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active == 0 && running == 0, s.lastUsed
+}
+
+// Info 返回会话的当前状态
+func (s *TerminalSession) Info() TerminalSessionInfo {
+	runningJobs := s.runningJobs()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return TerminalSessionInfo{
+		ID:               s.ID,
+		Cwd:              s.Term.GetCwd(),
+		InitialDirectory: s.InitialDir,
+		CreatedAt:        s.Created,
+		LastUsedAt:       s.lastUsed,
+		RunningCommand:   s.running,
+		RunningJobs:      runningJobs,
+	}
+}
+
+// close 终止后台任务并关闭 shell
+func (s *TerminalSession) close() error {
+	s.killJobs()
+	return s.Term.Close()
+}
+
+// SessionManager 管理终端会话：按需创建、空闲超时回收、限制会话总数
+// 前端关闭标签页时不一定会发送 close 请求，依靠空闲回收释放 shell 进程
+type SessionManager struct {
+	mu          sync.Mutex
+	sessions    map[string]*TerminalSession
+	opts        terminal.Options
+	idleTimeout time.Duration
+	maxSessions int
+}
+
+var sessionManager *SessionManager
+
+// InitSessionManager 初始化会话管理器并启动空闲回收
+func InitSessionManager(opts terminal.Options, idleTimeout time.Duration, maxSessions int) {
+	sessionManager = &SessionManager{
+		sessions:    make(map[string]*TerminalSession),
+		opts:        opts,
+		idleTimeout: idleTimeout,
+		maxSessions: maxSessions,
+	}
+	go sessionManager.reapLoop()
+}
+
+// Acquire 获取会话（不存在时创建）并标记为使用中，用完后需调用 Release
+// 会话数达到上限时关闭最久未使用的空闲会话，没有空闲会话时返回 ErrTooManySessions
+// root 为会话的初始目录（受限模式下同时是根目录），为空时使用 shell 启动时的目录，仅在创建会话时生效
+func (m *SessionManager) Acquire(id, root string) (*TerminalSession, error) {
+	if s := m.acquireExisting(id); s != nil {
+		return s, nil
+	}
+
+	opts := m.opts
+	if opts.Sandbox != nil {
+		sandbox := *opts.Sandbox
+		sandbox.Root = root
+		opts.Sandbox = &sandbox
+	}
+
+	// 启动 shell 较慢，不持有锁
+	term, err := terminal.NewWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	initialDir := term.GetCwd()
+	if root != "" {
+		if initialDir, err = filepath.Abs(root); err != nil {
+			term.Close()
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	if s, ok := m.sessions[id]; ok {
+		// 并发请求已创建了同一会话
+		s.mu.Lock()
+		s.active++
+		s.mu.Unlock()
+		m.mu.Unlock()
+		term.Close()
+		return s, nil
+	}
+	var evicted *TerminalSession
+	if len(m.sessions) >= m.maxSessions {
+		if evicted = m.oldestIdleLocked(); evicted == nil {
+			m.mu.Unlock()
+			term.Close()
+			return nil, ErrTooManySessions
+		}
+		delete(m.sessions, evicted.ID)
+	}
+	now := time.Now()
+	s := &TerminalSession{ID: id, Term: term, Created: now, InitialDir: initialDir, lastUsed: now, active: 1}
+	m.sessions[id] = s
+	m.mu.Unlock()
+
+	if evicted != nil {
+		slog.Info("terminal session evicted", "session_id", evicted.ID, "reason", "max_sessions")
+		evicted.close()
+	}
+	slog.Info("terminal session created", "session_id", id)
+	return s, nil
+}
+
+func (m *SessionManager) acquireExisting(id string) *TerminalSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	s.active++
+	s.mu.Unlock()
+	return s
+}
+
+// oldestIdleLocked 返回最久未使用的空闲会话，调用方需持有 m.mu
+func (m *SessionManager) oldestIdleLocked() *TerminalSession {
+	var oldest *TerminalSession
+	var oldestUsed time.Time
+	for _, s := range m.sessions {
+		idle, lastUsed := s.idle()
+		if idle && (oldest == nil || lastUsed.Before(oldestUsed)) {
+			oldest, oldestUsed = s, lastUsed
+		}
+	}
+	return oldest
+}
+
+// Get 查找已有会话
+func (m *SessionManager) Get(id string) (*TerminalSession, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+// Close 关闭并移除会话（正在执行的命令会被终止），返回会话是否存在
+func (m *SessionManager) Close(id string) bool {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if err := s.close(); err != nil {
+		slog.Warn("failed to close terminal session", "session_id", id, "error", err)
+	}
+	return true
+}
+
+// Discard 移除已失效的会话（shell 已关闭）并终止其后台任务，仅当其仍是 id 对应的会话时生效
+func (m *SessionManager) Discard(s *TerminalSession) {
+	m.mu.Lock()
+	if m.sessions[s.ID] == s {
+		delete(m.sessions, s.ID)
+	}
+	m.mu.Unlock()
+	go s.killJobs()
+}
+
+// List 返回所有会话的状态，按创建时间排序
+func (m *SessionManager) List() []TerminalSessionInfo {
+	m.mu.Lock()
+	sessions := make([]*TerminalSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.Unlock()
+
+	infos := make([]TerminalSessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, s.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.Before(infos[j].CreatedAt) })
+	return infos
+}
+
+// Count 返回当前会话数
+func (m *SessionManager) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// CloseAll 关闭所有会话
+func (m *SessionManager) CloseAll() {
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*TerminalSession)
+	m.mu.Unlock()
+
+	for id, s := range sessions {
+		if err := s.close(); err != nil {
+			slog.Warn("failed to close terminal session", "session_id", id, "error", err)
+		}
+	}
+}
+
+// reapLoop 定期关闭空闲超时的会话
+func (m *SessionManager) reapLoop() {
+	interval := m.idleTimeout / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.reap(now)
+	}
+}
+
+func (m *SessionManager) reap(now time.Time) {
+	var expired []*TerminalSession
+	m.mu.Lock()
+	for id, s := range m.sessions {
+		if idle, lastUsed := s.idle(); idle && now.Sub(lastUsed) > m.idleTimeout {
+			expired = append(expired, s)
+			delete(m.sessions, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range expired {
+		slog.Info("terminal session evicted", "session_id", s.ID, "reason", "idle_timeout")
+		s.close()
+	}
+}
+
+// handleTerminalSessions 列出所有终端会话
+func handleTerminalSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, TerminalSessionList{
+		Sessions:           sessionManager.List(),
+		MaxSessions:        sessionManager.maxSessions,
+		IdleTimeoutSeconds: sessionManager.idleTimeout.Seconds(),
+	})
+}
+
+// handleTerminalSessionByID 强制关闭终端会话，正在执行的命令及其子进程会被终止
+func handleTerminalSessionByID(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !sessionManager.Close(id) {
+		writeError(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("Terminal session not found: %s", id))
+		return
+	}
+	slog.Info("terminal session killed", "session_id", id, "remote", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, AgentResponse{
+		Success: true,
+		Output:  "Terminal session closed",
+	})
+}
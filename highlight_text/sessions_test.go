@@ -0,0 +1,116 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"highlight_text/agent/terminal"
+)
+
+// newTestSessionManager 创建不启动定期回收的会话管理器，测试结束时关闭所有会话
+func newTestSessionManager(t *testing.T, maxSessions int) *SessionManager {
+	t.Helper()
+	m := &SessionManager{
+		sessions:    make(map[string]*TerminalSession),
+		opts:        terminal.Options{Mode: terminal.ModePipe},
+		idleTimeout: time.Minute,
+		maxSessions: maxSessions,
+	}
+	t.Cleanup(m.CloseAll)
+	return m
+}
+
+// startIdleSessionWithJob 创建会话并在其中启动长时间运行的后台任务，返回时会话已没有进行中的请求
+func startIdleSessionWithJob(t *testing.T, m *SessionManager, id string) *terminal.Job {
+	t.Helper()
+	s, err := m.Acquire(id, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := s.startJob(context.Background(), "sleep 60")
+	s.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestReapKeepsSessionsWithRunningJobs(t *testing.T) {
+	m := newTestSessionManager(t, 4)
+	job := startIdleSessionWithJob(t, m, "a")
+
+	later := time.Now().Add(time.Hour)
+	m.reap(later)
+	if _, ok := m.Get("a"); !ok {
+		t.Fatal("session with a running job was reaped")
+	}
+
+	job.Kill()
+	m.reap(later)
+	if _, ok := m.Get("a"); ok {
+		t.Error("session was not reaped after its job ended")
+	}
+}
+
+func TestEvictionSkipsSessionsWithRunningJobs(t *testing.T) {
+	m := newTestSessionManager(t, 1)
+	job := startIdleSessionWithJob(t, m, "a")
+
+	if _, err := m.Acquire("b", t.TempDir()); !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("Acquire(b) error = %v, want ErrTooManySessions", err)
+	}
+	if _, ok := m.Get("a"); !ok {
+		t.Fatal("session with a running job was evicted")
+	}
+
+	job.Kill()
+	s, err := m.Acquire("b", t.TempDir())
+	if err != nil {
+		t.Fatalf("Acquire(b) after the job ended: %v", err)
+	}
+	s.Release()
+	if _, ok := m.Get("a"); ok {
+		t.Error("idle session was not evicted after its job ended")
+	}
+}
+
+func TestStartJobLimitConcurrent(t *testing.T) {
+	m := newTestSessionManager(t, 1)
+	s, err := m.Acquire("a", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+
+	// 同时发起的启动请求都在等待 shell 时通过数量检查，名额必须在检查时预留
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*maxRunningJobs)
+	for i := 0; i < 2*maxRunningJobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.startJob(context.Background(), "sleep 60")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	started := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			started++
+		case !errors.Is(err, ErrTooManyJobs):
+			t.Errorf("startJob: %v", err)
+		}
+	}
+	if started != maxRunningJobs || s.runningJobs() != maxRunningJobs {
+		t.Errorf("started %d jobs (%d running), want %d", started, s.runningJobs(), maxRunningJobs)
+	}
+}
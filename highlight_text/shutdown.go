@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 优雅关闭的最长等待时间
+const shutdownTimeout = 10 * time.Second
+
+// pendingWrites 跟踪正在进行的日志写入，关闭前需等待其完成
+var pendingWrites sync.WaitGroup
+
+// beginWrite 标记一次日志写入开始，返回的函数需在写入结束时调用
+func beginWrite() func() {
+	pendingWrites.Add(1)
+	return pendingWrites.Done
+}
+
+// waitForShutdown 阻塞直到收到退出信号，然后依次关闭HTTP服务、WebSocket、终端会话并等待日志写入完成
+func waitForShutdown(server *http.Server) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigCh
+	signal.Stop(sigCh)
+
+	slog.Info("shutting down", "signal", sig.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// 停止接收新请求，并等待进行中的HTTP请求结束
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("http server shutdown timed out", "error", err)
+	}
+
+	// WebSocket连接已被劫持，Shutdown不会处理，需要单独通知客户端
+	closeAllWebSockets()
+
+	// 结束所有终端会话及其子进程
+	sessionManager.CloseAll()
+
+	// 等待尚未完成的日志写入
+	done := make(chan struct{})
+	go func() {
+		pendingWrites.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("timed out waiting for log writes; some logs may be lost")
+	}
+
+	slog.Info("server stopped")
+}
+
+// closeAllWebSockets 向所有WebSocket客户端发送关闭帧并断开连接
+func closeAllWebSockets() {
+	wsClientsMutex.Lock()
+	defer wsClientsMutex.Unlock()
+
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(time.Second)
+	for conn := range wsClients {
+		if err := conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+			slog.Warn("failed to send websocket close frame", "error", err)
+		}
+		conn.Close()
+		delete(wsClients, conn)
+	}
+
+	terminalStreams.closeAll(message, deadline)
+}
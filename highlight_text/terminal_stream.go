@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"highlight_text/agent/terminal"
+
+	"github.com/gorilla/websocket"
+)
+
+// 终端输出推送相关参数
+const (
+	terminalStreamBuffer       = 256              // 每个连接待发送事件的缓冲数，写满说明客户端跟不上，断开连接
+	terminalStreamWriteTimeout = 10 * time.Second // 单条消息的写超时
+)
+
+// TerminalEvent 通过 /ws/terminal/{session_id} 推送的终端事件
+// type 为 start（命令开始）、stdout/stderr（一行输出）、exit（命令结束）或 job_start（启动后台任务）
+type TerminalEvent struct {
+	Type       string  `json:"type"`
+	SessionID  string  `json:"session_id"`
+	Command    string  `json:"command,omitempty"`
+	JobID      string  `json:"job_id,omitempty"`
+	Data       string  `json:"data,omitempty"`
+	ExitCode   *int    `json:"exit_code,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
+	Cwd        string  `json:"cwd,omitempty"`
+	Code       string  `json:"code,omitempty"`
+	Error      string  `json:"error,omitempty"`
+
+	EnvChanges map[string]*string   `json:"env_changes,omitempty"`
+	Violations []terminal.Violation `json:"violations,omitempty"`
+}
+
+// terminalSubscriber 一个订阅终端输出的WebSocket连接
+type terminalSubscriber struct {
+	conn *websocket.Conn
+	send chan []byte
+	once sync.Once
+}
+
+func (s *terminalSubscriber) close() {
+	s.once.Do(func() { close(s.send) })
+}
+
+// terminalStreamHub 按会话ID管理订阅者，并将终端事件分发给它们
+type terminalStreamHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*terminalSubscriber]bool
+}
+
+var terminalStreams = &terminalStreamHub{subscribers: make(map[string]map[*terminalSubscriber]bool)}
+
+func (h *terminalStreamHub) subscribe(sessionID string, sub *terminalSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[sessionID] == nil {
+		h.subscribers[sessionID] = make(map[*terminalSubscriber]bool)
+	}
+	h.subscribers[sessionID][sub] = true
+}
+
+func (h *terminalStreamHub) unsubscribe(sessionID string, sub *terminalSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers[sessionID], sub)
+	if len(h.subscribers[sessionID]) == 0 {
+		delete(h.subscribers, sessionID)
+	}
+	sub.close()
+}
+
+// count 返回当前的订阅连接数
+func (h *terminalStreamHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, subs := range h.subscribers {
+		n += len(subs)
+	}
+	return n
+}
+
+// closeAll 向所有订阅者发送关闭帧并断开连接
+func (h *terminalStreamHub) closeAll(message []byte, deadline time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sessionID, subs := range h.subscribers {
+		for sub := range subs {
+			if err := sub.conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+				slog.Warn("failed to send websocket close frame", "error", err)
+			}
+			sub.conn.Close()
+			sub.close()
+		}
+		delete(h.subscribers, sessionID)
+	}
+}
+
+// publish 向会话的所有订阅者发送事件，不等待网络写入，避免拖慢命令输出的读取
+func (h *terminalStreamHub) publish(event TerminalEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subscribers[event.SessionID]
+	if len(subs) == 0 {
+		return
+	}
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode terminal event", "error", err)
+		return
+	}
+	for sub := range subs {
+		select {
+		case sub.send <- message:
+		default:
+			slog.Warn("terminal stream subscriber too slow, disconnecting", "session_id", event.SessionID)
+			delete(subs, sub)
+			sub.close()
+		}
+	}
+}
+
+// streamCommand 在终端中执行命令，执行过程中向订阅者推送输出，结束时推送 exit 事件
+// /agent/execute 的命令执行也经由此函数，订阅者可以实时看到Agent调用的工具输出；所有事件同时写入会话记录
+func streamCommand(ctx context.Context, session *TerminalSession, command string) (*terminal.Result, error) {
+	sessionID, term := session.ID, session.Term
+	session.setRunning(command)
+	defer session.setRunning("")
+
+	transcript := openTranscript(sessionID)
+	defer transcript.close()
+	publish := func(event TerminalEvent) {
+		transcript.record(event)
+		terminalStreams.publish(event)
+	}
+
+	publish(TerminalEvent{Type: "start", SessionID: sessionID, Command: command, Cwd: term.GetCwd()})
+
+	result, err := term.Stream(ctx, command, func(chunk terminal.Chunk) {
+		publish(TerminalEvent{Type: chunk.Stream, SessionID: sessionID, Data: chunk.Data})
+	})
+
+	exit := TerminalEvent{Type: "exit", SessionID: sessionID, Cwd: term.GetCwd()}
+	if result != nil {
+		exitCode := result.ExitCode
+		exit.ExitCode = &exitCode
+		exit.DurationMs = float64(result.Duration.Microseconds()) / 1000
+		exit.EnvChanges = result.EnvChanges
+		exit.Violations = result.Violations
+	}
+	if err != nil {
+		_, exit.Code = classifyTerminalError(err)
+		exit.Error = err.Error()
+		exit.Violations = append(exit.Violations, sandboxViolations(err)...)
+	}
+	publish(exit)
+
+	return result, err
+}
+
+// handleTerminalWebSocket 订阅终端会话的实时输出
+// 会话可以尚未创建：订阅后由 /agent/execute 首次执行命令时创建的会话同样会推送
+// 客户端可以发送 {"type": "cancel"} 终止正在执行的命令
+func handleTerminalWebSocket(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("session_id")
+	if sessionID == "" {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Missing session_id")
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := &terminalSubscriber{conn: conn, send: make(chan []byte, terminalStreamBuffer)}
+	terminalStreams.subscribe(sessionID, sub)
+	defer terminalStreams.unsubscribe(sessionID, sub)
+	slog.Info("terminal stream connected", "session_id", sessionID, "remote", r.RemoteAddr)
+
+	// 写协程：发送缓冲中的事件，订阅被移除（客户端过慢）时关闭连接
+	go func() {
+		for message := range sub.send {
+			conn.SetWriteDeadline(time.Now().Add(terminalStreamWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				break
+			}
+		}
+		conn.Close()
+	}()
+
+	for {
+		var message struct {
+			Type string `json:"type"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				continue
+			}
+			break
+		}
+		if message.Type == "cancel" {
+			if session, ok := sessionManager.Get(sessionID); ok && session.Term.Cancel() {
+				slog.Info("terminal command canceled", "session_id", sessionID)
+			}
+		}
+	}
+	slog.Info("terminal stream disconnected", "session_id", sessionID, "remote", r.RemoteAddr)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 自签名证书相关文件（位于数据目录的 tls 子目录）
+const (
+	caCertFile     = "ca.pem"
+	caKeyFile      = "ca-key.pem"
+	serverCertFile = "server.pem"
+	serverKeyFile  = "server-key.pem"
+)
+
+// 证书有效期：服务器证书不超过825天（iOS/iPadOS 对更长有效期的证书不予信任）
+const (
+	caValidity     = 10 * 365 * 24 * time.Hour
+	serverValidity = 800 * 24 * time.Hour
+	renewBefore    = 30 * 24 * time.Hour
+)
+
+// caCertPath 对外提供下载的CA证书路径（仅自签名模式）
+const caCertPath = "/ca.crt"
+
+// TLSSetup HTTPS模式的证书信息
+type TLSSetup struct {
+	Config        *tls.Config
+	SelfSigned    bool   // 是否为自动生成的自签名证书
+	CACertPath    string // 自签名CA证书文件（用于在平板等设备上安装信任）
+	CAFingerprint string // CA证书的SHA-256指纹
+}
+
+// LoadTLS 根据配置加载证书：优先使用指定的证书文件，否则使用（必要时生成）数据目录中的自签名证书
+func LoadTLS(cfg *ServerConfig) (*TLSSetup, error) {
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("加载HTTPS证书失败: %v", err)
+		}
+		return &TLSSetup{Config: newTLSConfig(cert)}, nil
+	}
+
+	dir := cfg.TLSDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建证书目录失败: %v", err)
+	}
+
+	caCert, caKey, err := loadOrCreateCA(dir)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadOrCreateServerCert(dir, caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(caCert.Raw)
+	return &TLSSetup{
+		Config:        newTLSConfig(cert),
+		SelfSigned:    true,
+		CACertPath:    filepath.Join(dir, caCertFile),
+		CAFingerprint: formatFingerprint(sum[:]),
+	}, nil
+}
+
+func newTLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// loadOrCreateCA 读取CA证书和私钥，不存在或已过期时重新生成
+func loadOrCreateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath := filepath.Join(dir, caCertFile)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	if cert, key, err := readCertAndKey(certPath, keyPath); err == nil {
+		if time.Now().Before(cert.NotAfter) {
+			return cert, key, nil
+		}
+		slog.Info("self-signed CA expired, regenerating", "path", certPath)
+	} else if !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("读取CA证书失败: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成CA私钥失败: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "AI Helper Local CA " + hostname, Organization: []string{"AI Helper"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成CA证书失败: %v", err)
+	}
+	if err := writeCertAndKey(certPath, keyPath, der, key); err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Info("generated self-signed CA", "path", certPath)
+	return cert, key, nil
+}
+
+// loadOrCreateServerCert 读取服务器证书；即将过期、不是由当前CA签发或未覆盖当前地址时重新签发
+func loadOrCreateServerCert(dir string, caCert *x509.Certificate, caKey *ecdsa.PrivateKey) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, serverCertFile)
+	keyPath := filepath.Join(dir, serverKeyFile)
+	dnsNames, ips := certificateHosts()
+
+	// 服务器证书可随时由CA重新签发，读取失败时直接重新生成
+	if cert, _, err := readCertAndKey(certPath, keyPath); err == nil && serverCertUsable(cert, caCert, dnsNames, ips) {
+		return tls.LoadX509KeyPair(certPath, keyPath)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("生成服务器私钥失败: %v", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: dnsNames[0], Organization: []string{"AI Helper"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(serverValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("签发服务器证书失败: %v", err)
+	}
+	if err := writeCertAndKey(certPath, keyPath, der, key); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	slog.Info("issued server certificate", "path", certPath, "dns_names", dnsNames, "ips", ips)
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+// serverCertUsable 检查已有服务器证书是否仍可使用
+func serverCertUsable(cert, caCert *x509.Certificate, dnsNames []string, ips []net.IP) bool {
+	if time.Now().Add(renewBefore).After(cert.NotAfter) {
+		return false
+	}
+	if cert.CheckSignatureFrom(caCert) != nil {
+		return false
+	}
+	for _, name := range dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if cert.VerifyHostname(ip.String()) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// certificateHosts 返回证书需覆盖的主机名和IP：localhost、本机名及所有网卡地址
+func certificateHosts() ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		dnsNames = append(dnsNames, hostname)
+		if !strings.Contains(hostname, ".") {
+			dnsNames = append(dnsNames, hostname+".local")
+		}
+	}
+
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return dnsNames, ips
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, ipNet.IP)
+	}
+	return dnsNames, ips
+}
+
+// readCertAndKey 读取PEM格式的证书和EC私钥
+func readCertAndKey(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("无效的证书文件: %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("无效的私钥文件: %s", keyPath)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// writeCertAndKey 保存证书（0644）和私钥（0600）
+func writeCertAndKey(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("保存私钥失败: %v", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("保存证书失败: %v", err)
+	}
+	return nil
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+func formatFingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// handleCACert 提供自签名CA证书下载，供平板等设备安装信任（证书是公开信息，无需令牌）
+func handleCACert(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		w.Header().Set("Content-Disposition", `attachment; filename="aihelper-ca.crt"`)
+		http.ServeFile(w, r, path)
+	}
+}
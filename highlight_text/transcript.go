@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"highlight_text/agent/terminal"
+)
+
+// 终端会话记录保存在 logs/transcripts/<会话ID>.jsonl，每行一个事件
+const transcriptsDirName = "transcripts"
+
+// asciicast 导出使用的窗口大小（与PTY的默认窗口大小一致）和空闲间隔上限
+const (
+	asciicastWidth         = 120
+	asciicastHeight        = 40
+	asciicastIdleTimeLimit = 2.0
+)
+
+// TranscriptEntry 会话记录中的一行：带时间的终端事件
+type TranscriptEntry struct {
+	Time time.Time `json:"time"`
+	TerminalEvent
+}
+
+// TranscriptCommand 会话记录中的一条命令
+type TranscriptCommand struct {
+	Command    string     `json:"command"`
+	JobID      string     `json:"job_id,omitempty"` // 后台任务的ID，后台任务的输出不记录
+	Cwd        string     `json:"cwd,omitempty"`    // 执行前的工作目录
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"` // 命令未结束（如服务异常退出）时为空
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	DurationMs float64    `json:"duration_ms,omitempty"`
+	Stdout     string     `json:"stdout"`
+	Stderr     string     `json:"stderr"`
+	Code       string     `json:"code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// TerminalTranscript GET /agent/sessions/{id}/transcript 的JSON响应
+type TerminalTranscript struct {
+	SessionID string              `json:"session_id"`
+	Commands  []TranscriptCommand `json:"commands"`
+}
+
+// transcriptRecorder 将一条命令的事件追加到会话记录
+type transcriptRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+	done func()
+}
+
+// openTranscript 打开会话记录，失败时只记录日志并返回nil（nil 可以安全使用）
+func openTranscript(sessionID string) *transcriptRecorder {
+	path := transcriptPath(sessionID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		slog.Warn("failed to create transcripts directory", "path", filepath.Dir(path), "error", err)
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("failed to open transcript", "path", path, "error", err)
+		return nil
+	}
+	return &transcriptRecorder{file: f, done: beginWrite()}
+}
+
+func (t *transcriptRecorder) record(event TerminalEvent) {
+	if t == nil {
+		return
+	}
+	data, err := json.Marshal(TranscriptEntry{Time: time.Now(), TerminalEvent: event})
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.file.Write(append(data, '\n'))
+}
+
+func (t *transcriptRecorder) close() {
+	if t == nil {
+		return
+	}
+	t.file.Close()
+	t.done()
+}
+
+// recordJobStart 记录并推送后台任务的启动
+func recordJobStart(sessionID string, job *terminal.Job) {
+	event := TerminalEvent{Type: "job_start", SessionID: sessionID, Command: job.Command, JobID: job.ID, Cwd: job.Cwd}
+	transcript := openTranscript(sessionID)
+	transcript.record(event)
+	transcript.close()
+	terminalStreams.publish(event)
+}
+
+// transcriptPath 返回会话记录的文件路径
+func transcriptPath(sessionID string) string {
+	return filepath.Join(serverConfig.LogsDir(), transcriptsDirName, safeFileName(sessionID)+".jsonl")
+}
+
+// readTranscript 读取会话记录，无法解析的行（如写入中断的最后一行）被跳过
+func readTranscript(sessionID string) ([]TranscriptEntry, error) {
+	f, err := os.Open(transcriptPath(sessionID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []TranscriptEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var entry TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// transcriptCommands 将事件按命令分组
+func transcriptCommands(entries []TranscriptEntry) []TranscriptCommand {
+	commands := []TranscriptCommand{}
+	cur := -1 // 正在执行的命令在 commands 中的下标；后台任务的记录也会追加到 commands，不能保存指向元素的指针
+	for _, e := range entries {
+		switch e.Type {
+		case "start":
+			commands = append(commands, TranscriptCommand{Command: e.Command, Cwd: e.Cwd, StartedAt: e.Time})
+			cur = len(commands) - 1
+		case "job_start":
+			commands = append(commands, TranscriptCommand{Command: e.Command, JobID: e.JobID, Cwd: e.Cwd, StartedAt: e.Time})
+		case "stdout":
+			if cur >= 0 {
+				commands[cur].Stdout += e.Data
+			}
+		case "stderr":
+			if cur >= 0 {
+				commands[cur].Stderr += e.Data
+			}
+		case "exit":
+			if cur >= 0 {
+				c := &commands[cur]
+				endedAt := e.Time
+				c.EndedAt = &endedAt
+				c.ExitCode = e.ExitCode
+				c.DurationMs = e.DurationMs
+				c.Code = e.Code
+				c.Error = e.Error
+				cur = -1
+			}
+		}
+	}
+	return commands
+}
+
+// writeAsciicast 以 asciicast v2 格式输出会话记录：命令显示为带工作目录的提示符，stdout 和 stderr 均作为输出事件
+func writeAsciicast(w *bufio.Writer, sessionID string, entries []TranscriptEntry) error {
+	header := map[string]interface{}{
+		"version":         2,
+		"width":           asciicastWidth,
+		"height":          asciicastHeight,
+		"idle_time_limit": asciicastIdleTimeLimit,
+		"title":           "AIHelper terminal session " + sessionID,
+		"env":             map[string]string{"SHELL": "/bin/bash", "TERM": "xterm-256color"},
+	}
+	if len(entries) > 0 {
+		header["timestamp"] = entries[0].Time.Unix()
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		var text string
+		switch e.Type {
+		case "start":
+			text = fmt.Sprintf("\x1b[1;32m%s\x1b[0m$ %s\n", e.Cwd, e.Command)
+		case "job_start":
+			text = fmt.Sprintf("\x1b[1;32m%s\x1b[0m$ %s &\n\x1b[2m[%s]\x1b[0m\n", e.Cwd, e.Command, e.JobID)
+		case "stdout":
+			text = e.Data
+		case "stderr":
+			text = "\x1b[31m" + e.Data + "\x1b[0m"
+		case "exit":
+			switch {
+			case e.Error != "":
+				text = fmt.Sprintf("\x1b[2m[%s]\x1b[0m\n", e.Error)
+			case e.ExitCode != nil && *e.ExitCode != 0:
+				text = fmt.Sprintf("\x1b[2m[exit %d]\x1b[0m\n", *e.ExitCode)
+			}
+		}
+		if text == "" {
+			continue
+		}
+		// 输出中的换行还原为终端的回车换行
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+		offset := e.Time.Sub(entries[0].Time).Seconds()
+		if err := enc.Encode([]interface{}{offset, "o", text}); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// handleTerminalTranscript 返回终端会话的执行记录（会话关闭后仍可获取）
+// format=json（默认）按命令分组返回，format=asciicast 返回可用 asciinema 等播放器回放的 asciicast v2 文件
+func handleTerminalTranscript(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "asciicast" {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Invalid format: %s (expected json or asciicast)", format))
+		return
+	}
+
+	entries, err := readTranscript(id)
+	if os.IsNotExist(err) {
+		writeError(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("Transcript not found: %s", id))
+		return
+	}
+	if err != nil {
+		slog.Error("failed to read transcript", "session_id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to read transcript")
+		return
+	}
+
+	if format == "asciicast" {
+		w.Header().Set("Content-Type", "application/x-asciicast")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(strings.TrimSuffix(transcriptPath(id), ".jsonl"))+".cast"))
+		writeAsciicast(bufio.NewWriter(w), id, entries)
+		return
+	}
+	writeJSON(w, http.StatusOK, TerminalTranscript{SessionID: id, Commands: transcriptCommands(entries)})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTranscriptCommands(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	n := 0
+	event := func(e TerminalEvent) TranscriptEntry {
+		n++
+		return TranscriptEntry{Time: base.Add(time.Duration(n) * time.Second), TerminalEvent: e}
+	}
+	exitCode := func(code int) *int { return &code }
+
+	// 每条命令执行期间启动一个后台任务，commands 多次扩容后输出和退出码仍记录到各自的命令
+	var interleaved []TranscriptEntry
+	var want []TranscriptCommand
+	for i := 0; i < 20; i++ {
+		cmd, job := fmt.Sprintf("cmd-%d", i), fmt.Sprintf("job-%d", i)
+		interleaved = append(interleaved,
+			event(TerminalEvent{Type: "start", Command: cmd}),
+			event(TerminalEvent{Type: "stdout", Data: cmd + " out\n"}),
+			event(TerminalEvent{Type: "job_start", Command: "serve " + job, JobID: job}),
+			event(TerminalEvent{Type: "stderr", Data: cmd + " err\n"}),
+			event(TerminalEvent{Type: "exit", ExitCode: exitCode(i)}),
+		)
+		want = append(want,
+			TranscriptCommand{Command: cmd, Stdout: cmd + " out\n", Stderr: cmd + " err\n", ExitCode: exitCode(i)},
+			TranscriptCommand{Command: "serve " + job, JobID: job},
+		)
+	}
+
+	tests := []struct {
+		name    string
+		entries []TranscriptEntry
+		want    []TranscriptCommand
+	}{
+		{"empty", nil, []TranscriptCommand{}},
+		{"interleaved jobs", interleaved, want},
+		{
+			name: "output outside a command is dropped",
+			entries: []TranscriptEntry{
+				event(TerminalEvent{Type: "stdout", Data: "stray\n"}),
+				event(TerminalEvent{Type: "exit", ExitCode: exitCode(1)}),
+				event(TerminalEvent{Type: "start", Command: "ls"}),
+				event(TerminalEvent{Type: "exit", ExitCode: exitCode(0)}),
+				event(TerminalEvent{Type: "stdout", Data: "late\n"}),
+			},
+			want: []TranscriptCommand{{Command: "ls", ExitCode: exitCode(0)}},
+		},
+		{
+			name: "unfinished command",
+			entries: []TranscriptEntry{
+				event(TerminalEvent{Type: "start", Command: "sleep 100"}),
+				event(TerminalEvent{Type: "stdout", Data: "partial"}),
+			},
+			want: []TranscriptCommand{{Command: "sleep 100", Stdout: "partial"}},
+		},
+		{
+			name: "failed command",
+			entries: []TranscriptEntry{
+				event(TerminalEvent{Type: "start", Command: "make"}),
+				event(TerminalEvent{Type: "exit", Code: CodeCommandTimeout, Error: "command timed out"}),
+			},
+			want: []TranscriptCommand{{Command: "make", Code: CodeCommandTimeout, Error: "command timed out"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := transcriptCommands(tt.entries)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d commands, want %d", len(got), len(tt.want))
+			}
+			for i, c := range got {
+				w := tt.want[i]
+				if c.Command != w.Command || c.JobID != w.JobID || c.Stdout != w.Stdout || c.Stderr != w.Stderr ||
+					c.Code != w.Code || c.Error != w.Error || !equalIntPtr(c.ExitCode, w.ExitCode) {
+					t.Errorf("command %d = %+v, want %+v", i, c, w)
+				}
+				// 结束时间只记录在前台命令上
+				if ended := c.EndedAt != nil; ended != (w.JobID == "" && (w.ExitCode != nil || w.Error != "")) {
+					t.Errorf("command %d (%s) ended = %v", i, c.Command, ended)
+				}
+			}
+		})
+	}
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
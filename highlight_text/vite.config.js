@@ -31,6 +31,7 @@ export default defineConfig({
       '/log': 'http://localhost:8080',
       '/preview': 'http://localhost:8080',
       '/notes': 'http://localhost:8080',
+      '/agent': 'http://localhost:8080',
       '/ws': {
         target: 'ws://localhost:8080',
         ws: true
@@ -13,6 +13,8 @@ class AgentHandler {
         this.initialDirectory = null; // 初始工作目录
         this.logEntries = []; // 日志条目
         this.logFileName = null; // 日志文件名
+        this.terminalSocket = null; // 终端实时输出的WebSocket连接
+        this.liveOutput = null; // 正在执行的命令的实时输出区域
     }
 
     /**
@@ -27,7 +29,7 @@ class AgentHandler {
      */
     async fetchAvailableTools() {
         try {
-            const response = await fetch('http://localhost:8080/agent/tools');
+            const response = await fetch('/agent/tools');
             const data = await response.json();
             this.availableTools = data.tools;
             return this.availableTools;
@@ -39,10 +41,11 @@ class AgentHandler {
 
     /**
      * 向后端发送工具执行请求
+     * confirmation: 用户确认后重新提交时传入 { confirmId, alwaysAllow }
      */
-    async executeToolOnBackend(toolName, args, userConfirmed = false) {
+    async executeToolOnBackend(toolName, args, confirmation = null) {
         try {
-            const response = await fetch('http://localhost:8080/agent/execute', {
+            const response = await fetch('/agent/execute', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -52,7 +55,9 @@ class AgentHandler {
                     tool: toolName,
                     args: args,
                     action: 'execute',
-                    user_confirmed: userConfirmed,
+                    user_confirmed: confirmation !== null,
+                    confirm_id: confirmation ? confirmation.confirmId : undefined,
+                    always_allow: confirmation ? confirmation.alwaysAllow : undefined,
                     initial_directory: this.initialDirectory
                 })
             });
@@ -75,7 +80,88 @@ class AgentHandler {
     }
 
     /**
-     * 请求用户确认
+     * 组装工具执行结果文本：命令类工具附带标准错误和退出状态码
+     */
+    formatToolOutput(result) {
+        let text = result.output || '';
+        if (result.stderr) {
+            text += `${text ? '\n' : ''}[stderr]\n${result.stderr}`;
+        }
+        if (result.exit_code !== undefined && result.exit_code !== null) {
+            text += `${text ? '\n' : ''}[exit code: ${result.exit_code}, ${result.duration_ms || 0}ms]`;
+        }
+        return text;
+    }
+
+    /**
+     * 订阅当前会话的终端实时输出（命令执行期间在追踪区域显示，结束后由观察结果替代）
+     */
+    connectTerminalStream() {
+        this.disconnectTerminalStream();
+
+        const wsScheme = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const wsUrl = `${wsScheme}//${window.location.host}/ws/terminal/${encodeURIComponent(this.sessionId)}`;
+
+        this.terminalSocket = new WebSocket(wsUrl);
+        this.terminalSocket.onmessage = (event) => {
+            try {
+                this.handleTerminalEvent(JSON.parse(event.data));
+            } catch (error) {
+                console.error('解析终端输出失败:', error);
+            }
+        };
+    }
+
+    /**
+     * 关闭终端实时输出连接
+     */
+    disconnectTerminalStream() {
+        if (this.terminalSocket) {
+            this.terminalSocket.close();
+            this.terminalSocket = null;
+        }
+        this.liveOutput = null;
+    }
+
+    /**
+     * 处理终端事件：start 创建输出区域，stdout/stderr 追加内容，exit 移除输出区域
+     */
+    handleTerminalEvent(event) {
+        if (event.type === 'start') {
+            const container = this.getCurrentAgentBubble()?.querySelector('.agent-trace-content');
+            if (!container) return;
+
+            const stepDiv = document.createElement('div');
+            stepDiv.className = 'agent-trace-step border rounded-lg p-3 mb-2 bg-gray-900 bg-opacity-40 border-gray-600';
+            stepDiv.innerHTML = `
+                <div class="text-xs text-gray-400 mb-2">$ ${this.escapeHtml(event.command || '')}</div>
+                <pre class="agent-live-output text-xs text-gray-200 whitespace-pre-wrap"></pre>
+            `;
+            container.appendChild(stepDiv);
+            this.liveOutput = stepDiv;
+            return;
+        }
+
+        if (!this.liveOutput) return;
+
+        if (event.type === 'stdout' || event.type === 'stderr') {
+            const pre = this.liveOutput.querySelector('.agent-live-output');
+            const span = document.createElement('span');
+            if (event.type === 'stderr') {
+                span.className = 'text-red-400';
+            }
+            span.textContent = event.data;
+            pre.appendChild(span);
+            pre.scrollTop = pre.scrollHeight;
+            this.liveOutput.scrollIntoView({ block: 'end' });
+        } else if (event.type === 'exit') {
+            this.liveOutput.remove();
+            this.liveOutput = null;
+        }
+    }
+
+    /**
+     * 请求用户确认，返回 'once'（确认本次）、'always'（本会话始终允许）或 false
      */
     async requestUserConfirmation(message) {
         return new Promise((resolve) => {
@@ -91,6 +177,7 @@ class AgentHandler {
                     <p class="text-gray-200 mb-6">${this.escapeHtml(message)}</p>
                     <div class="flex justify-end gap-3">
                         <button id="agentConfirmCancel" class="px-4 py-2 bg-gray-600 hover:bg-gray-500 rounded">取消</button>
+                        <button id="agentConfirmAlways" class="px-4 py-2 bg-gray-600 hover:bg-gray-500 rounded">本会话始终允许</button>
                         <button id="agentConfirmOk" class="px-4 py-2 bg-yellow-600 hover:bg-yellow-500 rounded">确认执行</button>
                     </div>
                 </div>
@@ -105,7 +192,12 @@ class AgentHandler {
 
             document.getElementById('agentConfirmOk').onclick = () => {
                 document.body.removeChild(modal);
-                resolve(true);
+                resolve('once');
+            };
+
+            document.getElementById('agentConfirmAlways').onclick = () => {
+                document.body.removeChild(modal);
+                resolve('always');
             };
 
             document.getElementById('agentConfirmCancel').onclick = () => {
@@ -142,7 +234,7 @@ class AgentHandler {
         };
 
         try {
-            const response = await fetch('http://localhost:8080/agent/save-log', {
+            const response = await fetch('/agent/save-log', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -168,7 +260,7 @@ class AgentHandler {
         if (!this.sessionId) return;
 
         try {
-            await fetch('http://localhost:8080/agent/execute', {
+            await fetch('/agent/execute', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -182,6 +274,8 @@ class AgentHandler {
             console.error('关闭会话失败:', error);
         }
 
+        this.disconnectTerminalStream();
+
         // 保存日志
         await this.saveLogToFile();
 
@@ -471,6 +565,7 @@ read_file 工具已经整合了多种读取模式，通过不同的可选参数
         // 初始化
         this.sessionId = this.generateSessionId();
         this.isActive = true;
+        this.connectTerminalStream();
         this.conversationHistory = [];
         this.logEntries = [];
         this.logFileName = `agent_${Date.now()}.json`;
@@ -587,10 +682,14 @@ read_file 工具已经整合了多种读取模式，通过不同的可选参数
                         const confirmed = await this.requestUserConfirmation(result.confirm_message);
 
                         if (confirmed) {
-                            this.addTraceStep('action', '✓ 用户已确认，继续执行');
-                            this.addLogEntry('confirmed', '用户确认执行');
-                            // 重新执行，带上确认标志
-                            result = await this.executeToolOnBackend(parsed.action, parsed.action_input, true);
+                            const alwaysAllow = confirmed === 'always';
+                            this.addTraceStep('action', alwaysAllow ? '✓ 用户已确认（本会话始终允许），继续执行' : '✓ 用户已确认，继续执行');
+                            this.addLogEntry('confirmed', alwaysAllow ? '用户确认执行，本会话始终允许' : '用户确认执行');
+                            // 重新执行，带上服务端签发的确认ID
+                            result = await this.executeToolOnBackend(parsed.action, parsed.action_input, {
+                                confirmId: result.confirm_id,
+                                alwaysAllow: alwaysAllow
+                            });
                         } else {
                             this.addTraceStep('error', '✗ 用户取消操作');
                             this.addLogEntry('cancelled', '用户取消操作');
@@ -600,14 +699,15 @@ read_file 工具已经整合了多种读取模式，通过不同的可选参数
                     }
 
                     if (result.success) {
-                        this.addTraceStep('observation', result.output);
-                        this.addLogEntry('observation', result.output, { cwd: result.cwd });
+                        const output = this.formatToolOutput(result);
+                        this.addTraceStep('observation', output);
+                        this.addLogEntry('observation', output, { cwd: result.cwd });
 
                         // 保存观察结果到会话
                         if (activeSession) {
                             activeSession.messages.push({
                                 role: 'system',
-                                content: result.output,
+                                content: output,
                                 type: 'agent_observation',
                                 cwd: result.cwd,
                                 iteration: iteration,
@@ -622,10 +722,10 @@ read_file 工具已经整合了多种读取模式，通过不同的可选参数
                         });
                         this.conversationHistory.push({
                             role: 'user',
-                            content: `工具执行结果:\n${result.output}\n当前工作目录: ${result.cwd}`
+                            content: `工具执行结果:\n${output}\n当前工作目录: ${result.cwd}`
                         });
 
-                        currentMessage = `工具执行结果:\n${result.output}\n当前工作目录: ${result.cwd}`;
+                        currentMessage = `工具执行结果:\n${output}\n当前工作目录: ${result.cwd}`;
                     } else {
                         this.addTraceStep('error', result.error || '工具执行失败');
                         this.addLogEntry('error', result.error || '工具执行失败');
@@ -37,7 +37,7 @@ class KnowledgeAgentHandler {
             };
 
             // 调用后端API写入日志
-            const response = await fetch('http://localhost:8080/agent/knowledge/write-log', {
+            const response = await fetch('/agent/knowledge/write-log', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({
@@ -59,7 +59,7 @@ class KnowledgeAgentHandler {
      */
     async fetchAvailableTools() {
         try {
-            const response = await fetch('http://localhost:8080/agent/knowledge/tools');
+            const response = await fetch('/agent/knowledge/tools');
             const data = await response.json();
 
             // 过滤掉已弃用的写入工具
@@ -417,7 +417,7 @@ JSON格式：
         }
 
         try {
-            const response = await fetch('http://localhost:8080/agent/execute', {
+            const response = await fetch('/agent/execute', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -109,7 +109,10 @@ class AIAssistant {
 
     async loadConfig() {
         try {
-            const response = await fetch('./config.json');
+            const response = await fetch('/api/config');
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
             this.config = await response.json();
         } catch (error) {
             console.error('Failed to load config:', error);
@@ -117,6 +120,19 @@ class AIAssistant {
         }
     }
 
+    /**
+     * 应用服务端推送的新配置（其他窗口或设备保存设置后触发）
+     * 原地更新 this.config，保持 SettingsManager 等持有的引用有效
+     */
+    applyConfig(config) {
+        if (!this.config || !config) return;
+        Object.keys(this.config).forEach(key => delete this.config[key]);
+        Object.assign(this.config, config);
+        if (this.shortcutManager) {
+            this.shortcutManager.loadSettings(this.config.shortcuts || []);
+        }
+    }
+
     loadSettings() {
         const savedSettings = localStorage.getItem('appSettings');
         if (savedSettings) {
@@ -59,7 +59,7 @@ export class SettingsManager {
      */
     async loadWorkspaceSettings() {
         try {
-            const response = await fetch('http://localhost:8080/api/workspace');
+            const response = await fetch('/api/workspace');
             if (response.ok) {
                 const data = await response.json();
                 document.getElementById('workspacePathInput').value = data.absolute_path || '';
@@ -142,7 +142,7 @@ export class SettingsManager {
         // 加载目录内容
         const loadDirectory = async (path = '') => {
             try {
-                const response = await fetch('http://localhost:8080/api/workspace/browse', {
+                const response = await fetch('/api/workspace/browse', {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({ start_path: path })
@@ -203,7 +203,7 @@ export class SettingsManager {
      */
     async setWorkspace(path) {
         try {
-            const response = await fetch('http://localhost:8080/api/workspace/set', {
+            const response = await fetch('/api/workspace/set', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ path })
@@ -693,10 +693,10 @@ export class SettingsManager {
             };
         }).filter(s => s.key && s.description); // 过滤掉空项
 
-        // 将配置保存到config.json
+        // 将配置保存到服务端（数据目录中的用户配置）
         try {
-            const response = await fetch('http://localhost:8080/api/save-config', {
-                method: 'POST',
+            const response = await fetch('/api/config', {
+                method: 'PUT',
                 headers: {
                     'Content-Type': 'application/json',
                 },
@@ -704,7 +704,9 @@ export class SettingsManager {
             });
 
             if (!response.ok) {
-                throw new Error('保存配置失败');
+                const error = await response.json().catch(() => ({}));
+                const details = error.details ? `: ${error.details.join('; ')}` : '';
+                throw new Error((error.error || '保存配置失败') + details);
             }
 
             // 更新快捷键管理器
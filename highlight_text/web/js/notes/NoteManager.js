@@ -48,7 +48,7 @@ class NoteManager {
      */
     async loadNotes() {
         try {
-            const response = await fetch('http://localhost:8080/api/notes');
+            const response = await fetch('/api/notes');
             if (!response.ok) {
                 console.warn('加载笔记列表失败');
                 return;
@@ -327,7 +327,7 @@ class NoteManager {
                 }
             } else if (fileExt === 'txt') {
                 // TXT文件：在预览区域显示纯文本
-                const response = await fetch(`http://localhost:8080/api/notes/${noteId}`);
+                const response = await fetch(`/api/notes/${noteId}`);
                 const content = await response.text();
 
                 // 隐藏编辑器，显示预览
@@ -349,7 +349,7 @@ class NoteManager {
                 }
             } else {
                 // Markdown文件：正常加载到编辑器
-                const response = await fetch(`http://localhost:8080/api/notes/${noteId}`);
+                const response = await fetch(`/api/notes/${noteId}`);
                 const content = await response.text();
 
                 // 初始化编辑器
@@ -457,7 +457,7 @@ class NoteManager {
         }
 
         try {
-            const response = await fetch(`http://localhost:8080/api/notes/${this.activeNoteId}`, {
+            const response = await fetch(`/api/notes/${this.activeNoteId}`, {
                 method: 'PUT',
                 headers: {
                     'Content-Type': 'application/json',
@@ -493,7 +493,7 @@ class NoteManager {
         }
 
         try {
-            const response = await fetch('http://localhost:8080/api/notes/delete', {
+            const response = await fetch('/api/notes/delete', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -538,7 +538,7 @@ class NoteManager {
      */
     async moveNoteOrFolder(sourcePath, targetFolderPath) {
         try {
-            const response = await fetch('http://localhost:8080/api/notes/move', {
+            const response = await fetch('/api/notes/move', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -746,7 +746,7 @@ tags: []
 `;
 
             // 调用后端API创建笔记
-            const response = await fetch(`http://localhost:8080/api/notes/${noteId}`, {
+            const response = await fetch(`/api/notes/${noteId}`, {
                 method: 'PUT',
                 headers: {
                     'Content-Type': 'application/json',
@@ -790,7 +790,7 @@ tags: []
             // 在文件夹中创建一个.gitkeep文件以确保文件夹被创建
             const placeholderPath = `${folderPath}/.gitkeep`;
 
-            const response = await fetch(`http://localhost:8080/api/notes/${encodeURIComponent(placeholderPath)}`, {
+            const response = await fetch(`/api/notes/${encodeURIComponent(placeholderPath)}`, {
                 method: 'PUT',
                 headers: {
                     'Content-Type': 'application/json',
@@ -983,7 +983,7 @@ tags: []
                 formData.append('note_id', this.activeNoteId);
             }
 
-            const response = await fetch('http://localhost:8080/api/notes/upload-image', {
+            const response = await fetch('/api/notes/upload-image', {
                 method: 'POST',
                 body: formData
             });
@@ -1047,7 +1047,9 @@ tags: []
      * 初始化知识库WebSocket连接
      */
     initNotesWebSocket() {
-        const wsUrl = 'ws://localhost:8080/ws/notes';
+        // 与页面使用相同的主机和协议（HTTPS 页面使用 wss://）
+        const wsScheme = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const wsUrl = `${wsScheme}//${window.location.host}/ws/notes`;
 
         const connectWebSocket = () => {
             this.notesWebSocket = new WebSocket(wsUrl);
@@ -1066,6 +1068,8 @@ tags: []
                         if (this.app.uiManager) {
                             this.app.uiManager.showNotification(`工作空间已切换至: ${message.workspace}`, 'success');
                         }
+                    } else if (message.type === 'config_changed') {
+                        this.app.applyConfig(message.config);
                     }
                 } catch (error) {
                     console.error('解析WebSocket消息失败:', error);
@@ -376,7 +376,7 @@ export class MultiFileDiffManager {
         }
 
         // 否则，从后端读取
-        const response = await fetch('http://localhost:8080/agent/execute', {
+        const response = await fetch('/agent/execute', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({
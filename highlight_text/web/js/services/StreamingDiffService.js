@@ -174,7 +174,7 @@ export class StreamingDiffService {
         // 如果是新文件创建，需要调用后端API创建文件
         if (this.isNewFileCreation && this.newFileNoteId) {
             try {
-                const response = await fetch('http://localhost:8080/agent/execute', {
+                const response = await fetch('/agent/execute', {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"net/http"
@@ -132,11 +133,6 @@ func isSupportedFile(filename string) bool {
 
 // HandleGetWorkspace 获取当前工作空间信息
 func HandleGetWorkspace(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	info := workspaceManager.GetWorkspaceInfo()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(info)
@@ -149,24 +145,18 @@ type SetWorkspaceRequest struct {
 
 // HandleSetWorkspace 设置工作空间路径
 func HandleSetWorkspace(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req SetWorkspaceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	if req.Path == "" {
-		http.Error(w, "Path is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "Path is required")
 		return
 	}
 
 	if err := workspaceManager.SetWorkspacePath(req.Path); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
 		return
 	}
 
@@ -189,13 +179,13 @@ type BrowseFolderRequest struct {
 // 注意：这个功能在Web环境中需要前端使用<input type="file" webkitdirectory>
 // 或者实现一个文件系统浏览器UI
 func HandleBrowseFolder(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req BrowseFolderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeBodyError(w, err, CodeBadRequest, "")
+			return
+		}
 		// 如果解析失败，使用默认路径
 		req.StartPath = "."
 	}
@@ -208,14 +198,14 @@ func HandleBrowseFolder(w http.ResponseWriter, r *http.Request) {
 	// 获取绝对路径
 	absPath, err := filepath.Abs(startPath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Invalid path: %v", err))
 		return
 	}
 
 	// 列出目录内容
 	entries, err := os.ReadDir(absPath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Cannot read directory: %v", err), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Cannot read directory: %v", err))
 		return
 	}
 